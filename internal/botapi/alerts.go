@@ -0,0 +1,311 @@
+package botapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	telegramBot "github.com/go-telegram/bot"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+// /////////////////////////////////////////////////////////////////////////////
+// Poller pushing the severe weather alerts of the watched locations
+// /////////////////////////////////////////////////////////////////////////////
+
+const (
+	defaultAlertsPollInterval = time.Hour
+	// the alerts use at most that many requests a day, the free AccuWeather tier has 50
+	// shared with the forecasts
+	defaultAlertsDailyRequests = 20
+	// polling pauses while AccuWeather reports that few requests left for the day
+	defaultAlertsQuotaReserve = 20
+	// ended alerts are remembered that long so that they are not pushed again
+	alertNotificationRetention = 7 * 24 * time.Hour
+)
+
+type alertPoller struct {
+	b             *Bot
+	af            fetch.Fetchable[fetch.AlertsQuery, []fetch.Alert]
+	quota         *fetch.Quota
+	interval      time.Duration
+	dailyRequests int
+	reserve       int
+}
+
+// newAlertPoller returns nil if the alerts fetcher is disabled
+func newAlertPoller(b *Bot) *alertPoller {
+	af := getFetcher[fetch.Fetchable[fetch.AlertsQuery, []fetch.Alert]](b, "alerts")
+	if af == nil {
+		return nil
+	}
+	return &alertPoller{
+		b:             b,
+		af:            af,
+		quota:         b.accuWeatherQuota,
+		interval:      envDuration("ALERTS_POLL_INTERVAL", defaultAlertsPollInterval),
+		dailyRequests: max(envInt("ALERTS_DAILY_REQUESTS", defaultAlertsDailyRequests), 1),
+		reserve:       envInt("ALERTS_QUOTA_RESERVE", defaultAlertsQuotaReserve),
+	}
+}
+
+// pollDelay spreads the daily requests over the day, every poll takes a request per location
+// since the location keys are cached
+func (p *alertPoller) pollDelay(locations int) time.Duration {
+	return max(p.interval, 24*time.Hour*time.Duration(locations)/time.Duration(p.dailyRequests))
+}
+
+// run blocks until the context is done
+func (p *alertPoller) run(ctx context.Context) {
+	p.b.logger.Info().Dur("interval", p.interval).Int("daily_requests", p.dailyRequests).Msg("running weather alerts poller")
+
+	for {
+		delay := p.pollDelay(p.poll(ctx))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// alertTarget is a place to poll with the chats watching it
+type alertTarget struct {
+	key   string
+	query fetch.AlertsQuery
+	chats []int64
+}
+
+// alertLocationKey identifies the polled place, the picked place or the normalized city
+func alertLocationKey(city string, choice *fetch.Location) string {
+	if choice != nil && choice.Key != "" {
+		return "key:" + choice.Key
+	}
+	return fetch.NormalizeCity(city)
+}
+
+// groupWatches polls every place once per language however many chats watch it, a chat gets
+// the alerts of a place in the language of its first watch of it
+func groupWatches(watches []database.WatchedLocation, choice func(userID int64, city string) *fetch.Location) []*alertTarget {
+	var targets []*alertTarget
+	byKey := make(map[string]*alertTarget)
+	watched := make(map[string]bool)
+	for _, w := range watches {
+		location := choice(w.UserID, w.City)
+		key := alertLocationKey(w.City, location)
+		chatKey := fmt.Sprintf("%s/%d", key, w.ChatID)
+		if watched[chatKey] {
+			continue
+		}
+		watched[chatKey] = true
+
+		t, ok := byKey[key+"/"+w.Language]
+		if !ok {
+			t = &alertTarget{key: key, query: fetch.AlertsQuery{City: w.City, Location: location, Language: w.Language}}
+			byKey[key+"/"+w.Language] = t
+			targets = append(targets, t)
+		}
+		t.chats = append(t.chats, w.ChatID)
+	}
+	return targets
+}
+
+// allowedWatches keeps the watches of the users who may still watch, a user may have lost the
+// role since
+func allowedWatches(watches []database.WatchedLocation, role func(userID int64) UserRole) []database.WatchedLocation {
+	minRole := commandMinRole("watch")
+	roles := make(map[int64]UserRole)
+	var allowed []database.WatchedLocation
+	for _, w := range watches {
+		r, ok := roles[w.UserID]
+		if !ok {
+			r = role(w.UserID)
+			roles[w.UserID] = r
+		}
+		if r >= minRole {
+			allowed = append(allowed, w)
+		}
+	}
+	return allowed
+}
+
+// watchLanguages sets the language of every watch to the language of the settings of its user
+// or else leaves the language saved with the watch
+func (b *Bot) watchLanguages(ctx context.Context, watches []database.WatchedLocation) {
+	languages := make(map[int64]string)
+	for i := range watches {
+		w := &watches[i]
+		language, ok := languages[w.UserID]
+		if !ok {
+			language = b.userSettings(ctx, w.UserID).Language
+			languages[w.UserID] = language
+		}
+		if language != "" {
+			w.Language = language
+		}
+	}
+}
+
+// poll fetches the alerts of every watched place and returns the number of places. The
+// watches of the chats the bot is blocked in are dropped
+func (p *alertPoller) poll(ctx context.Context) int {
+	watches, err := p.b.db.ListWatchedLocations(ctx, 0)
+	if err != nil {
+		p.b.logger.Error().Err(err).Msg("Failed to list watched locations")
+		return 0
+	}
+
+	watches = allowedWatches(watches, p.b.getUserRole)
+	p.b.watchLanguages(ctx, watches)
+	targets := groupWatches(watches, func(userID int64, city string) *fetch.Location {
+		return p.b.locationChoice(ctx, userID, city)
+	})
+	blocked := make(map[int64]bool)
+	for _, t := range targets {
+		if remaining, known := p.quota.Remaining(p.interval); known && remaining <= p.reserve {
+			p.b.logger.Warn().Int("remaining", remaining).Msg("AccuWeather quota is low, postponing weather alerts")
+			break
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		alerts, err := p.af.Fetch(fetchCtx, t.query)
+		cancel()
+		var ambiguous *fetch.AmbiguousLocationError
+		if errors.As(err, &ambiguous) {
+			// the place is asked about when it is watched, until then it cannot be polled
+			p.b.logger.Warn().Str("location", t.key).Msg("watched location is ambiguous, skipping")
+			continue
+		}
+		if err != nil {
+			p.b.logger.Error().Err(err).Str("location", t.key).Msg("Failed to fetch weather alerts")
+			continue
+		}
+
+		for _, chatID := range t.chats {
+			if blocked[chatID] {
+				continue
+			}
+			err := p.b.notifyAlerts(ctx, chatID, t.key, alerts, i18n.For(t.query.Language))
+			if !errors.Is(err, telegramBot.ErrorForbidden) {
+				continue
+			}
+			blocked[chatID] = true
+			p.b.logger.Warn().Err(err).Int64("chat", chatID).Msg("the bot is blocked in the chat, dropping its watched locations")
+			if _, err := p.b.db.DeleteChatWatchedLocations(ctx, chatID); err != nil {
+				p.b.logger.Error().Err(err).Int64("chat", chatID).Msg("Failed to delete watched locations")
+			}
+		}
+	}
+
+	if _, err := p.b.db.PruneAlertNotifications(ctx, time.Now().Add(-alertNotificationRetention)); err != nil {
+		p.b.logger.Error().Err(err).Msg("Failed to prune alert notifications")
+	}
+	return len(targets)
+}
+
+// notifyAlerts pushes the new alerts of the place once, edits the messages of the updated ones
+// and marks the messages of the alerts that are gone as ended. It stops with the error of the
+// Telegram API when the bot is blocked in the chat
+func (b *Bot) notifyAlerts(ctx context.Context, chatID int64, location string, alerts []fetch.Alert, l i18n.Localizer) error {
+	current := make(map[string]bool, len(alerts))
+	for i := range alerts {
+		alert := &alerts[i]
+		current[alert.ID] = true
+		text := renderAlert(alert, l)
+
+		// the same alert may come for several watched places of the chat
+		n, err := b.db.GetAlertNotification(ctx, alert.ID, chatID)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to get alert notification")
+			continue
+		}
+
+		if n == nil {
+			messageID, err := b.sendMarkdownMessage(ctx, chatID, text)
+			if errors.Is(err, telegramBot.ErrorForbidden) {
+				return err
+			}
+			if err != nil {
+				b.logger.Error().Err(err).Str("alert", alert.ID).Msg("Failed to send weather alert")
+				continue
+			}
+			n = &database.AlertNotification{AlertID: alert.ID, ChatID: chatID, MessageID: messageID, Location: location}
+		} else if n.Text == text && !n.Ended {
+			continue
+		} else if err := b.editMarkdown(ctx, chatID, n.MessageID, text); errors.Is(err, telegramBot.ErrorForbidden) {
+			return err
+		} else if err != nil {
+			b.logger.Error().Err(err).Str("alert", alert.ID).Msg("Failed to edit weather alert")
+			continue
+		}
+
+		n.Text, n.Ended = text, false
+		if err := b.db.SaveAlertNotification(ctx, n); err != nil {
+			b.logger.Error().Err(err).Msg("Failed to save alert notification")
+		}
+	}
+
+	active, err := b.db.ActiveAlertNotifications(ctx, chatID, location)
+	if err != nil {
+		b.logger.Error().Err(err).Msg("Failed to get active alert notifications")
+		return nil
+	}
+	for i := range active {
+		n := &active[i]
+		if current[n.AlertID] {
+			continue
+		}
+		// the message may be too old to edit, the alert is ended anyway
+		if err := b.editMarkdown(ctx, chatID, n.MessageID, renderEndedAlert(n.Text, l)); errors.Is(err, telegramBot.ErrorForbidden) {
+			return err
+		} else if err != nil {
+			b.logger.Warn().Err(err).Str("alert", n.AlertID).Msg("Failed to mark weather alert as ended")
+		}
+		n.Ended = true
+		if err := b.db.SaveAlertNotification(ctx, n); err != nil {
+			b.logger.Error().Err(err).Msg("Failed to save alert notification")
+		}
+	}
+	return nil
+}
+
+// renderAlert renders Markdown, the areas with their validity and summary
+func renderAlert(a *fetch.Alert, l i18n.Localizer) string {
+	var r strings.Builder
+	r.WriteString("⚠️ **" + a.Description + "**")
+	if a.Level != "" {
+		r.WriteString(" (" + a.Level + ")")
+	}
+	r.WriteString("\n")
+	for _, area := range a.Areas {
+		r.WriteString("\n" + area.Name)
+		if !area.Start.IsZero() {
+			r.WriteString(", " + l.T("alert.from", dateTime(area.Start, l)))
+		}
+		if !area.End.IsZero() {
+			r.WriteString(" " + l.T("alert.until", dateTime(area.End, l)))
+		}
+		if area.Summary != "" {
+			r.WriteString(": " + area.Summary)
+		}
+		r.WriteString("\n")
+	}
+	if a.Link != "" {
+		r.WriteString(fmt.Sprintf("\n[%s](%s)", l.T("alert.details"), a.Link))
+	}
+	if a.Source != "" {
+		r.WriteString(fmt.Sprintf("\n_%s_", l.T("forecast.source", a.Source)))
+	}
+	return r.String()
+}
+
+func renderEndedAlert(text string, l i18n.Localizer) string {
+	return "✅ **" + l.T("alert.ended") + "**\n\n" + strings.Replace(text, "⚠️ ", "", 1)
+}
@@ -0,0 +1,105 @@
+package botapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+func TestAlertPoller_PollDelay(t *testing.T) {
+	p := &alertPoller{interval: time.Hour, dailyRequests: 20}
+	assert.Equal(t, time.Hour, p.pollDelay(0))
+	assert.Equal(t, 72*time.Minute, p.pollDelay(1))
+	// 3 places polled 20 times a day would take 60 requests
+	assert.Equal(t, 3*time.Hour+36*time.Minute, p.pollDelay(3))
+}
+
+func TestGroupWatches(t *testing.T) {
+	paris := &fetch.Location{Key: "351", Name: "Paris", Region: "Texas"}
+	watches := []database.WatchedLocation{
+		{ID: 1, UserID: 1, ChatID: 10, City: "Houston"},
+		{ID: 2, UserID: 2, ChatID: 20, City: "houston "},
+		{ID: 3, UserID: 1, ChatID: 10, City: "Paris"},
+		{ID: 4, UserID: 3, ChatID: 10, City: "HOUSTON", Language: "de"},
+		{ID: 5, UserID: 4, ChatID: 40, City: "Houston", Language: "de"},
+	}
+	targets := groupWatches(watches, func(userID int64, city string) *fetch.Location {
+		if city == "Paris" {
+			return paris
+		}
+		return nil
+	})
+
+	if assert.Len(t, targets, 3) {
+		assert.Equal(t, "houston", targets[0].key)
+		assert.Equal(t, []int64{10, 20}, targets[0].chats)
+		assert.Equal(t, "key:351", targets[1].key)
+		assert.Equal(t, paris, targets[1].query.Location)
+		// chat 10 gets the alerts of Houston once, in the language of its first watch
+		assert.Equal(t, "houston", targets[2].key)
+		assert.Equal(t, "de", targets[2].query.Language)
+		assert.Equal(t, []int64{40}, targets[2].chats)
+	}
+}
+
+func TestRenderAlert(t *testing.T) {
+	zone := time.FixedZone("CDT", -5*3600)
+	alert := &fetch.Alert{
+		ID:          "41375",
+		Description: "Flash Flood Warning",
+		Level:       "Severe",
+		Source:      "U.S. National Weather Service",
+		Areas: []fetch.AlertArea{{
+			Name:    "Harris",
+			Start:   time.Date(2024, 7, 2, 9, 0, 0, 0, zone),
+			End:     time.Date(2024, 7, 2, 12, 0, 0, 0, zone),
+			Summary: "Flash flooding ongoing",
+		}},
+	}
+	en := i18n.For("en")
+	text := renderAlert(alert, en)
+	assert.Equal(t, "⚠️ **Flash Flood Warning** (Severe)\n\nHarris, from Tue 02.07 09:00 until Tue 02.07 12:00: Flash flooding ongoing\n"+
+		"\n_Source: U.S. National Weather Service_", text)
+	assert.Equal(t, "✅ **Ended or cancelled**\n\n**Flash Flood Warning** (Severe)\n\nHarris, from Tue 02.07 09:00 until Tue 02.07 12:00: Flash flooding ongoing\n"+
+		"\n_Source: U.S. National Weather Service_", renderEndedAlert(text, en))
+
+	de := i18n.For("de")
+	assert.Equal(t, "⚠️ **Flash Flood Warning** (Severe)\n\nHarris, ab Di 02.07 09:00 bis Di 02.07 12:00: Flash flooding ongoing\n"+
+		"\n_Quelle: U.S. National Weather Service_", renderAlert(alert, de))
+}
+
+func TestParseIDOrAll(t *testing.T) {
+	for arg, want := range map[string]int64{"3": 3, "#12": 12, "all": 0, "ALL": 0} {
+		id, ok := parseIDOrAll(arg)
+		assert.True(t, ok, arg)
+		assert.Equal(t, want, id, arg)
+	}
+	for _, arg := range []string{"0", "-1", "berlin", ""} {
+		_, ok := parseIDOrAll(arg)
+		assert.False(t, ok, arg)
+	}
+}
+
+func TestAllowedWatches(t *testing.T) {
+	watches := []database.WatchedLocation{
+		{ID: 1, UserID: 1, ChatID: 10, City: "Houston"},
+		{ID: 2, UserID: 2, ChatID: 20, City: "Houston"},
+		{ID: 3, UserID: 1, ChatID: 10, City: "Paris"},
+	}
+	lookups := 0
+	got := allowedWatches(watches, func(userID int64) UserRole {
+		lookups++
+		if userID == 2 {
+			return RegularUser
+		}
+		return PromotedUser
+	})
+
+	assert.Equal(t, []database.WatchedLocation{watches[0], watches[2]}, got)
+	assert.Equal(t, 2, lookups, "the role is looked up once per user")
+}
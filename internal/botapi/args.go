@@ -0,0 +1,466 @@
+package botapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+// /////////////////////////////////////////////////////////////////////////////
+// Declarative command arguments, the same spec parses the arguments and renders
+// the usage shown in /help and in the error messages
+// /////////////////////////////////////////////////////////////////////////////
+
+type ArgKind int
+
+const (
+	StringArg ArgKind = iota
+	IntArg
+	EnumArg
+	// BoolArg is only valid for flags, "--chart" sets it
+	BoolArg
+)
+
+// Arg declares a positional argument or a --flag of a command
+type Arg struct {
+	Name     string
+	Kind     ArgKind
+	Optional bool
+	// Words takes several words, e.g. "new york", and leaves the following arguments the
+	// words they need, a spec may have one such argument
+	Words bool
+	// Rest takes the rest of the text as it is, including newlines and words starting with
+	// "--", it must be the last argument
+	Rest bool
+	// Flag makes the argument a --name option, flags are always optional
+	Flag bool
+	// Min and Max bound IntArg values, Max 0 means no upper bound
+	Min, Max int64
+	// Values lists the EnumArg values, a word matches a value exactly but in any case so that
+	// a city like "Hou..." is not taken for "hours"
+	Values []string
+	// Placeholder replaces the name in the usage, e.g. "prompt|reset"
+	Placeholder string
+}
+
+type ArgSpec []Arg
+
+// ArgError is an argument the user got wrong, the message is translated for the reply and
+// is English in Error
+type ArgError struct {
+	ID   string
+	Args []any
+}
+
+func argError(id string, args ...any) *ArgError {
+	return &ArgError{ID: id, Args: args}
+}
+
+func (e *ArgError) Error() string {
+	return e.Localize(i18n.For(i18n.DefaultLanguage))
+}
+
+func (e *ArgError) Localize(l i18n.Localizer) string {
+	return l.T(e.ID, e.Args...)
+}
+
+// localizeError translates an ArgError, the other errors stay as they are
+func localizeError(err error, l i18n.Localizer) string {
+	var argErr *ArgError
+	if errors.As(err, &argErr) {
+		return argErr.Localize(l)
+	}
+	return err.Error()
+}
+
+// Args are the parsed values by the argument name, enum values are the full lowercase values
+type Args map[string]string
+
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+func (a Args) String(name string) string {
+	return a[name]
+}
+
+// Int returns 0 if the argument is not set
+func (a Args) Int(name string) int {
+	return int(a.Int64(name))
+}
+
+func (a Args) Int64(name string) int64 {
+	v, _ := strconv.ParseInt(a[name], 10, 64)
+	return v
+}
+
+func (a Args) Bool(name string) bool {
+	return a[name] == "true"
+}
+
+func (a Arg) placeholder() string {
+	switch {
+	case a.Placeholder != "":
+		return a.Placeholder
+	case a.Kind == EnumArg:
+		return strings.Join(a.Values, "|")
+	case a.Flag && a.Kind == IntArg:
+		return "N"
+	}
+	return a.Name
+}
+
+func (a Arg) usage() string {
+	if a.Flag {
+		if a.Kind == BoolArg {
+			return "[--" + a.Name + "]"
+		}
+		return "[--" + a.Name + " " + a.placeholder() + "]"
+	}
+
+	name := a.placeholder()
+	if (a.Words || a.Rest) && a.Placeholder == "" {
+		name += "..."
+	}
+	if a.Optional {
+		return "[" + name + "]"
+	}
+	return "<" + name + ">"
+}
+
+// Usage renders the arguments, positional ones first, e.g. "<city...> [N] [days|hours] [--hours N]"
+func (s ArgSpec) Usage() string {
+	var parts []string
+	for _, a := range s.positional() {
+		parts = append(parts, a.usage())
+	}
+	for _, a := range s {
+		if a.Flag {
+			parts = append(parts, a.usage())
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s ArgSpec) positional() []Arg {
+	var args []Arg
+	for _, a := range s {
+		if !a.Flag {
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+func (s ArgSpec) hasFlags() bool {
+	for _, a := range s {
+		if a.Flag {
+			return true
+		}
+	}
+	return false
+}
+
+func (s ArgSpec) flag(name string) (Arg, bool) {
+	for _, a := range s {
+		if a.Flag && a.Name == name {
+			return a, true
+		}
+	}
+	return Arg{}, false
+}
+
+// validate reports the specs the parser cannot handle, registerCommand panics on them
+func (s ArgSpec) validate() error {
+	positional := s.positional()
+	multi := 0
+	for i, a := range positional {
+		if a.Kind == BoolArg {
+			return fmt.Errorf("positional argument %s cannot be a bool", a.Name)
+		}
+		if a.Rest && i != len(positional)-1 {
+			return fmt.Errorf("rest argument %s must be the last one", a.Name)
+		}
+		if a.Words || a.Rest {
+			multi++
+		}
+	}
+	if multi > 1 {
+		return fmt.Errorf("only one words or rest argument is allowed")
+	}
+	for _, a := range s {
+		if a.Kind == EnumArg && len(a.Values) == 0 {
+			return fmt.Errorf("enum argument %s has no values", a.Name)
+		}
+	}
+	return nil
+}
+
+// value checks the word against the kind of the argument and returns the value to store
+func (a Arg) value(word string) (string, error) {
+	switch a.Kind {
+	case IntArg:
+		v, err := strconv.ParseInt(word, 10, 64)
+		if err != nil {
+			return "", argError("args.not_number", a.usageName(), word)
+		}
+		if v < a.Min || (a.Max != 0 && v > a.Max) {
+			if a.Max != 0 {
+				return "", argError("args.out_of_range", a.usageName(), a.Min, a.Max)
+			}
+			return "", argError("args.too_small", a.usageName(), a.Min)
+		}
+		return strconv.FormatInt(v, 10), nil
+	case EnumArg:
+		lower := strings.ToLower(word)
+		for _, v := range a.Values {
+			if lower == v {
+				return v, nil
+			}
+		}
+		return "", argError("args.not_enum", a.usageName(), strings.Join(a.Values, ", "), word)
+	case BoolArg:
+		switch strings.ToLower(word) {
+		case "true", "yes", "on", "1":
+			return "true", nil
+		case "false", "no", "off", "0":
+			return "false", nil
+		}
+		return "", argError("args.not_bool", a.usageName(), word)
+	}
+	return word, nil
+}
+
+// accepts tells whether the word is of the kind of the argument, an optional argument does
+// not take words of other kinds but a number out of range is an error
+func (a Arg) accepts(word string) bool {
+	switch a.Kind {
+	case IntArg:
+		_, err := strconv.ParseInt(word, 10, 64)
+		return err == nil
+	case EnumArg, BoolArg:
+		_, err := a.value(word)
+		return err == nil
+	}
+	return true
+}
+
+func (a Arg) usageName() string {
+	if a.Flag {
+		return "--" + a.Name
+	}
+	return a.usage()
+}
+
+type argToken struct {
+	text   string
+	start  int
+	quoted bool
+}
+
+// quotePairs are the quotes accepted around a multi-word argument, phones often replace the
+// straight quotes with the typographic ones. Single quotes are not quotes since they are
+// apostrophes in names like "Val d'Isere"
+var quotePairs = map[rune]rune{'"': '"', '“': '”', '„': '“', '«': '»'}
+
+// tokenizeArgs splits the text into words, a quoted text is a single word and a quote that
+// is never closed is a part of the word
+func tokenizeArgs(text string) []argToken {
+	var tokens []argToken
+	runes := []rune(text)
+	offset := func(i int) int { return len(string(runes[:i])) }
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		if closing, ok := quotePairs[runes[i]]; ok {
+			end := i + 1
+			for end < len(runes) && runes[end] != closing {
+				end++
+			}
+			if end < len(runes) {
+				tokens = append(tokens, argToken{text: string(runes[i+1 : end]), start: offset(i), quoted: true})
+				i = end + 1
+				continue
+			}
+		}
+
+		end := i
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+		tokens = append(tokens, argToken{text: string(runes[i:end]), start: offset(i)})
+		i = end
+	}
+	return tokens
+}
+
+// Parse matches the text after the command against the spec. Optional arguments only take
+// a word of their kind, so in "/weather new york 3 days" the words argument gets "new york"
+// and the optional number and unit after it get the rest. Words starting with "--" are flags
+// only in the specs that declare some, e.g. a chat prompt may start with one
+func (s ArgSpec) Parse(text string) (Args, error) {
+	tokens := tokenizeArgs(text)
+	args := Args{}
+	var err error
+	hasFlags := s.hasFlags()
+	positional := s.positional()
+	next := 0
+	var words []argToken
+	inWords := false
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+
+		if hasFlags && !t.quoted && strings.HasPrefix(t.text, "--") && len(t.text) > 2 {
+			name, value, hasValue := strings.Cut(t.text[2:], "=")
+			flag, ok := s.flag(strings.ToLower(name))
+			if !ok {
+				return nil, argError("args.unknown_flag", name)
+			}
+			switch {
+			case hasValue:
+			case flag.Kind == BoolArg:
+				value = "true"
+			case i+1 < len(tokens):
+				i++
+				value = tokens[i].text
+			default:
+				return nil, argError("args.flag_value", flag.Name)
+			}
+			if args[flag.Name], err = flag.value(value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if inWords {
+			words = append(words, t)
+			continue
+		}
+
+		for {
+			if next == len(positional) {
+				return nil, argError("args.unexpected", t.text)
+			}
+			a := positional[next]
+			if a.Rest {
+				args[a.Name] = strings.TrimSpace(text[t.start:])
+				return args, s.checkMissing(args)
+			}
+			if a.Words {
+				inWords = true
+				words = append(words, t)
+				break
+			}
+
+			if a.Optional && !a.accepts(t.text) {
+				next++
+				continue
+			}
+			v, err := a.value(t.text)
+			if err != nil {
+				return nil, err
+			}
+			args[a.Name] = v
+			next++
+			break
+		}
+	}
+
+	if inWords {
+		if err := s.assignWords(args, positional[next:], words); err != nil {
+			return nil, err
+		}
+	}
+	return args, s.checkMissing(args)
+}
+
+// assignWords fills the arguments after the words argument from the last word backwards,
+// the words argument gets what is left but at least one word unless it is optional
+func (s ArgSpec) assignWords(args Args, positional []Arg, words []argToken) error {
+	wordsArg, after := positional[0], positional[1:]
+	keep := 1
+	if wordsArg.Optional {
+		keep = 0
+	}
+
+	for i := len(after) - 1; i >= 0; i-- {
+		a := after[i]
+		if len(words) <= keep {
+			break
+		}
+		word := words[len(words)-1].text
+		if a.Optional && !a.accepts(word) {
+			continue
+		}
+		v, err := a.value(word)
+		if err != nil {
+			return err
+		}
+		args[a.Name] = v
+		words = words[:len(words)-1]
+	}
+
+	if len(words) > 0 {
+		parts := make([]string, len(words))
+		for i, w := range words {
+			parts[i] = w.text
+		}
+		args[wordsArg.Name] = strings.Join(parts, " ")
+	}
+	return nil
+}
+
+func (s ArgSpec) checkMissing(args Args) error {
+	for _, a := range s.positional() {
+		if !a.Optional && !args.Has(a.Name) {
+			return argError("args.missing", a.usage())
+		}
+	}
+	return nil
+}
+
+// /////////////////////////////////////////////////////////////////////////////
+// Passing the parsed arguments to the handlers
+// /////////////////////////////////////////////////////////////////////////////
+
+type argsContextKey struct{}
+
+// commandArgs returns the arguments parsed by argsMiddleware
+func commandArgs(ctx context.Context) Args {
+	args, _ := ctx.Value(argsContextKey{}).(Args)
+	if args == nil {
+		return Args{}
+	}
+	return args
+}
+
+// argsMiddleware parses the command arguments and answers with the error and the usage
+// instead of calling the handler when they do not match the spec
+func argsMiddleware(b *Bot, c *Command, handler telegramBot.HandlerFunc) telegramBot.HandlerFunc {
+	return func(ctx context.Context, bot *telegramBot.Bot, update *telegramBotModels.Update) {
+		args, err := c.Args.Parse(commandPayload(update.Message.Text))
+		if err != nil {
+			l := b.updateLocale(ctx, update)
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("args.error", localizeError(err, l), c.usage()),
+			})
+			return
+		}
+		handler(context.WithValue(ctx, argsContextKey{}, args), bot, update)
+	}
+}
@@ -0,0 +1,214 @@
+package botapi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+var testWeatherArgs = ArgSpec{
+	{Name: "city", Words: true},
+	{Name: "N", Kind: IntArg, Optional: true, Min: 1},
+	{Name: "unit", Kind: EnumArg, Optional: true, Values: []string{"days", "hours"}},
+	{Name: "hours", Kind: IntArg, Flag: true, Min: 1, Max: 12},
+	{Name: "chart", Kind: BoolArg, Flag: true},
+}
+
+func TestArgSpec_Parse(t *testing.T) {
+	settingsArgs := ArgSpec{
+		{Name: "scope", Kind: EnumArg, Optional: true, Values: []string{"chat"}},
+		{Name: "prompt", Rest: true},
+	}
+	budgetArgs := ArgSpec{
+		{Name: "user_id", Kind: IntArg, Min: 1},
+		{Name: "limits", Rest: true, Optional: true},
+	}
+
+	tests := []struct {
+		name    string
+		spec    ArgSpec
+		text    string
+		want    Args
+		wantErr string
+	}{
+		{
+			name: "Multi-word city",
+			spec: testWeatherArgs,
+			text: "rio de janeiro 5 days",
+			want: Args{"city": "rio de janeiro", "N": "5", "unit": "days"},
+		},
+		{
+			name: "Quoted city and a unit",
+			spec: testWeatherArgs,
+			text: `"new york" 12 HOURS`,
+			want: Args{"city": "new york", "N": "12", "unit": "hours"},
+		},
+		{
+			name: "A prefix of a unit is a part of the city",
+			spec: testWeatherArgs,
+			text: "ban hou 3",
+			want: Args{"city": "ban hou", "N": "3"},
+		},
+		{
+			name: "Typographic quotes",
+			spec: testWeatherArgs,
+			text: "“New York”",
+			want: Args{"city": "New York"},
+		},
+		{
+			name: "City only",
+			spec: testWeatherArgs,
+			text: "berlin",
+			want: Args{"city": "berlin"},
+		},
+		{
+			name: "A number is the city when nothing else is left",
+			spec: testWeatherArgs,
+			text: "3",
+			want: Args{"city": "3"},
+		},
+		{
+			name: "Flags",
+			spec: testWeatherArgs,
+			text: "new york --hours 6 --chart",
+			want: Args{"city": "new york", "hours": "6", "chart": "true"},
+		},
+		{
+			name: "Flag with a value after =",
+			spec: testWeatherArgs,
+			text: "--HOURS=3 paris --chart=no",
+			want: Args{"city": "paris", "hours": "3", "chart": "false"},
+		},
+		{
+			name:    "Flag out of range",
+			spec:    testWeatherArgs,
+			text:    "paris --hours 24",
+			wantErr: "--hours must be from 1 to 12",
+		},
+		{
+			name:    "Unknown flag",
+			spec:    testWeatherArgs,
+			text:    "paris --weeks 2",
+			wantErr: "unknown flag --weeks",
+		},
+		{
+			name:    "Flag without a value",
+			spec:    testWeatherArgs,
+			text:    "paris --hours",
+			wantErr: "--hours needs a value",
+		},
+		{
+			name:    "Missing city",
+			spec:    testWeatherArgs,
+			text:    "",
+			wantErr: "missing <city...>",
+		},
+		{
+			name:    "Number out of range",
+			spec:    testWeatherArgs,
+			text:    "paris 0 days",
+			wantErr: "[N] must be at least 1",
+		},
+		{
+			name: "Rest keeps the text as it is",
+			spec: settingsArgs,
+			text: "chat You are a pirate.\n\n  Say \"arr\" a lot --loud",
+			want: Args{"scope": "chat", "prompt": "You are a pirate.\n\n  Say \"arr\" a lot --loud"},
+		},
+		{
+			name: "Rest starting with a dash is not a flag",
+			spec: ArgSpec{{Name: "prompt", Rest: true}},
+			text: "--verbose explain flags",
+			want: Args{"prompt": "--verbose explain flags"},
+		},
+		{
+			name: "Optional argument is skipped",
+			spec: settingsArgs,
+			text: "chatty and brief",
+			want: Args{"prompt": "chatty and brief"},
+		},
+		{
+			name: "Unclosed quote is a part of the word",
+			spec: settingsArgs,
+			text: `what does "hello mean`,
+			want: Args{"prompt": `what does "hello mean`},
+		},
+		{
+			name:    "Missing rest",
+			spec:    settingsArgs,
+			text:    "chat",
+			wantErr: "missing <prompt...>",
+		},
+		{
+			name: "Number and optional rest",
+			spec: budgetArgs,
+			text: "42 daily=1000 monthly=20000",
+			want: Args{"user_id": "42", "limits": "daily=1000 monthly=20000"},
+		},
+		{
+			name:    "Not a number",
+			spec:    budgetArgs,
+			text:    "bob reset",
+			wantErr: `<user_id> must be a number, got "bob"`,
+		},
+		{
+			name:    "Unexpected argument",
+			spec:    ArgSpec{{Name: "user_id", Kind: IntArg}},
+			text:    "42 43",
+			wantErr: `unexpected argument "43"`,
+		},
+		{
+			name:    "Enum value",
+			spec:    ArgSpec{{Name: "scope", Kind: EnumArg, Values: []string{"all", "mine"}}},
+			text:    "al",
+			wantErr: `<all|mine> must be one of all, mine, got "al"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.spec.Parse(tt.text)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestArgSpec_Usage(t *testing.T) {
+	assert.Equal(t, "<city...> [N] [days|hours] [--hours N] [--chart]", testWeatherArgs.Usage())
+	assert.Equal(t, "[chat] <prompt|reset>", ArgSpec{
+		{Name: "scope", Kind: EnumArg, Optional: true, Values: []string{"chat"}},
+		{Name: "prompt", Rest: true, Placeholder: "prompt|reset"},
+	}.Usage())
+}
+
+func TestArgSpec_Validate(t *testing.T) {
+	assert.NoError(t, testWeatherArgs.validate())
+	assert.Error(t, ArgSpec{{Name: "a", Words: true}, {Name: "b", Rest: true}}.validate())
+	assert.Error(t, ArgSpec{{Name: "a", Rest: true}, {Name: "b"}}.validate())
+	assert.Error(t, ArgSpec{{Name: "a", Kind: BoolArg}}.validate())
+	assert.Error(t, ArgSpec{{Name: "a", Kind: EnumArg}}.validate())
+}
+
+func TestArgs(t *testing.T) {
+	args := Args{"N": "5", "user_id": "1234567890123", "chart": "true"}
+	assert.Equal(t, 5, args.Int("N"))
+	assert.Equal(t, int64(1234567890123), args.Int64("user_id"))
+	assert.True(t, args.Bool("chart"))
+	assert.False(t, args.Has("city"))
+	assert.Equal(t, 0, args.Int("hours"))
+}
+
+func TestLocalizeError(t *testing.T) {
+	_, err := testWeatherArgs.Parse("")
+	assert.EqualError(t, err, "missing <city...>")
+	assert.Equal(t, "<city...> fehlt", localizeError(err, i18n.For("de")))
+	assert.Equal(t, "boom", localizeError(errors.New("boom"), i18n.For("de")))
+}
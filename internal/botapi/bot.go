@@ -15,10 +15,10 @@ import (
 	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
 )
 
+const defaultLocationCacheSize = 512
+
 type BotTokensConfig struct {
-	TelegramAPIKey    string
-	OpenAIAPIKey      string
-	AccuWeatherAPIKey string
+	TelegramAPIKey string
 }
 
 type BotWebhookConfig struct {
@@ -28,13 +28,23 @@ type BotWebhookConfig struct {
 
 type Bot struct {
 	bot           *telegramBot.Bot
+	botID         int64
+	username      string
 	tokensConfig  *BotTokensConfig
 	webhookConfig *BotWebhookConfig
 	adminID       int64
 	handlers      map[string]string
-	fetchers      map[string]fetch.Fetchable
+	fetchers      map[string]any
+	breakers      []*fetch.CircuitBreaker
+	locations     *fetch.LocationCache
+	picks         *locationPicks
+	scheduler     *scheduler
+	alerts        *alertPoller
 	logger        *zerolog.Logger
 	db            *database.Database
+
+	// accuWeatherQuota is shared by the fetchers using the AccuWeather API key
+	accuWeatherQuota *fetch.Quota
 }
 
 func InitBot(envfile string) (*Bot, error) {
@@ -54,9 +64,7 @@ func InitBot(envfile string) (*Bot, error) {
 	}
 
 	tokensConfig := &BotTokensConfig{
-		TelegramAPIKey:    os.Getenv("TELEGRAM_API_KEY"),
-		OpenAIAPIKey:      os.Getenv("OPEN_AI_API_KEY"),
-		AccuWeatherAPIKey: os.Getenv("ACCU_WEATHER_API_KEY"),
+		TelegramAPIKey: os.Getenv("TELEGRAM_API_KEY"),
 	}
 
 	adminID, err := strconv.ParseInt(os.Getenv("ADMIN_ID"), 10, 64)
@@ -90,15 +98,27 @@ func InitBot(envfile string) (*Bot, error) {
 		return nil, err
 	}
 
+	me, err := tBot.GetMe(context.Background())
+	if err != nil {
+		logger.Fatal().Err(err).Msg("error getting the telegram bot user")
+		return nil, err
+	}
+
 	bot := &Bot{
 		bot:           tBot,
+		botID:         me.ID,
+		username:      me.Username,
 		tokensConfig:  tokensConfig,
 		webhookConfig: webhookCfg,
 		adminID:       adminID,
 		handlers:      make(map[string]string),
-		fetchers:      make(map[string]fetch.Fetchable),
+		fetchers:      make(map[string]any),
 		logger:        &logger,
 		db:            db,
+		locations:     fetch.NewLocationCache(&locationStore{db: db}, envInt("LOCATION_CACHE_SIZE", defaultLocationCacheSize)),
+		picks:         newLocationPicks(),
+
+		accuWeatherQuota: fetch.NewQuota(),
 	}
 
 	if err := bot.setFetchers(); err != nil {
@@ -107,11 +127,18 @@ func InitBot(envfile string) (*Bot, error) {
 	}
 
 	bot.setHandlers()
+	bot.scheduler = newScheduler(bot)
+	bot.alerts = newAlertPoller(bot)
 
 	return bot, nil
 }
 
 func (b *Bot) Run(ctx context.Context) {
+	go b.scheduler.run(ctx)
+	if b.alerts != nil {
+		go b.alerts.run(ctx)
+	}
+
 	if b.webhookConfig != nil {
 		if err := b.runWebhook(ctx); err == nil {
 			return
@@ -147,34 +174,6 @@ func (b *Bot) runWebhook(ctx context.Context) error {
 	return nil
 }
 
-func (b *Bot) setFetchers() error {
-	// TODO: add more fetchers later
-	if b.tokensConfig.AccuWeatherAPIKey != "" {
-		weatherFetcher := &fetch.WeatherFetcher{}
-		if err := weatherFetcher.Set(b.tokensConfig.AccuWeatherAPIKey, b.logger); err != nil {
-			return err
-		}
-		b.fetchers["weather"] = weatherFetcher
-	}
-
-	if b.tokensConfig.OpenAIAPIKey != "" {
-		chatFetcher := &fetch.ChatFetcher{}
-		if err := chatFetcher.Set(b.tokensConfig.OpenAIAPIKey, b.logger); err != nil {
-			return err
-		}
-		b.fetchers["chat"] = chatFetcher
-	}
-	return nil
-}
-
-func (b *Bot) setHandlers() {
-	b.handlers["help"] = b.bot.RegisterHandler(telegramBot.HandlerTypeMessageText, "/help", telegramBot.MatchTypeExact, authorizationMiddleware(b, helpHandler, RegularUser))
-	b.handlers["weather"] = b.bot.RegisterHandler(telegramBot.HandlerTypeMessageText, "/weather", telegramBot.MatchTypePrefix, authorizationMiddleware(b, weatherHandlerClosure(b), PromotedUser))
-	b.handlers["chat"] = b.bot.RegisterHandler(telegramBot.HandlerTypeMessageText, "/chat", telegramBot.MatchTypePrefix, authorizationMiddleware(b, chatHandlerClosure(b), PromotedUser))
-	b.handlers["getid"] = b.bot.RegisterHandler(telegramBot.HandlerTypeMessageText, "/getid", telegramBot.MatchTypeExact, authorizationMiddleware(b, getIDHandler, RegularUser))
-	b.handlers["allow"] = b.bot.RegisterHandler(telegramBot.HandlerTypeMessageText, "/allow", telegramBot.MatchTypePrefix, authorizationMiddleware(b, allowHandlerClosure(b), AdminUser))
-}
-
 func (b *Bot) getUserRole(userID int64) UserRole {
 	if userID == b.adminID {
 		return AdminUser
@@ -0,0 +1,264 @@
+package botapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+)
+
+// /////////////////////////////////////////////////////////////////////////////
+// PNG forecast charts drawn with the standard library: temperature curves,
+// precipitation probability bars and the nights shaded
+// /////////////////////////////////////////////////////////////////////////////
+
+const (
+	chartWidth  = 800
+	chartHeight = 400
+	// the labels are drawn at twice the size of the bitmap font
+	chartTextScale = 2
+
+	chartMarginLeft   = 70
+	chartMarginRight  = 60
+	chartMarginTop    = 20
+	chartMarginBottom = 40
+
+	chartLineWidth  = 3
+	chartMarkerSize = 7
+	// at most that many temperature grid lines
+	chartMaxTicks = 6
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartNight      = color.RGBA{0xe4, 0xe8, 0xf2, 0xff}
+	chartGrid       = color.RGBA{0xd0, 0xd0, 0xd0, 0xff}
+	chartAxis       = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	chartLabel      = color.RGBA{0x30, 0x30, 0x30, 0xff}
+	chartRain       = color.RGBA{0x9c, 0xc8, 0xf0, 0xff}
+	chartRainLabel  = color.RGBA{0x40, 0x80, 0xc0, 0xff}
+	chartMaxTemp    = color.RGBA{0xe0, 0x50, 0x30, 0xff}
+	chartMinTemp    = color.RGBA{0x30, 0x70, 0xd0, 0xff}
+)
+
+var errNothingToChart = errors.New("the forecast has no days or hours to chart")
+
+// chartData is the forecast reduced to columns, a day or an hour each
+type chartData struct {
+	labels []string
+	// curves hold a temperature per column in the units of the user, the daily maximum and
+	// minimum or the hourly temperature
+	curves        [][]float64
+	curveColors   []color.RGBA
+	precipitation []float64
+	// night marks the hours after sunset, the days have their night in the right half
+	night      []bool
+	halfNights bool
+}
+
+func newChartData(f *fetch.Forecast, v forecastView) (*chartData, error) {
+	d := &chartData{}
+	switch {
+	case len(f.Daily) > 0:
+		maxTemps := make([]float64, len(f.Daily))
+		minTemps := make([]float64, len(f.Daily))
+		for i, day := range f.Daily {
+			// the bitmap font has Latin letters only, so the weekdays stay English
+			d.labels = append(d.labels, strings.ToUpper(day.Date.Format("Mon 02")))
+			maxTemps[i] = v.temperature(day.MaxTemp)
+			minTemps[i] = v.temperature(day.MinTemp)
+			d.precipitation = append(d.precipitation, day.PrecipitationProbability)
+		}
+		d.curves = [][]float64{maxTemps, minTemps}
+		d.curveColors = []color.RGBA{chartMaxTemp, chartMinTemp}
+		d.halfNights = true
+	case len(f.Hourly) > 0:
+		temps := make([]float64, len(f.Hourly))
+		for i, hour := range f.Hourly {
+			d.labels = append(d.labels, v.localTime(hour.Time).Format("15:04"))
+			temps[i] = v.temperature(hour.Temp)
+			d.precipitation = append(d.precipitation, hour.PrecipitationProbability)
+			d.night = append(d.night, !hour.IsDaylight)
+		}
+		d.curves = [][]float64{temps}
+		d.curveColors = []color.RGBA{chartMaxTemp}
+	default:
+		return nil, errNothingToChart
+	}
+	return d, nil
+}
+
+// chartScale maps the temperatures to the plot, the range is widened to whole steps of
+// 1, 2, 5, 10... degrees with at most chartMaxTicks grid lines
+type chartScale struct {
+	min, max, step float64
+}
+
+func newChartScale(curves [][]float64) chartScale {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, curve := range curves {
+		for _, t := range curve {
+			low = math.Min(low, t)
+			high = math.Max(high, t)
+		}
+	}
+
+	for i := 0; ; i++ {
+		step := []float64{1, 2, 5}[i%3] * math.Pow(10, float64(i/3))
+		s := chartScale{min: math.Floor(low/step) * step, max: math.Ceil(high/step) * step, step: step}
+		if s.max == s.min {
+			s.max += step
+		}
+		if (s.max-s.min)/step+1 <= chartMaxTicks {
+			return s
+		}
+	}
+}
+
+// renderForecastChart draws the daily or hourly forecast as a PNG
+func renderForecastChart(f *fetch.Forecast, v forecastView) ([]byte, error) {
+	d, err := newChartData(f, v)
+	if err != nil {
+		return nil, err
+	}
+	img := drawChart(d, v.unit())
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func drawChart(d *chartData, unit string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	fillRect(img, img.Bounds(), chartBackground)
+
+	plot := image.Rect(chartMarginLeft, chartMarginTop, chartWidth-chartMarginRight, chartHeight-chartMarginBottom)
+	columns := len(d.labels)
+	columnWidth := float64(plot.Dx()) / float64(columns)
+	columnX := func(i int) int { return plot.Min.X + int(math.Round(columnWidth*float64(i))) }
+	centerX := func(i int) int { return plot.Min.X + int(math.Round(columnWidth*(float64(i)+0.5))) }
+
+	// nights first, everything else is drawn over them
+	for i := 0; i < columns; i++ {
+		switch {
+		case d.halfNights:
+			fillRect(img, image.Rect(centerX(i), plot.Min.Y, columnX(i+1), plot.Max.Y), chartNight)
+		case d.night[i]:
+			fillRect(img, image.Rect(columnX(i), plot.Min.Y, columnX(i+1), plot.Max.Y), chartNight)
+		}
+	}
+
+	scale := newChartScale(d.curves)
+	tempY := func(t float64) int {
+		return plot.Max.Y - int(math.Round((t-scale.min)/(scale.max-scale.min)*float64(plot.Dy())))
+	}
+	for t := scale.min; t <= scale.max+scale.step/2; t += scale.step {
+		if t == 0 {
+			// no "-0°C" after a ceil of a negative
+			t = 0
+		}
+		y := tempY(t)
+		fillRect(img, image.Rect(plot.Min.X, y, plot.Max.X, y+1), chartGrid)
+		label := fmt.Sprintf("%.0f%s", t, unit)
+		drawText(img, plot.Min.X-8-textWidth(label, chartTextScale), y-glyphHeight*chartTextScale/2, label, chartTextScale, chartLabel)
+	}
+
+	// precipitation probabilities as bars against the right axis
+	barWidth := int(math.Max(2, columnWidth/2))
+	for i, p := range d.precipitation {
+		if p <= 0 {
+			continue
+		}
+		top := plot.Max.Y - int(math.Round(math.Min(p, 100)/100*float64(plot.Dy())))
+		fillRect(img, image.Rect(centerX(i)-barWidth/2, top, centerX(i)-barWidth/2+barWidth, plot.Max.Y), chartRain)
+	}
+	for _, p := range []int{0, 50, 100} {
+		label := fmt.Sprintf("%d%%", p)
+		y := plot.Max.Y - p*plot.Dy()/100
+		drawText(img, plot.Max.X+8, y-glyphHeight*chartTextScale/2, label, chartTextScale, chartRainLabel)
+	}
+
+	for c, curve := range d.curves {
+		for i := 1; i < len(curve); i++ {
+			drawLine(img, centerX(i-1), tempY(curve[i-1]), centerX(i), tempY(curve[i]), chartLineWidth, d.curveColors[c])
+		}
+		for i, t := range curve {
+			x, y := centerX(i), tempY(t)
+			fillRect(img, image.Rect(x-chartMarkerSize/2, y-chartMarkerSize/2, x+chartMarkerSize/2+1, y+chartMarkerSize/2+1), d.curveColors[c])
+		}
+	}
+
+	fillRect(img, image.Rect(plot.Min.X, plot.Min.Y, plot.Min.X+1, plot.Max.Y), chartAxis)
+	fillRect(img, image.Rect(plot.Min.X, plot.Max.Y, plot.Max.X, plot.Max.Y+1), chartAxis)
+
+	// label every column that has the room, the first one always
+	labelWidth := 0
+	for _, label := range d.labels {
+		labelWidth = max(labelWidth, textWidth(label, chartTextScale))
+	}
+	every := int(math.Ceil(float64(labelWidth+10) / columnWidth))
+	for i := 0; i < columns; i += every {
+		label := d.labels[i]
+		drawText(img, centerX(i)-textWidth(label, chartTextScale)/2, plot.Max.Y+10, label, chartTextScale, chartLabel)
+	}
+	return img
+}
+
+func fillRect(img draw.Image, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// drawLine draws a line of the width by stamping squares along it
+func drawLine(img draw.Image, x0, y0, x1, y1, width int, c color.Color) {
+	steps := max(abs(x1-x0), abs(y1-y0), 1)
+	for i := 0; i <= steps; i++ {
+		x := x0 + (x1-x0)*i/steps
+		y := y0 + (y1-y0)*i/steps
+		fillRect(img, image.Rect(x-width/2, y-width/2, x-width/2+width, y-width/2+width), c)
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// renderChartCaption sums the chart up in a plain text line or two, the photo captions are short
+func renderChartCaption(f *fetch.Forecast, v forecastView) string {
+	low, high := math.Inf(1), math.Inf(-1)
+	period := ""
+	if len(f.Daily) > 0 {
+		for _, day := range f.Daily {
+			low = math.Min(low, day.MinTemp)
+			high = math.Max(high, day.MaxTemp)
+		}
+		period = v.Locale.N("forecast.days", len(f.Daily))
+	} else {
+		for _, hour := range f.Hourly {
+			low = math.Min(low, hour.Temp)
+			high = math.Max(high, hour.Temp)
+		}
+		period = v.Locale.N("forecast.hours", len(f.Hourly))
+	}
+
+	var r strings.Builder
+	if f.Location != "" {
+		r.WriteString(f.Location + ": ")
+	}
+	r.WriteString(fmt.Sprintf("%s, %.0f…%.0f%s", period, v.temperature(low), v.temperature(high), v.unit()))
+	if f.Source != "" {
+		r.WriteString("\n" + v.source(f))
+	}
+	return r.String()
+}
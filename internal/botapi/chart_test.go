@@ -0,0 +1,79 @@
+package botapi
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+func TestRenderForecastChart(t *testing.T) {
+	hourly := &fetch.Forecast{
+		Source: "Open-Meteo",
+		Hourly: []fetch.HourlyForecast{
+			{Time: time.Date(2024, 3, 18, 23, 0, 0, 0, time.UTC), Temp: 5.25, PrecipitationProbability: 80},
+			{Time: time.Date(2024, 3, 19, 10, 0, 0, 0, time.UTC), Temp: 4.9, IsDaylight: true},
+		},
+	}
+	data, err := renderForecastChart(hourly, forecastView{})
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	assert.Equal(t, chartWidth, img.Bounds().Dx())
+	assert.Equal(t, chartHeight, img.Bounds().Dy())
+	rgba := func(x, y int) color.RGBA { return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA) }
+	// the first hour is at night with an 80% bar, the second one is in the daylight
+	assert.Equal(t, chartNight, rgba(80, 30))
+	assert.Equal(t, chartRain, rgba(160, 350))
+	assert.Equal(t, chartBackground, rgba(600, 30))
+
+	daily := &fetch.Forecast{Daily: []fetch.DailyForecast{
+		{Date: time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC), MinTemp: -3, MaxTemp: 4},
+		{Date: time.Date(2024, 3, 19, 0, 0, 0, 0, time.UTC), MinTemp: -1, MaxTemp: 8, PrecipitationProbability: 40},
+	}}
+	data, err = renderForecastChart(daily, forecastView{Imperial: true})
+	require.NoError(t, err)
+	_, err = png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	_, err = renderForecastChart(&fetch.Forecast{}, forecastView{})
+	assert.ErrorIs(t, err, errNothingToChart)
+}
+
+func TestNewChartScale(t *testing.T) {
+	assert.Equal(t, chartScale{min: 4, max: 6, step: 1}, newChartScale([][]float64{{5.25, 4.9}}))
+	assert.Equal(t, chartScale{min: -5, max: 15, step: 5}, newChartScale([][]float64{{-3, 4}, {-1, 12.5}}))
+	assert.Equal(t, chartScale{min: 20, max: 21, step: 1}, newChartScale([][]float64{{20}}))
+}
+
+func TestRenderChartCaption(t *testing.T) {
+	daily := &fetch.Forecast{
+		Source:   "AccuWeather",
+		Location: "Berlin, DE",
+		Daily: []fetch.DailyForecast{
+			{MinTemp: 3.6, MaxTemp: 12.2},
+			{MinTemp: 1.2, MaxTemp: 9},
+		},
+	}
+	assert.Equal(t, "Berlin, DE: 2 days, 1…12°C\nSource: AccuWeather", renderChartCaption(daily, forecastView{}))
+
+	hourly := &fetch.Forecast{Hourly: []fetch.HourlyForecast{{Temp: 5}}}
+	assert.Equal(t, "1 hour, 41…41°F", renderChartCaption(hourly, forecastView{Imperial: true}))
+	assert.Equal(t, "Berlin, DE: 2 дня, 1…12°C\nИсточник: AccuWeather", renderChartCaption(daily, forecastView{Locale: i18n.For("ru")}))
+}
+
+func TestTextWidth(t *testing.T) {
+	assert.Equal(t, 0, textWidth("", 2))
+	assert.Equal(t, 5, textWidth("1", 1))
+	assert.Equal(t, 22, textWidth("12", 2))
+	// runes, not bytes
+	assert.Equal(t, 11, textWidth("5°", 1))
+}
@@ -0,0 +1,250 @@
+package botapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+)
+
+const maxWatchedLocationsPerUser = 5
+
+func init() {
+	registerFetcher(&FetcherSpec{
+		Name:   "alerts",
+		EnvKey: "ACCU_WEATHER_API_KEY",
+		New:    newAlertsFetcher,
+	})
+	registerCommand(&Command{
+		Name:    "watch",
+		MinRole: PromotedUser,
+		Args: ArgSpec{
+			{Name: "city", Words: true, Optional: true},
+		},
+		Help:     "help.watch",
+		Fetchers: []string{"alerts"},
+		Handler:  watchHandlerClosure,
+	})
+	registerCommand(&Command{
+		Name:    "watches",
+		MinRole: PromotedUser,
+		Help:    "help.watches",
+		Handler: watchesHandlerClosure,
+	})
+	registerCommand(&Command{
+		Name:    "unwatch",
+		MinRole: PromotedUser,
+		Args: ArgSpec{
+			{Name: "id", Placeholder: "id|all"},
+		},
+		Help:    "help.unwatch",
+		Handler: unwatchHandlerClosure,
+	})
+}
+
+// newAlertsFetcher polls AccuWeather with its own retries and circuit breaker, it shares the
+// location cache and the quota with the AccuWeather forecasts
+func newAlertsFetcher(b *Bot, apiKey string) (any, error) {
+	af := &fetch.AccuWeatherAlertsFetcher{}
+	af.SetBaseURL(os.Getenv("ACCU_WEATHER_BASE_URL"))
+	af.SetLocationCache(b.locations)
+	af.SetQuota(b.accuWeatherQuota)
+
+	rf := newResilientFetcher[fetch.AlertsQuery, []fetch.Alert](b, "alerts", af, true)
+	if err := rf.Set(apiKey, b.logger); err != nil {
+		return nil, err
+	}
+	return fetch.Fetchable[fetch.AlertsQuery, []fetch.Alert](rf), nil
+}
+
+func watchHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		af := getFetcher[fetch.Fetchable[fetch.AlertsQuery, []fetch.Alert]](b, "alerts")
+		userID := update.Message.From.ID
+		chatID := update.Message.Chat.ID
+
+		q, ok := b.cityQuery(ctx, update, commandArgs(ctx).String("city"))
+		if !ok {
+			return
+		}
+		key := alertLocationKey(q.City, q.Location)
+		l := b.userLocale(ctx, userID, q.Language)
+
+		existing, err := b.db.ListWatchedLocations(ctx, userID)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to list watched locations")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: chatID,
+				Text:   l.T("watch.failed"),
+			})
+			return
+		}
+		if len(existing) >= maxWatchedLocationsPerUser {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: chatID,
+				Text:   l.N("watch.too_many", len(existing)),
+			})
+			return
+		}
+		for _, w := range existing {
+			if w.ChatID == chatID && fetch.NormalizeCity(w.City) == fetch.NormalizeCity(q.City) {
+				b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+					ChatID: chatID,
+					Text:   l.T("watch.exists", w.City, w.ID),
+				})
+				return
+			}
+		}
+
+		// the current alerts are pushed right away, the poller only sends the later ones
+		fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		alerts, fetchErr := af.Fetch(fetchCtx, fetch.AlertsQuery{City: q.City, Location: q.Location, Language: l.Language()})
+		cancel()
+		if errors.Is(fetchErr, fetch.ErrLocationNotFound) {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: chatID,
+				Text:   l.T("weather.not_found", q.City),
+			})
+			return
+		}
+
+		w := &database.WatchedLocation{UserID: userID, ChatID: chatID, City: q.City, Language: q.Language}
+		if w.ID, err = b.db.AddWatchedLocation(ctx, w); err != nil {
+			b.logger.Error().Err(err).Msg("Failed to add watched location")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: chatID,
+				Text:   l.T("watch.failed"),
+			})
+			return
+		}
+
+		var ambiguous *fetch.AmbiguousLocationError
+		text := l.T("watch.watching", q.City) + fmt.Sprintf(" (#%d)", w.ID)
+		switch {
+		case errors.As(fetchErr, &ambiguous):
+		case fetchErr != nil:
+			b.logger.Error().Err(fetchErr).Msg("Failed to fetch weather alerts")
+			text += ", " + l.T("watch.alerts_later")
+		case len(alerts) == 0:
+			text += ", " + l.T("watch.no_alerts")
+		}
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: chatID,
+			Text:   text,
+		})
+
+		if ambiguous != nil {
+			b.askLocation(ctx, chatID, &locationPick{
+				userID:     userID,
+				query:      q,
+				purpose:    pickWatch,
+				candidates: ambiguous.Candidates,
+			}, nil)
+			return
+		}
+		if fetchErr == nil {
+			b.notifyAlerts(ctx, chatID, key, alerts, l)
+		}
+	}
+}
+
+// sendWatchedAlerts confirms the place picked for a new watch and pushes its current alerts,
+// the poller finds the place by the saved choice from now on
+func (b *Bot) sendWatchedAlerts(ctx context.Context, userID, chatID int64, q fetch.WeatherQuery) {
+	af := getFetcher[fetch.Fetchable[fetch.AlertsQuery, []fetch.Alert]](b, "alerts")
+	if af == nil {
+		return
+	}
+	l := b.userLocale(ctx, userID, q.Language)
+
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	alerts, err := af.Fetch(fetchCtx, fetch.AlertsQuery{City: q.City, Location: q.Location, Language: l.Language()})
+	cancel()
+
+	text := l.T("watch.watching", q.Location.Label())
+	switch {
+	case err != nil:
+		b.logger.Error().Err(err).Msg("Failed to fetch weather alerts")
+		text += ", " + l.T("watch.alerts_later")
+	case len(alerts) == 0:
+		text += ", " + l.T("watch.no_alerts")
+	}
+	b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+		ChatID: chatID,
+		Text:   text,
+	})
+
+	if err == nil {
+		b.notifyAlerts(ctx, chatID, alertLocationKey(q.City, q.Location), alerts, l)
+	}
+}
+
+func watchesHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		l := b.updateLocale(ctx, update)
+		watches, err := b.db.ListWatchedLocations(ctx, update.Message.From.ID)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to list watched locations")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("watch.list_failed"),
+			})
+			return
+		}
+
+		if len(watches) == 0 {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("watch.none"),
+			})
+			return
+		}
+
+		var r strings.Builder
+		r.WriteString(l.T("watch.list"))
+		for _, w := range watches {
+			r.WriteString("\n" + l.T("watch.line", w.ID, w.City, w.CreatedAt.Format("2006-01-02")))
+		}
+		b.sendText(ctx, update.Message.Chat.ID, r.String(), nil, l)
+	}
+}
+
+func unwatchHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		l := b.updateLocale(ctx, update)
+		id, ok := parseIDOrAll(commandArgs(ctx).String("id"))
+		if !ok {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("watch.bad_id"),
+			})
+			return
+		}
+
+		n, err := b.db.DeleteWatchedLocations(ctx, update.Message.From.ID, id)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to delete watched locations")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("watch.unwatch_failed"),
+			})
+			return
+		}
+
+		text := l.N("watch.stopped", int(n))
+		if n == 0 && id != 0 {
+			text = l.T("watch.unknown", id)
+		}
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   text,
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package botapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+const (
+	maxMessageLength          = 4096
+	streamPlaceholder         = "…"
+	streamCursor              = " ▍"
+	defaultStreamEditInterval = 2 * time.Second
+	defaultStreamTimeout      = 3 * time.Minute
+
+	defaultLLMBackend = "openai"
+
+	defaultChatHistoryMaxMessages = 20
+	defaultChatHistoryMaxTokens   = 3000
+	historyPreviewLength          = 200
+)
+
+func init() {
+	registerFetcher(&FetcherSpec{
+		Name: "chat",
+		New:  newChatFetcher,
+	})
+	registerCommand(&Command{
+		Name:     "chat",
+		MinRole:  PromotedUser,
+		Args:     ArgSpec{{Name: "prompt", Rest: true}},
+		Help:     "help.chat",
+		Fetchers: []string{"chat"},
+		Handler:  chatHandlerClosure,
+	})
+	registerCommand(&Command{
+		Name:     "reset",
+		MinRole:  PromotedUser,
+		Help:     "help.reset",
+		Fetchers: []string{"chat"},
+		Handler:  resetHandlerClosure,
+	})
+	registerCommand(&Command{
+		Name:     "history",
+		MinRole:  PromotedUser,
+		Help:     "help.history",
+		Fetchers: []string{"chat"},
+		Handler:  historyHandlerClosure,
+	})
+	registerMessageHandler(&MessageHandler{
+		Name:     "chat-reply",
+		MinRole:  PromotedUser,
+		Fetchers: []string{"chat"},
+		Match:    isReplyToBot,
+		Handler:  chatReplyHandlerClosure,
+	})
+}
+
+// newChatFetcher builds the LLM backend chosen by LLM_BACKEND, each backend reads its own
+// key and base URL, the mock backend echoes the prompt in process for offline runs
+func newChatFetcher(b *Bot, _ string) (any, error) {
+	var backend fetch.ChatBackend
+	apiKey := ""
+	switch name := strings.ToLower(envString("LLM_BACKEND", defaultLLMBackend)); name {
+	case "openai":
+		apiKey = os.Getenv("OPEN_AI_API_KEY")
+		baseURL := os.Getenv("OPEN_AI_BASE_URL")
+		if apiKey == "" && baseURL == "" {
+			b.logger.Warn().Msg("OPEN_AI_API_KEY is not set, openai backend is disabled")
+			return nil, errFetcherDisabled
+		}
+		chatFetcher := &fetch.ChatFetcher{}
+		chatFetcher.SetBaseURL(baseURL)
+		backend = chatFetcher
+	case "anthropic":
+		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			b.logger.Warn().Msg("ANTHROPIC_API_KEY is not set, anthropic backend is disabled")
+			return nil, errFetcherDisabled
+		}
+		anthropicFetcher := &fetch.AnthropicFetcher{}
+		anthropicFetcher.SetBaseURL(os.Getenv("ANTHROPIC_BASE_URL"))
+		backend = anthropicFetcher
+	case "ollama":
+		ollamaFetcher := &fetch.OllamaFetcher{}
+		ollamaFetcher.SetBaseURL(os.Getenv("OLLAMA_BASE_URL"))
+		backend = ollamaFetcher
+	case "mock":
+		b.logger.Warn().Msg("chat uses the mock LLM backend")
+		backend = &fetch.MockChatBackend{}
+	default:
+		return nil, fmt.Errorf("unknown LLM backend %q", name)
+	}
+
+	rf := newResilientFetcher[fetch.ChatQuery, *fetch.ChatCompletion](b, "chat", backend, false)
+	if err := rf.Set(apiKey, b.logger); err != nil {
+		return nil, err
+	}
+	return &streamingChatFetcher{ResilientFetcher: rf, backend: backend}, nil
+}
+
+// streamingChatFetcher adds streaming to the decorated chat fetcher, streams are not retried
+// since a part of the answer is already shown but they go through the circuit breaker
+type streamingChatFetcher struct {
+	*fetch.ResilientFetcher[fetch.ChatQuery, *fetch.ChatCompletion]
+	backend fetch.ChatBackend
+}
+
+func (sf *streamingChatFetcher) Name() string {
+	return sf.backend.Name()
+}
+
+func (sf *streamingChatFetcher) Stream(ctx context.Context, q fetch.ChatQuery, onDelta func(delta string)) (*fetch.ChatCompletion, error) {
+	breaker := sf.Breaker()
+	if err := breaker.Allow(); err != nil {
+		return nil, err
+	}
+	completion, err := sf.backend.Stream(ctx, q, onDelta)
+	breaker.Report(err)
+	return completion, err
+}
+
+// isReplyToBot matches plain text replies to the bot, it runs for every update and so leaves
+// telling the chat answers from the other bot messages such as forecasts to the handler
+func isReplyToBot(b *Bot, update *telegramBotModels.Update) bool {
+	m := update.Message
+	if m == nil || m.From == nil || m.ReplyToMessage == nil || m.ReplyToMessage.From == nil {
+		return false
+	}
+	return m.ReplyToMessage.From.ID == b.botID && m.Text != "" && !strings.HasPrefix(m.Text, "/")
+}
+
+func chatHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		go func() {
+			if err := b.db.LogUserActivity(update.Message.From.ID, update.Message.Text); err != nil {
+				b.logger.Error().Err(err).Msg("Failed to log user activity")
+			}
+		}()
+
+		// an answer may stream for minutes, the other updates must not wait for it
+		go b.converse(ctx, update, commandArgs(ctx).String("prompt"))
+	}
+}
+
+// chatReplyHandlerClosure continues the chat conversation with the replies to the chat answers,
+// the replies to the other bot messages get the default answer
+func chatReplyHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, bot *telegramBot.Bot, update *telegramBotModels.Update) {
+		go func() {
+			m := update.Message
+			ok, err := b.db.IsChatReplyMessage(ctx, m.Chat.ID, m.ReplyToMessage.ID)
+			if err != nil {
+				b.logger.Error().Err(err).Msg("Failed to look up the replied chat message")
+			}
+			if !ok {
+				defaultHandler(ctx, bot, update)
+				return
+			}
+
+			if err := b.db.LogUserActivity(m.From.ID, m.Text); err != nil {
+				b.logger.Error().Err(err).Msg("Failed to log user activity")
+			}
+			b.converse(ctx, update, strings.TrimSpace(m.Text))
+		}()
+	}
+}
+
+// converse sends the prompt together with the chat history and stores the new turn
+func (b *Bot) converse(ctx context.Context, update *telegramBotModels.Update, prompt string) {
+	cf := getFetcher[fetch.Fetchable[fetch.ChatQuery, *fetch.ChatCompletion]](b, "chat")
+	chatID := update.Message.Chat.ID
+	l := b.updateLocale(ctx, update)
+
+	if exceeded := b.chatBudgetExceeded(ctx, update.Message.From.ID, l); exceeded != "" {
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID:          chatID,
+			Text:            l.T("chat.budget_exceeded", exceeded),
+			ReplyParameters: replyTo(update),
+		})
+		return
+	}
+
+	maxMessages := envInt("CHAT_HISTORY_MAX_MESSAGES", defaultChatHistoryMaxMessages)
+	history, err := b.db.GetChatHistory(ctx, chatID, maxMessages)
+	if err != nil {
+		// answering without the context is better than not answering at all
+		b.logger.Error().Err(err).Msg("Failed to load chat history")
+	}
+
+	messages := make([]fetch.Message, 0, len(history)+1)
+	for _, m := range history {
+		messages = append(messages, fetch.Message{Role: m.Role, Content: m.Content})
+	}
+	messages = append(messages, fetch.Message{Role: "user", Content: prompt})
+	messages = fetch.TrimHistory(messages, maxMessages, envInt("CHAT_HISTORY_MAX_TOKENS", defaultChatHistoryMaxTokens))
+
+	q := fetch.ChatQuery{Messages: messages}
+	b.chatOptionsFor(ctx, chatID, update.Message.From.ID, l).apply(&q)
+
+	var completion *fetch.ChatCompletion
+	var messageIDs []int
+	if streamer, ok := cf.(fetch.ChatStreamer); ok && envString("CHAT_STREAMING", "true") == "true" {
+		completion, messageIDs, err = b.streamCompletion(ctx, update, streamer, q, l)
+	} else {
+		completion, messageIDs, err = b.fetchCompletion(ctx, update, cf, q, l)
+	}
+	if completion != nil {
+		// a cancelled request is recorded too, the tokens are spent anyway
+		b.recordChatUsage(context.WithoutCancel(ctx), update, q, completion)
+	}
+	if err != nil {
+		return
+	}
+
+	if err := b.db.AppendChatMessages(ctx,
+		database.ChatMessage{ChatID: chatID, UserID: update.Message.From.ID, Role: "user", Content: prompt},
+		database.ChatMessage{ChatID: chatID, UserID: b.botID, Role: "assistant", Content: completion.Content, MessageIDs: messageIDs},
+	); err != nil {
+		b.logger.Error().Err(err).Msg("Failed to save chat history")
+	}
+}
+
+func replyTo(update *telegramBotModels.Update) *telegramBotModels.ReplyParameters {
+	return &telegramBotModels.ReplyParameters{
+		MessageID:                update.Message.ID,
+		AllowSendingWithoutReply: true,
+	}
+}
+
+// fetchCompletion sends the complete answer at once, it returns the answer and the IDs of the
+// messages it was sent in. When the request fails the answer is nil, or the partial answer
+// with the estimated usage if the backend may have already spent tokens on it
+func (b *Bot) fetchCompletion(ctx context.Context, update *telegramBotModels.Update, cf fetch.Fetchable[fetch.ChatQuery, *fetch.ChatCompletion], q fetch.ChatQuery, l i18n.Localizer) (*fetch.ChatCompletion, []int, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	completion, err := cf.Fetch(fetchCtx, q)
+	if err != nil {
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   l.T("bot.error", err),
+		})
+		return partialCompletion(q, "", err), nil, err
+	}
+
+	// the answer is spent even if a part of it did not make it to the chat
+	messageIDs, _ := b.sendMarkdown(ctx, update.Message.Chat.ID, completion.Content, replyTo(update), l)
+	return completion, messageIDs, nil
+}
+
+// partialCompletion returns the partial answer of a failed request when it reached the backend:
+// some text has been received or the request was cancelled while the backend was answering
+func partialCompletion(q fetch.ChatQuery, text string, err error) *fetch.ChatCompletion {
+	if text == "" && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	return fetch.PartialCompletion(q, text)
+}
+
+// streamCompletion sends a placeholder and edits it while the answer streams in, the edits
+// are made every CHAT_STREAM_EDIT_INTERVAL to stay within the Telegram edit rate limits and
+// apart from reading the stream, so a slow edit does not hold it up.
+// The partial answer is plain text, only the complete one is formatted. The results are the
+// ones of fetchCompletion
+func (b *Bot) streamCompletion(ctx context.Context, update *telegramBotModels.Update, streamer fetch.ChatStreamer, q fetch.ChatQuery, l i18n.Localizer) (*fetch.ChatCompletion, []int, error) {
+	chatID := update.Message.Chat.ID
+	placeholder, err := b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+		ChatID:          chatID,
+		Text:            streamPlaceholder,
+		ReplyParameters: replyTo(update),
+	})
+	if err != nil {
+		b.logger.Error().Err(err).Msg("Failed to send chat placeholder")
+		return nil, nil, err
+	}
+
+	interval := envDuration("CHAT_STREAM_EDIT_INTERVAL", defaultStreamEditInterval)
+	streamCtx, cancel := context.WithTimeout(ctx, envDuration("CHAT_STREAM_TIMEOUT", defaultStreamTimeout))
+	defer cancel()
+
+	// the edits outlive the stream so that a timeout or a shutdown is still shown in the message
+	editCtx := context.WithoutCancel(ctx)
+
+	var mu sync.Mutex
+	var text strings.Builder
+	received := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return text.String()
+	}
+
+	shown := ""
+	edit := func(s string) {
+		if s == shown || s == "" {
+			return
+		}
+		if _, err := b.bot.EditMessageText(editCtx, &telegramBot.EditMessageTextParams{
+			ChatID:    chatID,
+			MessageID: placeholder.ID,
+			Text:      truncateMessage(s),
+		}); err != nil {
+			b.logger.Warn().Err(err).Msg("Failed to edit streamed chat message")
+		}
+		shown = s
+	}
+
+	streamed := make(chan struct{})
+	edited := make(chan struct{})
+	go func() {
+		defer close(edited)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s := received(); s != "" {
+					edit(s + streamCursor)
+				}
+			case <-streamed:
+				return
+			}
+		}
+	}()
+
+	completion, err := streamer.Stream(streamCtx, q, func(delta string) {
+		mu.Lock()
+		text.WriteString(delta)
+		mu.Unlock()
+	})
+	// the last edit comes after the ones of the ticker
+	close(streamed)
+	<-edited
+
+	switch {
+	case err == nil:
+		// the placeholder keeps the first part of a long answer, the rest follows in new messages
+		chunks := splitMessage(completion.Content, maxMessageLength)
+		if err := b.editMarkdown(editCtx, chatID, placeholder.ID, chunks[0]); err != nil {
+			b.logger.Warn().Err(err).Msg("Failed to edit streamed chat message")
+		}
+		rest, _ := b.sendChunks(editCtx, chatID, chunks[1:], nil, richReplies())
+		messageIDs := append([]int{placeholder.ID}, rest...)
+		return completion, messageIDs, nil
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		edit(strings.TrimSpace(received() + "\n\n(" + l.T("chat.cancelled") + ")"))
+	default:
+		edit(strings.TrimSpace(received() + "\n\n" + l.T("bot.error", err)))
+	}
+	return partialCompletion(q, received(), err), nil, err
+}
+
+// truncateMessage keeps the message within the Telegram limit while it is being streamed
+func truncateMessage(s string) string {
+	r := []rune(s)
+	if len(r) <= maxMessageLength {
+		return s
+	}
+	return string(r[:maxMessageLength-1]) + "…"
+}
+
+func resetHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		l := b.updateLocale(ctx, update)
+		n, err := b.db.ResetChatHistory(ctx, update.Message.Chat.ID)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to reset chat history")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("chat.reset_failed"),
+			})
+			return
+		}
+
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   l.N("chat.reset", int(n)),
+		})
+	}
+}
+
+func historyHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		l := b.updateLocale(ctx, update)
+		history, err := b.db.GetChatHistory(ctx, update.Message.Chat.ID, envInt("CHAT_HISTORY_MAX_MESSAGES", defaultChatHistoryMaxMessages))
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to load chat history")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("chat.history_failed"),
+			})
+			return
+		}
+
+		if len(history) == 0 {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("chat.history_empty"),
+			})
+			return
+		}
+
+		var r strings.Builder
+		for _, m := range history {
+			content := []rune(m.Content)
+			if len(content) > historyPreviewLength {
+				content = append(content[:historyPreviewLength], '…')
+			}
+			r.WriteString(fmt.Sprintf("[%s] %s: %s\n", m.CreatedAt.Format("01-02 15:04"), m.Role, string(content)))
+		}
+
+		b.sendText(ctx, update.Message.Chat.ID, r.String(), nil, l)
+	}
+}
@@ -0,0 +1,312 @@
+package botapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+const chatSettingsReset = "reset"
+
+// chatScopeArg switches the settings commands to the chat settings
+var chatScopeArg = Arg{Name: "scope", Kind: EnumArg, Optional: true, Values: []string{database.ChatSettingsScopeChat}}
+
+// defaultChatAllowedModels are used when CHAT_ALLOWED_MODELS is not set, the local
+// backends only offer their default model
+var defaultChatAllowedModels = map[string]string{
+	"openai":    "gpt-3.5-turbo,gpt-4o-mini,gpt-4o:admin",
+	"anthropic": "claude-3-5-haiku-latest,claude-3-5-sonnet-latest:admin",
+}
+
+func init() {
+	registerCommand(&Command{
+		Name:     "model",
+		MinRole:  PromotedUser,
+		Args:     ArgSpec{chatScopeArg, {Name: "model", Optional: true, Placeholder: "model|" + chatSettingsReset}},
+		Help:     "help.model",
+		Fetchers: []string{"chat"},
+		Handler:  modelHandlerClosure,
+	})
+	registerCommand(&Command{
+		Name:     "system",
+		MinRole:  PromotedUser,
+		Args:     ArgSpec{chatScopeArg, {Name: "prompt", Rest: true, Placeholder: "prompt|" + chatSettingsReset}},
+		Help:     "help.system",
+		Fetchers: []string{"chat"},
+		Handler:  systemHandlerClosure,
+	})
+	registerCommand(&Command{
+		Name:    "temperature",
+		MinRole: PromotedUser,
+		Args: ArgSpec{chatScopeArg, {
+			Name:        "temperature",
+			Placeholder: fmt.Sprintf("0..%g|%s", fetch.MaxChatTemperature, chatSettingsReset),
+		}},
+		Help:     "help.temperature",
+		Fetchers: []string{"chat"},
+		Handler:  temperatureHandlerClosure,
+	})
+}
+
+// chatOptions are the effective /chat settings after merging the defaults, the chat and the user settings
+type chatOptions struct {
+	Model        string
+	SystemPrompt string
+	Temperature  *float64
+	MaxTokens    int
+	// Language asks the model to answer in the language of the user, it follows the system prompt
+	Language string
+}
+
+func (o chatOptions) apply(q *fetch.ChatQuery) {
+	q.Model = o.Model
+	q.System = o.SystemPrompt
+	if o.Language != "" {
+		if q.System != "" {
+			q.System += "\n\n"
+		}
+		q.System += o.Language
+	}
+	q.Temperature = o.Temperature
+	q.MaxTokens = o.MaxTokens
+}
+
+// parseAllowedModels parses "model[:role],..." where the role is the minimal role
+// allowed to use the model, models without a role are available to promoted users
+func parseAllowedModels(s string) map[string]UserRole {
+	models := make(map[string]UserRole)
+	for _, entry := range strings.Split(s, ",") {
+		name, role, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if name == "" {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(role)) {
+		case "admin":
+			models[name] = AdminUser
+		case "regular":
+			models[name] = RegularUser
+		default:
+			models[name] = PromotedUser
+		}
+	}
+	return models
+}
+
+func allowedModels() map[string]UserRole {
+	backend := strings.ToLower(envString("LLM_BACKEND", defaultLLMBackend))
+	return parseAllowedModels(envString("CHAT_ALLOWED_MODELS", defaultChatAllowedModels[backend]))
+}
+
+// modelsFor lists the models available to the role in a stable order
+func modelsFor(allowed map[string]UserRole, role UserRole) []string {
+	var models []string
+	for name, minRole := range allowed {
+		if role >= minRole {
+			models = append(models, name)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+func defaultChatOptions() chatOptions {
+	o := chatOptions{
+		// empty means the default model of the backend
+		Model:        envString("CHAT_DEFAULT_MODEL", ""),
+		SystemPrompt: envString("CHAT_DEFAULT_SYSTEM_PROMPT", ""),
+		MaxTokens:    envInt("CHAT_MAX_TOKENS", 0),
+	}
+	if t := envFloat("CHAT_DEFAULT_TEMPERATURE", -1); t >= 0 && t <= fetch.MaxChatTemperature {
+		o.Temperature = &t
+	}
+	return o
+}
+
+// resolveChatOptions layers the settings on top of the defaults, later layers win,
+// a model the role may not use falls back to the default model
+func resolveChatOptions(defaults chatOptions, allowed map[string]UserRole, role UserRole, layers ...*database.ChatSettings) chatOptions {
+	o := defaults
+	for _, s := range layers {
+		if s == nil {
+			continue
+		}
+		if s.Model != nil {
+			o.Model = *s.Model
+		}
+		if s.SystemPrompt != nil {
+			o.SystemPrompt = *s.SystemPrompt
+		}
+		if s.Temperature != nil {
+			o.Temperature = s.Temperature
+		}
+	}
+	if minRole, ok := allowed[o.Model]; !ok || role < minRole {
+		o.Model = defaults.Model
+	}
+	return o
+}
+
+// chatOptionsFor loads the chat and the user settings, failures fall back to the defaults. The
+// model is asked to answer in the language of the locale of the user
+func (b *Bot) chatOptionsFor(ctx context.Context, chatID, userID int64, l i18n.Localizer) chatOptions {
+	var layers []*database.ChatSettings
+	for _, scope := range []struct {
+		name string
+		id   int64
+	}{
+		{database.ChatSettingsScopeChat, chatID},
+		{database.ChatSettingsScopeUser, userID},
+	} {
+		s, err := b.db.GetChatSettings(ctx, scope.name, scope.id)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to load chat settings")
+			continue
+		}
+		layers = append(layers, s)
+	}
+	o := resolveChatOptions(defaultChatOptions(), allowedModels(), b.getUserRole(userID), layers...)
+	o.Language = l.T("chat.language")
+	return o
+}
+
+// settingsScope picks the user or, with the "chat" argument, the chat scope which only
+// admins may change
+func (b *Bot) settingsScope(ctx context.Context, update *telegramBotModels.Update, l i18n.Localizer) (scope string, scopeID int64, ok bool) {
+	if commandArgs(ctx).String("scope") != database.ChatSettingsScopeChat {
+		return database.ChatSettingsScopeUser, update.Message.From.ID, true
+	}
+	if b.getUserRole(update.Message.From.ID) < AdminUser {
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   l.T("chat.settings_admins_only"),
+		})
+		return "", 0, false
+	}
+	return database.ChatSettingsScopeChat, update.Message.Chat.ID, true
+}
+
+// updateChatSettings applies the change to the stored settings of the scope and reports the result
+func (b *Bot) updateChatSettings(ctx context.Context, update *telegramBotModels.Update, l i18n.Localizer, scope string, scopeID int64, change func(s *database.ChatSettings), done string) {
+	s, err := b.db.GetChatSettings(ctx, scope, scopeID)
+	if err == nil {
+		change(s)
+		err = b.db.SaveChatSettings(ctx, scope, scopeID, s)
+	}
+	if err != nil {
+		b.logger.Error().Err(err).Msg("Failed to save chat settings")
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   l.T("settings.save_failed"),
+		})
+		return
+	}
+
+	b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   l.T("chat.settings_done", done, l.T("chat.scope_"+scope)),
+	})
+}
+
+func modelHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		l := b.updateLocale(ctx, update)
+		scope, scopeID, ok := b.settingsScope(ctx, update, l)
+		if !ok {
+			return
+		}
+		arg := commandArgs(ctx).String("model")
+
+		role := b.getUserRole(update.Message.From.ID)
+		allowed := allowedModels()
+
+		if arg == "" {
+			o := b.chatOptionsFor(ctx, update.Message.Chat.ID, update.Message.From.ID, l)
+			temperature := l.T("chat.default")
+			if o.Temperature != nil {
+				temperature = strconv.FormatFloat(*o.Temperature, 'f', -1, 64)
+			}
+			model := o.Model
+			if model == "" {
+				model = l.T("chat.default")
+			}
+			system := o.SystemPrompt
+			if system == "" {
+				system = l.T("chat.none")
+			}
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("chat.options", model, temperature, system, strings.Join(modelsFor(allowed, role), ", ")),
+			})
+			return
+		}
+
+		if arg == chatSettingsReset {
+			b.updateChatSettings(ctx, update, l, scope, scopeID, func(s *database.ChatSettings) { s.Model = nil }, l.T("chat.model_reset"))
+			return
+		}
+
+		if minRole, ok := allowed[arg]; !ok || role < minRole {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("chat.model_unavailable", arg, strings.Join(modelsFor(allowed, role), ", ")),
+			})
+			return
+		}
+
+		b.updateChatSettings(ctx, update, l, scope, scopeID, func(s *database.ChatSettings) { s.Model = &arg }, l.T("chat.model_set", arg))
+	}
+}
+
+func systemHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		l := b.updateLocale(ctx, update)
+		scope, scopeID, ok := b.settingsScope(ctx, update, l)
+		if !ok {
+			return
+		}
+		arg := commandArgs(ctx).String("prompt")
+
+		switch arg {
+		case chatSettingsReset:
+			b.updateChatSettings(ctx, update, l, scope, scopeID, func(s *database.ChatSettings) { s.SystemPrompt = nil }, l.T("chat.system_reset"))
+		default:
+			b.updateChatSettings(ctx, update, l, scope, scopeID, func(s *database.ChatSettings) { s.SystemPrompt = &arg }, l.T("chat.system_set"))
+		}
+	}
+}
+
+func temperatureHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		l := b.updateLocale(ctx, update)
+		scope, scopeID, ok := b.settingsScope(ctx, update, l)
+		if !ok {
+			return
+		}
+		arg := commandArgs(ctx).String("temperature")
+
+		if arg == chatSettingsReset {
+			b.updateChatSettings(ctx, update, l, scope, scopeID, func(s *database.ChatSettings) { s.Temperature = nil }, l.T("chat.temperature_reset"))
+			return
+		}
+
+		t, err := strconv.ParseFloat(arg, 64)
+		if err != nil || t < 0 || t > fetch.MaxChatTemperature {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("chat.bad_temperature", fetch.MaxChatTemperature),
+			})
+			return
+		}
+
+		b.updateChatSettings(ctx, update, l, scope, scopeID, func(s *database.ChatSettings) { s.Temperature = &t }, l.T("chat.temperature_set", t))
+	}
+}
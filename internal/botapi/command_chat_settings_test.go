@@ -0,0 +1,78 @@
+package botapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+)
+
+func TestParseAllowedModels(t *testing.T) {
+	got := parseAllowedModels(" gpt-3.5-turbo, gpt-4o:admin,local:regular,,")
+	assert.Equal(t, map[string]UserRole{
+		"gpt-3.5-turbo": PromotedUser,
+		"gpt-4o":        AdminUser,
+		"local":         RegularUser,
+	}, got)
+	assert.Equal(t, []string{"gpt-3.5-turbo", "local"}, modelsFor(got, PromotedUser))
+}
+
+func TestResolveChatOptions(t *testing.T) {
+	str := func(s string) *string { return &s }
+	temp := func(f float64) *float64 { return &f }
+
+	allowed := parseAllowedModels("gpt-3.5-turbo,gpt-4o:admin")
+	defaults := chatOptions{Model: "gpt-3.5-turbo", SystemPrompt: "be brief", MaxTokens: 500}
+
+	tests := []struct {
+		name   string
+		role   UserRole
+		layers []*database.ChatSettings
+		want   chatOptions
+	}{
+		{
+			name: "defaults",
+			role: PromotedUser,
+			want: defaults,
+		},
+		{
+			name: "user overrides chat",
+			role: AdminUser,
+			layers: []*database.ChatSettings{
+				{Model: str("gpt-4o"), Temperature: temp(0.2)},
+				{SystemPrompt: str("be funny"), Temperature: temp(1.5)},
+			},
+			want: chatOptions{Model: "gpt-4o", SystemPrompt: "be funny", Temperature: temp(1.5), MaxTokens: 500},
+		},
+		{
+			name:   "restricted model falls back to default",
+			role:   PromotedUser,
+			layers: []*database.ChatSettings{nil, {Model: str("gpt-4o")}},
+			want:   defaults,
+		},
+		{
+			name:   "unknown model falls back to default",
+			role:   AdminUser,
+			layers: []*database.ChatSettings{{Model: str("gpt-5")}},
+			want:   defaults,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, resolveChatOptions(defaults, allowed, tt.role, tt.layers...))
+		})
+	}
+}
+
+func TestChatOptionsApply(t *testing.T) {
+	var q fetch.ChatQuery
+	chatOptions{Model: "gpt-4o", SystemPrompt: "be brief", Language: "Reply in German."}.apply(&q)
+	assert.Equal(t, "gpt-4o", q.Model)
+	assert.Equal(t, "be brief\n\nReply in German.", q.System)
+
+	chatOptions{Language: "Reply in German."}.apply(&q)
+	assert.Equal(t, "Reply in German.", q.System)
+}
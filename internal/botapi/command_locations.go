@@ -0,0 +1,89 @@
+package botapi
+
+import (
+	"context"
+	"strings"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+)
+
+const locationsListLimit = 20
+
+func init() {
+	registerCommand(&Command{
+		Name:    "locations",
+		MinRole: AdminUser,
+		Args: ArgSpec{
+			{Name: "action", Kind: EnumArg, Optional: true, Values: []string{"purge"}},
+			{Name: "city", Words: true, Optional: true},
+		},
+		Help:    "help.locations",
+		Handler: locationsHandlerClosure,
+	})
+}
+
+func locationsHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		args := commandArgs(ctx)
+		l := b.updateLocale(ctx, update)
+
+		if args.Has("city") && !args.Has("action") {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("locations.city_without_purge"),
+			})
+			return
+		}
+
+		if args.Has("action") {
+			city := args.String("city")
+			n, err := b.locations.Delete(ctx, city)
+			if err != nil {
+				b.logger.Error().Err(err).Msg("Failed to purge locations")
+				b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+					ChatID: update.Message.Chat.ID,
+					Text:   l.T("locations.purge_failed"),
+				})
+				return
+			}
+
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.N("locations.purged", int(n)),
+			})
+			return
+		}
+
+		total, err := b.db.CountLocations(ctx)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to count locations")
+		}
+		locations, err := b.db.ListLocations(ctx, locationsListLimit)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to list locations")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("locations.list_failed"),
+			})
+			return
+		}
+
+		if len(locations) == 0 {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("locations.empty"),
+			})
+			return
+		}
+
+		var r strings.Builder
+		r.WriteString(l.T("locations.list", len(locations), total))
+		for _, loc := range locations {
+			r.WriteString("\n" + l.T("locations.line",
+				loc.Query, toFetchLocation(&loc).Label(), loc.Key, loc.TimeZone, loc.CreatedAt.Format("2006-01-02 15:04")))
+		}
+
+		b.sendText(ctx, update.Message.Chat.ID, r.String(), nil, l)
+	}
+}
@@ -0,0 +1,45 @@
+package botapi
+
+import (
+	"context"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+)
+
+func init() {
+	registerCommand(&Command{
+		Name:    "now",
+		MinRole: PromotedUser,
+		Args: ArgSpec{
+			{Name: "city", Words: true, Optional: true},
+		},
+		Help:     "help.now",
+		Fetchers: []string{"weather"},
+		Handler:  nowHandlerClosure,
+	})
+}
+
+// nowHandlerClosure answers with the latest observation instead of a forecast, the
+// ambiguous names and the home city are handled like in /weather
+func nowHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		wf := getFetcher[fetch.Fetchable[fetch.WeatherQuery, *fetch.Forecast]](b, "weather")
+
+		go func() {
+			if err := b.db.LogUserActivity(update.Message.From.ID, update.Message.Text); err != nil {
+				b.logger.Error().Err(err).Msg("Failed to log user activity")
+			}
+		}()
+
+		q, ok := b.cityQuery(ctx, update, commandArgs(ctx).String("city"))
+		if !ok {
+			return
+		}
+		q.Current = true
+
+		b.sendForecast(ctx, wf, update.Message.From.ID, update.Message.Chat.ID, q, "", nil)
+	}
+}
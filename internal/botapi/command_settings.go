@@ -0,0 +1,355 @@
+package botapi
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+const (
+	unitsMetric   = "metric"
+	unitsImperial = "imperial"
+
+	outputText  = "text"
+	outputChart = "chart"
+
+	settingUnits    = "units"
+	settingLanguage = "language"
+	settingTimeZone = "timezone"
+	settingHomeCity = "city"
+	settingOutput   = "output"
+	settingReset    = "reset"
+
+	settingsCallbackPrefix = "settings:"
+)
+
+// settingsLanguages are offered in the /settings menu in this order
+var settingsLanguages = []struct {
+	Code string
+	Name string
+}{
+	{"en", "English"},
+	{"de", "Deutsch"},
+	{"ru", "Русский"},
+}
+
+func init() {
+	registerCommand(&Command{
+		Name:    "settings",
+		MinRole: PromotedUser,
+		Args: ArgSpec{
+			{Name: "setting", Kind: EnumArg, Optional: true, Values: []string{settingUnits, settingLanguage, settingTimeZone, settingHomeCity, settingOutput}},
+			{Name: "value", Words: true, Optional: true},
+		},
+		Help:    "help.settings",
+		Handler: settingsHandlerClosure,
+	})
+	registerMessageHandler(&MessageHandler{
+		Name:    "settings-menu",
+		MinRole: PromotedUser,
+		Match:   isSettingsCallback,
+		Handler: settingsCallbackHandlerClosure,
+	})
+}
+
+// userSettings loads the settings of the user, failures fall back to the defaults
+func (b *Bot) userSettings(ctx context.Context, userID int64) *database.UserSettings {
+	s, err := b.db.GetUserSettings(ctx, userID)
+	if err != nil {
+		b.logger.Error().Err(err).Msg("Failed to load user settings")
+		return &database.UserSettings{}
+	}
+	return s
+}
+
+// settingsLocale translates to the language of the settings or else to the language of the
+// Telegram app of the user, e.g. "de-AT", falling back to English
+func settingsLocale(s *database.UserSettings, languageCode string) i18n.Localizer {
+	if s.Language != "" {
+		return i18n.For(s.Language)
+	}
+	return i18n.For(languageCode)
+}
+
+// userLocale is settingsLocale of the saved settings of the user
+func (b *Bot) userLocale(ctx context.Context, userID int64, languageCode string) i18n.Localizer {
+	return settingsLocale(b.userSettings(ctx, userID), languageCode)
+}
+
+// updateLocale is userLocale of the sender of a message or of a callback query
+func (b *Bot) updateLocale(ctx context.Context, update *telegramBotModels.Update) i18n.Localizer {
+	userID, _, ok := updateSender(update)
+	if !ok {
+		return i18n.For(updateLanguageCode(update))
+	}
+	return b.userLocale(ctx, userID, updateLanguageCode(update))
+}
+
+func userOutput(s *database.UserSettings) string {
+	if s.Output == "" {
+		return outputText
+	}
+	return s.Output
+}
+
+func userForecastView(s *database.UserSettings, languageCode string) forecastView {
+	v := forecastView{Imperial: s.Units == unitsImperial, Locale: settingsLocale(s, languageCode)}
+	if s.TimeZone != "" {
+		// the zone was checked when it was saved but the tz database may differ after a restart
+		if tz, err := time.LoadLocation(s.TimeZone); err == nil {
+			v.TimeZone = tz
+		}
+	}
+	return v
+}
+
+func languageName(code string) string {
+	for _, l := range settingsLanguages {
+		if l.Code == code {
+			return l.Name
+		}
+	}
+	return code
+}
+
+// applySetting validates the value and sets it, "reset" restores the default
+func applySetting(s *database.UserSettings, setting, value string) error {
+	value = strings.TrimSpace(value)
+	reset := strings.ToLower(value) == settingReset
+
+	switch setting {
+	case settingUnits:
+		switch v := strings.ToLower(value); {
+		case reset:
+			s.Units = ""
+		case v == unitsMetric || v == unitsImperial:
+			s.Units = v
+		default:
+			return argError("settings.bad_units", unitsMetric, unitsImperial)
+		}
+	case settingLanguage:
+		if reset {
+			s.Language = ""
+			return nil
+		}
+		for _, l := range settingsLanguages {
+			if strings.EqualFold(value, l.Code) || strings.EqualFold(value, l.Name) {
+				s.Language = l.Code
+				return nil
+			}
+		}
+		codes := make([]string, len(settingsLanguages))
+		for i, l := range settingsLanguages {
+			codes[i] = l.Code
+		}
+		return argError("settings.bad_language", strings.Join(codes, ", "))
+	case settingTimeZone:
+		if reset {
+			s.TimeZone = ""
+			return nil
+		}
+		// "Local" would be the zone of the server
+		tz, err := time.LoadLocation(value)
+		if err != nil || value == "" || value == "Local" {
+			return argError("settings.bad_time_zone", value)
+		}
+		s.TimeZone = tz.String()
+	case settingHomeCity:
+		if reset {
+			s.HomeCity = ""
+			return nil
+		}
+		if value == "" {
+			return argError("settings.no_home_city")
+		}
+		s.HomeCity = value
+	case settingOutput:
+		switch v := strings.ToLower(value); {
+		case reset:
+			s.Output = ""
+		case v == outputText || v == outputChart:
+			s.Output = v
+		default:
+			return argError("settings.bad_output", outputText, outputChart)
+		}
+	default:
+		return argError("settings.unknown", setting)
+	}
+	return nil
+}
+
+func renderUserSettings(s *database.UserSettings, l i18n.Localizer) string {
+	units := s.Units
+	if units == "" {
+		units = unitsMetric
+	}
+	timeZone := s.TimeZone
+	if timeZone == "" {
+		timeZone = l.T("settings.time_zone_local")
+	}
+	homeCity := s.HomeCity
+	if homeCity == "" {
+		homeCity = l.T("settings.not_set")
+	}
+	language := languageName(s.Language)
+	if s.Language == "" {
+		language = l.T("settings.language_telegram")
+	}
+
+	return l.T("settings.summary", l.T("settings.units_"+units), language, timeZone, homeCity, l.T("settings.output_"+userOutput(s)))
+}
+
+// settingsKeyboard marks the current units, language and output, the callback data is "settings:<setting>:<value>"
+func settingsKeyboard(s *database.UserSettings, l i18n.Localizer) *telegramBotModels.InlineKeyboardMarkup {
+	button := func(label, setting, value string, selected bool) telegramBotModels.InlineKeyboardButton {
+		if selected {
+			label = "✓ " + label
+		}
+		return telegramBotModels.InlineKeyboardButton{Text: label, CallbackData: settingsCallbackPrefix + setting + ":" + value}
+	}
+
+	imperial := s.Units == unitsImperial
+	units := []telegramBotModels.InlineKeyboardButton{
+		button(l.T("settings.metric_button"), settingUnits, unitsMetric, !imperial),
+		button(l.T("settings.imperial_button"), settingUnits, unitsImperial, imperial),
+	}
+
+	languages := make([]telegramBotModels.InlineKeyboardButton, len(settingsLanguages))
+	for i, l := range settingsLanguages {
+		languages[i] = button(l.Name, settingLanguage, l.Code, l.Code == s.Language)
+	}
+
+	chart := userOutput(s) == outputChart
+	output := []telegramBotModels.InlineKeyboardButton{
+		button(l.T("settings.output_text"), settingOutput, outputText, !chart),
+		button(l.T("settings.output_chart"), settingOutput, outputChart, chart),
+	}
+
+	return &telegramBotModels.InlineKeyboardMarkup{InlineKeyboard: [][]telegramBotModels.InlineKeyboardButton{units, languages, output}}
+}
+
+func settingsHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		userID := update.Message.From.ID
+		languageCode := update.Message.From.LanguageCode
+		args := commandArgs(ctx)
+
+		s, err := b.db.GetUserSettings(ctx, userID)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to load user settings")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   i18n.For(languageCode).T("settings.load_failed"),
+			})
+			return
+		}
+		l := settingsLocale(s, languageCode)
+
+		if args.Has("value") && !args.Has("setting") {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("settings.name_first"),
+			})
+			return
+		}
+
+		if !args.Has("value") {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID:      update.Message.Chat.ID,
+				Text:        renderUserSettings(s, l),
+				ReplyMarkup: settingsKeyboard(s, l),
+			})
+			return
+		}
+
+		if err := applySetting(s, args.String("setting"), args.String("value")); err != nil {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("bot.error", localizeError(err, l)),
+			})
+			return
+		}
+		if err := b.db.SaveUserSettings(ctx, userID, s); err != nil {
+			b.logger.Error().Err(err).Msg("Failed to save user settings")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("settings.save_failed"),
+			})
+			return
+		}
+
+		// a new language applies to this reply already
+		l = settingsLocale(s, languageCode)
+		text := renderUserSettings(s, l)
+		if args.String("setting") == settingTimeZone {
+			moved, err := b.rescheduleSubscriptions(ctx, userID, s)
+			if err != nil {
+				b.logger.Error().Err(err).Msg("Failed to reschedule subscriptions")
+				text += "\n\n" + l.T("settings.subscriptions_failed")
+			} else if moved > 0 {
+				text += "\n\n" + l.N("settings.subscriptions_moved", moved, settingsSubscriptionTimeZone(s))
+			}
+		}
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   text,
+		})
+	}
+}
+
+func isSettingsCallback(_ *Bot, update *telegramBotModels.Update) bool {
+	return update.CallbackQuery != nil && strings.HasPrefix(update.CallbackQuery.Data, settingsCallbackPrefix)
+}
+
+// settingsCallbackHandlerClosure saves the setting picked in the menu of whoever pressed the
+// button and shows the menu with their settings
+func settingsCallbackHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		cq := update.CallbackQuery
+		answer := func(text string) {
+			if _, err := b.bot.AnswerCallbackQuery(ctx, &telegramBot.AnswerCallbackQueryParams{
+				CallbackQueryID: cq.ID,
+				Text:            text,
+			}); err != nil {
+				b.logger.Error().Err(err).Msg("Failed to answer callback query")
+			}
+		}
+
+		setting, value, _ := strings.Cut(strings.TrimPrefix(cq.Data, settingsCallbackPrefix), ":")
+		s, err := b.db.GetUserSettings(ctx, cq.From.ID)
+		if err == nil {
+			if err := applySetting(s, setting, value); err != nil {
+				answer(localizeError(err, settingsLocale(s, cq.From.LanguageCode)))
+				return
+			}
+			err = b.db.SaveUserSettings(ctx, cq.From.ID, s)
+		}
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to save user settings")
+			answer(b.userLocale(ctx, cq.From.ID, cq.From.LanguageCode).T("settings.save_failed"))
+			return
+		}
+		l := settingsLocale(s, cq.From.LanguageCode)
+		answer(l.T("settings.saved"))
+
+		msg := cq.Message.Message
+		if msg == nil {
+			return
+		}
+		if _, err := b.bot.EditMessageText(ctx, &telegramBot.EditMessageTextParams{
+			ChatID:      msg.Chat.ID,
+			MessageID:   msg.ID,
+			Text:        renderUserSettings(s, l),
+			ReplyMarkup: settingsKeyboard(s, l),
+		}); err != nil {
+			// pressing the selected button again leaves the message unchanged
+			b.logger.Debug().Err(err).Msg("Failed to edit settings menu")
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package botapi
+
+import (
+	"testing"
+
+	telegramBotModels "github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+)
+
+func TestApplySetting(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  database.UserSettings
+		setting string
+		value   string
+		want    database.UserSettings
+		wantErr string
+	}{
+		{name: "Units", setting: "units", value: "Imperial", want: database.UserSettings{Units: "imperial"}},
+		{name: "Unknown units", setting: "units", value: "kelvin", wantErr: "units must be metric or imperial"},
+		{name: "Language by code", setting: "language", value: "DE", want: database.UserSettings{Language: "de"}},
+		{name: "Language by name", setting: "language", value: "русский", want: database.UserSettings{Language: "ru"}},
+		{name: "Unknown language", setting: "language", value: "fr", wantErr: "language must be one of en, de, ru"},
+		{name: "Time zone", setting: "timezone", value: "Europe/Berlin", want: database.UserSettings{TimeZone: "Europe/Berlin"}},
+		{name: "Server time zone", setting: "timezone", value: "Local", wantErr: `unknown time zone "Local", use a name like Europe/Berlin or UTC`},
+		{name: "Unknown time zone", setting: "timezone", value: "Mars/Olympus", wantErr: `unknown time zone "Mars/Olympus", use a name like Europe/Berlin or UTC`},
+		{name: "Home city", setting: "city", value: " new york ", want: database.UserSettings{HomeCity: "new york"}},
+		{name: "Output", setting: "output", value: "Chart", want: database.UserSettings{Output: "chart"}},
+		{name: "Unknown output", setting: "output", value: "pdf", wantErr: "output must be text or chart"},
+		{name: "Reset", before: database.UserSettings{Units: "imperial"}, setting: "units", value: "reset", want: database.UserSettings{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &tt.before
+			err := applySetting(s, tt.setting, tt.value)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, *s)
+			}
+		})
+	}
+}
+
+func TestSettingsKeyboard(t *testing.T) {
+	s := &database.UserSettings{Units: unitsImperial, Language: "de", Output: outputChart}
+	keyboard := settingsKeyboard(s, settingsLocale(s, "en"))
+	assert.Equal(t, [][]telegramBotModels.InlineKeyboardButton{
+		{
+			{Text: "Metrisch °C", CallbackData: "settings:units:metric"},
+			{Text: "✓ Imperial °F", CallbackData: "settings:units:imperial"},
+		},
+		{
+			{Text: "English", CallbackData: "settings:language:en"},
+			{Text: "✓ Deutsch", CallbackData: "settings:language:de"},
+			{Text: "Русский", CallbackData: "settings:language:ru"},
+		},
+		{
+			{Text: "Text", CallbackData: "settings:output:text"},
+			{Text: "✓ Diagramm", CallbackData: "settings:output:chart"},
+		},
+	}, keyboard.InlineKeyboard)
+}
+
+func TestUserForecastView(t *testing.T) {
+	v := userForecastView(&database.UserSettings{Units: unitsImperial, TimeZone: "Asia/Tokyo", Language: "ru"}, "de-DE")
+	assert.True(t, v.Imperial)
+	if assert.NotNil(t, v.TimeZone) {
+		assert.Equal(t, "Asia/Tokyo", v.TimeZone.String())
+	}
+	assert.Equal(t, "ru", v.Locale.Language())
+
+	v = userForecastView(&database.UserSettings{}, "de-DE")
+	assert.False(t, v.Imperial)
+	assert.Nil(t, v.TimeZone)
+	assert.Equal(t, "de", v.Locale.Language())
+
+	assert.Equal(t, "en", userForecastView(&database.UserSettings{}, "fr").Locale.Language())
+}
@@ -0,0 +1,74 @@
+package botapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+func init() {
+	registerCommand(&Command{
+		Name:    "status",
+		MinRole: AdminUser,
+		Help:    "help.status",
+		Handler: statusHandlerClosure,
+	})
+}
+
+type cacheReporter interface {
+	Stats() fetch.CacheStats
+}
+
+type nameReporter interface {
+	Name() string
+}
+
+func statusHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		l := b.updateLocale(ctx, update)
+		b.sendText(ctx, update.Message.Chat.ID, b.statusText(l), nil, l)
+	}
+}
+
+func (b *Bot) statusText(l i18n.Localizer) string {
+	var r strings.Builder
+	r.WriteString(l.T("status.fetchers"))
+	for _, spec := range fetcherRegistry {
+		f, ok := b.fetchers[spec.Name]
+		if !ok {
+			r.WriteString("\n" + l.T("status.disabled", spec.Name))
+			continue
+		}
+		r.WriteString("\n" + l.T("status.enabled", spec.Name))
+		if n, ok := f.(nameReporter); ok {
+			r.WriteString(fmt.Sprintf(" (%s)", n.Name()))
+		}
+		if c, ok := f.(cacheReporter); ok {
+			stats := c.Stats()
+			r.WriteString(", " + l.T("status.cache", stats.Entries, stats.Hits, stats.Misses))
+		}
+	}
+
+	if len(b.breakers) > 0 {
+		r.WriteString("\n\n" + l.T("status.breakers"))
+	}
+	for _, cb := range b.breakers {
+		s := cb.Status()
+		state := l.T("status.state_" + strings.ReplaceAll(s.State.String(), "-", "_"))
+		r.WriteString("\n" + l.T("status.breaker", s.Name, state, s.Failures))
+		if s.State != fetch.CircuitClosed {
+			r.WriteString(", " + l.T("status.opened", time.Since(s.OpenedAt).Round(time.Second)))
+		}
+		if s.LastFailure != nil {
+			r.WriteString("\n\t" + l.T("status.last_failure", s.LastFailure))
+		}
+	}
+	return r.String()
+}
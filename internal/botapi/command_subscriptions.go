@@ -0,0 +1,284 @@
+package botapi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+const (
+	subscriptionWeather = "weather"
+
+	maxSubscriptionsPerUser = 10
+	// subscriptions push the forecast for that many days
+	subscriptionForecastDays = 1
+)
+
+func init() {
+	registerCommand(&Command{
+		Name:    "subscribe",
+		MinRole: PromotedUser,
+		Args: ArgSpec{
+			{Name: "kind", Kind: EnumArg, Values: []string{subscriptionWeather}},
+			{Name: "city", Words: true, Optional: true},
+			{Name: "time", Placeholder: "HH:MM"},
+		},
+		Help:     "help.subscribe",
+		Fetchers: []string{"weather"},
+		Handler:  subscribeHandlerClosure,
+	})
+	registerCommand(&Command{
+		Name:    "subscriptions",
+		MinRole: PromotedUser,
+		Help:    "help.subscriptions",
+		Handler: subscriptionsHandlerClosure,
+	})
+	registerCommand(&Command{
+		Name:    "unsubscribe",
+		MinRole: PromotedUser,
+		Args: ArgSpec{
+			{Name: "id", Placeholder: "id|all"},
+		},
+		Help:    "help.unsubscribe",
+		Handler: unsubscribeHandlerClosure,
+	})
+}
+
+// runWeatherSubscription sends the forecast of the day like /weather does, in the language
+// saved when subscribing unless the user set one since. A city name that became ambiguous is
+// answered with the keyboard and the pick is used for the later runs. The subscription is
+// dropped when the bot is blocked in the chat
+func (b *Bot) runWeatherSubscription(ctx context.Context, sub *database.Subscription) {
+	wf := getFetcher[fetch.Fetchable[fetch.WeatherQuery, *fetch.Forecast]](b, "weather")
+	if wf == nil {
+		b.logger.Warn().Int64("subscription", sub.ID).Msg("weather fetcher is disabled, skipping subscription")
+		return
+	}
+
+	q := fetch.WeatherQuery{
+		City:     sub.City,
+		Location: b.locationChoice(ctx, sub.UserID, sub.City),
+		Days:     subscriptionForecastDays,
+		Language: sub.Language,
+	}
+	err := b.sendForecast(ctx, wf, sub.UserID, sub.ChatID, q, "", nil)
+	if !errors.Is(err, telegramBot.ErrorForbidden) {
+		return
+	}
+	b.logger.Warn().Err(err).Int64("subscription", sub.ID).Msg("the bot is blocked in the chat, dropping subscription")
+	if _, err := b.db.DeleteSubscriptions(ctx, sub.UserID, sub.ID); err != nil {
+		b.logger.Error().Err(err).Int64("subscription", sub.ID).Msg("Failed to delete subscription")
+	}
+}
+
+func renderSubscription(sub *database.Subscription, l i18n.Localizer) string {
+	return l.T("subscription.line", sub.ID, sub.Kind, sub.City, formatClock(sub.MinuteOfDay), sub.TimeZone,
+		dateTime(sub.NextRun.In(subscriptionTimeZone(sub)), l))
+}
+
+// settingsSubscriptionTimeZone is the zone the subscriptions of the user run in, UTC until the
+// user sets one
+func settingsSubscriptionTimeZone(s *database.UserSettings) string {
+	if s.TimeZone == "" {
+		return "UTC"
+	}
+	return s.TimeZone
+}
+
+// rescheduleSubscriptions moves the subscriptions of the user to the time zone of the settings,
+// they keep their time of day. It returns how many were moved
+func (b *Bot) rescheduleSubscriptions(ctx context.Context, userID int64, s *database.UserSettings) (int, error) {
+	subscriptions, err := b.db.ListSubscriptions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	timeZone := settingsSubscriptionTimeZone(s)
+	moved := 0
+	for _, sub := range subscriptions {
+		if sub.TimeZone == timeZone {
+			continue
+		}
+		sub.TimeZone = timeZone
+		next := nextRun(sub.MinuteOfDay, subscriptionTimeZone(&sub), time.Now())
+		if err := b.db.RescheduleSubscription(ctx, sub.ID, timeZone, next); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+func subscribeHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		userID := update.Message.From.ID
+		chatID := update.Message.Chat.ID
+		args := commandArgs(ctx)
+		l := b.updateLocale(ctx, update)
+
+		minute, err := parseClock(args.String("time"))
+		if err != nil {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: chatID,
+				Text:   l.T("bot.error", localizeError(err, l)),
+			})
+			return
+		}
+
+		q, ok := b.cityQuery(ctx, update, args.String("city"))
+		if !ok {
+			return
+		}
+
+		existing, err := b.db.ListSubscriptions(ctx, userID)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to list subscriptions")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: chatID,
+				Text:   l.T("subscription.failed"),
+			})
+			return
+		}
+		if len(existing) >= maxSubscriptionsPerUser {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: chatID,
+				Text:   l.N("subscription.too_many", len(existing)),
+			})
+			return
+		}
+		for _, s := range existing {
+			if s.ChatID == chatID && s.Kind == args.String("kind") && s.MinuteOfDay == minute &&
+				fetch.NormalizeCity(s.City) == fetch.NormalizeCity(q.City) {
+				b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+					ChatID: chatID,
+					Text:   l.T("subscription.exists", renderSubscription(&s, l)),
+				})
+				return
+			}
+		}
+
+		// an unknown city would only fail every morning, an ambiguous one is asked about right away
+		wf := getFetcher[fetch.Fetchable[fetch.WeatherQuery, *fetch.Forecast]](b, "weather")
+		fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		q.Days = subscriptionForecastDays
+		_, fetchErr := wf.Fetch(fetchCtx, q)
+		cancel()
+		if errors.Is(fetchErr, fetch.ErrLocationNotFound) {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: chatID,
+				Text:   l.T("weather.not_found", q.City),
+			})
+			return
+		}
+
+		settings := b.userSettings(ctx, userID)
+		sub := &database.Subscription{
+			UserID:      userID,
+			ChatID:      chatID,
+			Kind:        args.String("kind"),
+			City:        q.City,
+			MinuteOfDay: minute,
+			TimeZone:    settingsSubscriptionTimeZone(settings),
+			Language:    q.Language,
+		}
+		sub.NextRun = nextRun(minute, subscriptionTimeZone(sub), time.Now())
+		if sub.ID, err = b.db.AddSubscription(ctx, sub); err != nil {
+			b.logger.Error().Err(err).Msg("Failed to add subscription")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: chatID,
+				Text:   l.T("subscription.failed"),
+			})
+			return
+		}
+
+		text := l.T("subscription.subscribed", renderSubscription(sub, l))
+		if settings.TimeZone == "" {
+			text += "\n\n" + l.T("subscription.utc")
+		}
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: chatID,
+			Text:   text,
+		})
+
+		var ambiguous *fetch.AmbiguousLocationError
+		if errors.As(fetchErr, &ambiguous) {
+			b.askLocation(ctx, chatID, &locationPick{
+				userID:     userID,
+				query:      q,
+				purpose:    pickSubscription,
+				candidates: ambiguous.Candidates,
+			}, nil)
+		}
+	}
+}
+
+func subscriptionsHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		l := b.updateLocale(ctx, update)
+		subscriptions, err := b.db.ListSubscriptions(ctx, update.Message.From.ID)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to list subscriptions")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("subscription.list_failed"),
+			})
+			return
+		}
+
+		if len(subscriptions) == 0 {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("subscription.none"),
+			})
+			return
+		}
+
+		var r strings.Builder
+		r.WriteString(l.T("subscription.list"))
+		for _, s := range subscriptions {
+			r.WriteString("\n" + renderSubscription(&s, l))
+		}
+		b.sendText(ctx, update.Message.Chat.ID, r.String(), nil, l)
+	}
+}
+
+func unsubscribeHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		l := b.updateLocale(ctx, update)
+		id, ok := parseIDOrAll(commandArgs(ctx).String("id"))
+		if !ok {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("subscription.bad_id"),
+			})
+			return
+		}
+
+		n, err := b.db.DeleteSubscriptions(ctx, update.Message.From.ID, id)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to delete subscriptions")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("subscription.unsubscribe_failed"),
+			})
+			return
+		}
+
+		text := l.N("subscription.cancelled", int(n))
+		if n == 0 && id != 0 {
+			text = l.T("subscription.unknown", id)
+		}
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   text,
+		})
+	}
+}
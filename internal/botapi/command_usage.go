@@ -0,0 +1,400 @@
+package botapi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+// defaultChatPrices are USD per million prompt/completion tokens, matched by the longest model prefix
+const defaultChatPrices = "gpt-3.5-turbo=0.5/1.5,gpt-4o-mini=0.15/0.6,gpt-4o=2.5/10," +
+	"claude-3-5-haiku=0.8/4,claude-3-5-sonnet=3/15"
+
+func init() {
+	registerCommand(&Command{
+		Name:     "usage",
+		MinRole:  PromotedUser,
+		Args:     ArgSpec{{Name: "scope", Kind: EnumArg, Optional: true, Values: []string{"all"}}},
+		Help:     "help.usage",
+		Fetchers: []string{"chat"},
+		Handler:  usageHandlerClosure,
+	})
+	registerCommand(&Command{
+		Name:    "budget",
+		MinRole: AdminUser,
+		Args: ArgSpec{
+			{Name: "user_id", Kind: IntArg, Min: 1},
+			{Name: "limits", Rest: true, Optional: true, Placeholder: "daily=N monthly=N daily_cost=X monthly_cost=X|reset"},
+		},
+		Help:     "help.budget",
+		Fetchers: []string{"chat"},
+		Handler:  budgetHandlerClosure,
+	})
+}
+
+type modelPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// parsePrices parses "model=prompt/completion,..." skipping invalid entries
+func parsePrices(s string) map[string]modelPrice {
+	prices := make(map[string]modelPrice)
+	for _, entry := range strings.Split(s, ",") {
+		model, price, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		promptPrice, completionPrice, _ := strings.Cut(price, "/")
+		prompt, err := strconv.ParseFloat(strings.TrimSpace(promptPrice), 64)
+		if err != nil {
+			continue
+		}
+		completion, err := strconv.ParseFloat(strings.TrimSpace(completionPrice), 64)
+		if err != nil {
+			completion = prompt
+		}
+		prices[strings.TrimSpace(model)] = modelPrice{Prompt: prompt, Completion: completion}
+	}
+	return prices
+}
+
+// usageCost estimates the cost in USD, the response model is usually a dated version
+// like gpt-4o-2024-08-06 so the longest price prefix wins, unknown models are free
+func usageCost(prices map[string]modelPrice, model string, u fetch.ChatUsage) float64 {
+	best := ""
+	for name := range prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return 0
+	}
+	p := prices[best]
+	return (float64(u.PromptTokens)*p.Prompt + float64(u.CompletionTokens)*p.Completion) / 1e6
+}
+
+// chatBudget limits the chat usage of a user, nil means unlimited and zero blocks the chat
+type chatBudget struct {
+	DailyTokens   *int64
+	MonthlyTokens *int64
+	DailyCost     *float64
+	MonthlyCost   *float64
+}
+
+// parseBudget parses "daily=N monthly=N daily_cost=X monthly_cost=X", separated by spaces or commas
+func parseBudget(s string) (*database.ChatBudget, error) {
+	var b database.ChatBudget
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, argError("usage.bad_budget", field)
+		}
+		switch key {
+		case "daily", "monthly":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return nil, argError("usage.bad_token_budget", key, value)
+			}
+			if key == "daily" {
+				b.DailyTokens = &n
+			} else {
+				b.MonthlyTokens = &n
+			}
+		case "daily_cost", "monthly_cost":
+			x, err := strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+			if err != nil || x < 0 {
+				return nil, argError("usage.bad_cost_budget", key, value)
+			}
+			if key == "daily_cost" {
+				b.DailyCost = &x
+			} else {
+				b.MonthlyCost = &x
+			}
+		default:
+			return nil, argError("usage.unknown_budget", key)
+		}
+	}
+	return &b, nil
+}
+
+func (c chatBudget) override(b *database.ChatBudget) chatBudget {
+	if b == nil {
+		return c
+	}
+	if b.DailyTokens != nil {
+		c.DailyTokens = b.DailyTokens
+	}
+	if b.MonthlyTokens != nil {
+		c.MonthlyTokens = b.MonthlyTokens
+	}
+	if b.DailyCost != nil {
+		c.DailyCost = b.DailyCost
+	}
+	if b.MonthlyCost != nil {
+		c.MonthlyCost = b.MonthlyCost
+	}
+	return c
+}
+
+// exceeded describes the first exhausted budget, empty if there is none
+func (c chatBudget) exceeded(today, month database.UsageTotals, l i18n.Localizer) string {
+	switch {
+	case c.DailyTokens != nil && today.Tokens >= *c.DailyTokens:
+		return l.T("usage.daily_tokens_exceeded", *c.DailyTokens)
+	case c.DailyCost != nil && today.Cost >= *c.DailyCost:
+		return l.T("usage.daily_cost_exceeded", *c.DailyCost)
+	case c.MonthlyTokens != nil && month.Tokens >= *c.MonthlyTokens:
+		return l.T("usage.monthly_tokens_exceeded", *c.MonthlyTokens)
+	case c.MonthlyCost != nil && month.Cost >= *c.MonthlyCost:
+		return l.T("usage.monthly_cost_exceeded", *c.MonthlyCost)
+	}
+	return ""
+}
+
+// roleBudget reads CHAT_BUDGET_REGULAR, CHAT_BUDGET_PROMOTED or CHAT_BUDGET_ADMIN
+func (b *Bot) roleBudget(role UserRole) chatBudget {
+	key := "CHAT_BUDGET_" + strings.Fields(role.String())[0]
+	budget, err := parseBudget(envString(key, ""))
+	if err != nil {
+		b.logger.Warn().Err(err).Msgf("%s is invalid, the role budget is unlimited", key)
+		return chatBudget{}
+	}
+	return chatBudget{}.override(budget)
+}
+
+func (b *Bot) userBudget(ctx context.Context, userID int64) (chatBudget, error) {
+	own, err := b.db.GetChatBudget(ctx, userID)
+	if err != nil {
+		return chatBudget{}, err
+	}
+	return b.roleBudget(b.getUserRole(userID)).override(own), nil
+}
+
+// usagePeriods returns the start of the current UTC day and month
+func usagePeriods(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC),
+		time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (b *Bot) usageTotals(ctx context.Context, userID int64) (today, month database.UsageTotals, err error) {
+	dayStart, monthStart := usagePeriods(time.Now())
+	if today, err = b.db.GetChatUsageTotals(ctx, userID, dayStart); err != nil {
+		return
+	}
+	month, err = b.db.GetChatUsageTotals(ctx, userID, monthStart)
+	return
+}
+
+// chatBudgetExceeded checks the budget before a chat request, the accounting failures
+// do not block the chat
+func (b *Bot) chatBudgetExceeded(ctx context.Context, userID int64, l i18n.Localizer) string {
+	budget, err := b.userBudget(ctx, userID)
+	if err != nil {
+		b.logger.Error().Err(err).Msg("Failed to load chat budget")
+		return ""
+	}
+	if budget == (chatBudget{}) {
+		return ""
+	}
+	today, month, err := b.usageTotals(ctx, userID)
+	if err != nil {
+		b.logger.Error().Err(err).Msg("Failed to load chat usage")
+		return ""
+	}
+	return budget.exceeded(today, month, l)
+}
+
+func (b *Bot) recordChatUsage(ctx context.Context, update *telegramBotModels.Update, q fetch.ChatQuery, completion *fetch.ChatCompletion) {
+	model := completion.Model
+	if model == "" {
+		model = q.Model
+	}
+	if err := b.db.RecordChatUsage(ctx, database.ChatUsage{
+		UserID:           update.Message.From.ID,
+		ChatID:           update.Message.Chat.ID,
+		Model:            model,
+		PromptTokens:     completion.Usage.PromptTokens,
+		CompletionTokens: completion.Usage.CompletionTokens,
+		Estimated:        completion.Usage.Estimated,
+		Cost:             usageCost(parsePrices(envString("CHAT_PRICES", defaultChatPrices)), model, completion.Usage),
+	}); err != nil {
+		b.logger.Error().Err(err).Msg("Failed to record chat usage")
+	}
+}
+
+func renderUsage(t database.UsageTotals, l i18n.Localizer) string {
+	return l.N("usage.requests", int(t.Requests)) + ", " + l.N("usage.tokens", int(t.Tokens)) + fmt.Sprintf(", $%.4f", t.Cost)
+}
+
+func renderLimit(tokens *int64, cost *float64, l i18n.Localizer) string {
+	var limits []string
+	if tokens != nil {
+		limits = append(limits, l.N("usage.tokens", int(*tokens)))
+	}
+	if cost != nil {
+		limits = append(limits, fmt.Sprintf("$%.2f", *cost))
+	}
+	if len(limits) == 0 {
+		return l.T("usage.unlimited")
+	}
+	return strings.Join(limits, " / ")
+}
+
+func renderBudget(c chatBudget, l i18n.Localizer) string {
+	return l.T("usage.budget", renderLimit(c.DailyTokens, c.DailyCost, l), renderLimit(c.MonthlyTokens, c.MonthlyCost, l))
+}
+
+func usageHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		userID := update.Message.From.ID
+		l := b.updateLocale(ctx, update)
+
+		if commandArgs(ctx).String("scope") == "all" {
+			if b.getUserRole(userID) < AdminUser {
+				b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+					ChatID: update.Message.Chat.ID,
+					Text:   l.T("usage.admins_only"),
+				})
+				return
+			}
+			b.sendUsageByUser(ctx, update, l)
+			return
+		}
+
+		today, month, err := b.usageTotals(ctx, userID)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to load chat usage")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("usage.load_failed"),
+			})
+			return
+		}
+		budget, err := b.userBudget(ctx, userID)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to load chat budget")
+		}
+
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   l.T("usage.summary", renderUsage(today, l), renderUsage(month, l), renderBudget(budget, l)),
+		})
+	}
+}
+
+func (b *Bot) sendUsageByUser(ctx context.Context, update *telegramBotModels.Update, l i18n.Localizer) {
+	_, monthStart := usagePeriods(time.Now())
+	usage, err := b.db.ListChatUsageByUser(ctx, monthStart)
+	if err != nil {
+		b.logger.Error().Err(err).Msg("Failed to list chat usage")
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   l.T("usage.load_failed"),
+		})
+		return
+	}
+
+	if len(usage) == 0 {
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   l.T("usage.nobody"),
+		})
+		return
+	}
+
+	var r strings.Builder
+	r.WriteString(l.T("usage.by_user"))
+	for _, u := range usage {
+		r.WriteString(fmt.Sprintf("\n%d: %s", u.UserID, renderUsage(u.UsageTotals, l)))
+	}
+
+	b.sendText(ctx, update.Message.Chat.ID, r.String(), nil, l)
+}
+
+func budgetHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		args := commandArgs(ctx)
+		userID := args.Int64("user_id")
+		l := b.updateLocale(ctx, update)
+
+		switch rest := args.String("limits"); rest {
+		case "":
+		case "reset":
+			if _, err := b.db.DeleteChatBudget(ctx, userID); err != nil {
+				b.logger.Error().Err(err).Msg("Failed to reset chat budget")
+				b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+					ChatID: update.Message.Chat.ID,
+					Text:   l.T("usage.budget_reset_failed"),
+				})
+				return
+			}
+		default:
+			budget, err := parseBudget(rest)
+			if err != nil {
+				b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+					ChatID: update.Message.Chat.ID,
+					Text:   l.T("bot.error", localizeError(err, l)),
+				})
+				return
+			}
+			own, err := b.db.GetChatBudget(ctx, userID)
+			if err == nil {
+				merged := mergeChatBudget(own, budget)
+				err = b.db.SaveChatBudget(ctx, userID, merged)
+			}
+			if err != nil {
+				b.logger.Error().Err(err).Msg("Failed to save chat budget")
+				b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+					ChatID: update.Message.Chat.ID,
+					Text:   l.T("usage.budget_save_failed"),
+				})
+				return
+			}
+		}
+
+		budget, err := b.userBudget(ctx, userID)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to load chat budget")
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   l.T("usage.budget_load_failed"),
+			})
+			return
+		}
+
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   l.T("usage.user_budget", userID, renderBudget(budget, l)),
+		})
+	}
+}
+
+// mergeChatBudget keeps the stored limits which are not changed
+func mergeChatBudget(own, changed *database.ChatBudget) *database.ChatBudget {
+	merged := *own
+	if changed.DailyTokens != nil {
+		merged.DailyTokens = changed.DailyTokens
+	}
+	if changed.MonthlyTokens != nil {
+		merged.MonthlyTokens = changed.MonthlyTokens
+	}
+	if changed.DailyCost != nil {
+		merged.DailyCost = changed.DailyCost
+	}
+	if changed.MonthlyCost != nil {
+		merged.MonthlyCost = changed.MonthlyCost
+	}
+	return &merged
+}
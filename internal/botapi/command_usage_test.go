@@ -0,0 +1,83 @@
+package botapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+func TestUsageCost(t *testing.T) {
+	prices := parsePrices("gpt-4o=2.5/10, gpt-4o-mini=0.15/0.6,invalid,flat=1")
+	assert.Equal(t, modelPrice{Prompt: 1, Completion: 1}, prices["flat"])
+	assert.NotContains(t, prices, "invalid")
+
+	usage := fetch.ChatUsage{PromptTokens: 1000, CompletionTokens: 500}
+	assert.InDelta(t, 0.0075, usageCost(prices, "gpt-4o-2024-08-06", usage), 1e-9)
+	assert.InDelta(t, 0.00045, usageCost(prices, "gpt-4o-mini-2024-07-18", usage), 1e-9, "the longest prefix wins")
+	assert.Zero(t, usageCost(prices, "llama3.2", usage))
+}
+
+func TestParseBudget(t *testing.T) {
+	got, err := parseBudget("daily=1000, monthly_cost=$5")
+	if assert.NoError(t, err) {
+		assert.Equal(t, chatBudget{DailyTokens: ptr[int64](1000), MonthlyCost: ptr(5.0)}, chatBudget{}.override(got))
+	}
+
+	got, err = parseBudget("")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &database.ChatBudget{}, got)
+	}
+
+	for _, s := range []string{"daily", "daily=-1", "weekly=10", "daily_cost=cheap"} {
+		_, err := parseBudget(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestChatBudget_Exceeded(t *testing.T) {
+	budget := chatBudget{DailyTokens: ptr[int64](1000), MonthlyCost: ptr(5.0)}
+	en := i18n.For("en")
+
+	assert.Empty(t, budget.exceeded(database.UsageTotals{Tokens: 999}, database.UsageTotals{Cost: 4.99}, en))
+	assert.Contains(t, budget.exceeded(database.UsageTotals{Tokens: 1000}, database.UsageTotals{}, en), "daily chat budget of 1000 tokens")
+	assert.Contains(t, budget.exceeded(database.UsageTotals{}, database.UsageTotals{Cost: 5}, en), "monthly chat budget of $5.00")
+	assert.Contains(t, budget.exceeded(database.UsageTotals{}, database.UsageTotals{Cost: 5}, i18n.For("de")), "Monatsbudget")
+	assert.Empty(t, chatBudget{}.exceeded(database.UsageTotals{Tokens: 1e9}, database.UsageTotals{Cost: 1e9}, en), "nil is unlimited")
+	assert.NotEmpty(t, chatBudget{DailyTokens: ptr[int64](0)}.exceeded(database.UsageTotals{}, database.UsageTotals{}, en), "zero blocks the chat")
+}
+
+func TestUsagePeriods(t *testing.T) {
+	day, month := usagePeriods(time.Date(2024, 3, 15, 1, 30, 0, 0, time.FixedZone("CET", 3600)))
+	assert.Equal(t, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), day)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), month)
+}
+
+func TestPartialCompletion(t *testing.T) {
+	q := fetch.ChatQuery{Messages: []fetch.Message{{Role: "user", Content: "tell me a long story"}}, Model: "gpt-4o"}
+
+	got := partialCompletion(q, "once upon a time", errors.New("stream closed"))
+	if assert.NotNil(t, got, "the text received is spent") {
+		assert.Equal(t, "gpt-4o", got.Model)
+		assert.True(t, got.Usage.Estimated)
+		assert.Positive(t, got.Usage.CompletionTokens)
+	}
+
+	got = partialCompletion(q, "", context.Canceled)
+	if assert.NotNil(t, got, "the backend may have answered a cancelled request") {
+		assert.Positive(t, got.Usage.PromptTokens)
+		assert.Zero(t, got.Usage.CompletionTokens)
+	}
+
+	assert.Nil(t, partialCompletion(q, "", &fetch.StatusError{Upstream: "OpenAI", StatusCode: 429}), "a rejected request costs nothing")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
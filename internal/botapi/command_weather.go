@@ -0,0 +1,518 @@
+package botapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+const (
+	defaultWeatherProviders  = "accuweather,openmeteo"
+	defaultDailyForecastTTL  = 30 * time.Minute
+	defaultHourlyForecastTTL = 10 * time.Minute
+	defaultCurrentWeatherTTL = 10 * time.Minute
+	defaultForecastCacheSize = 256
+
+	// forecasts without a period and the forecasts of shared locations are for that many days
+	defaultForecastDays = 3
+	// hourly forecasts without a number of hours
+	defaultForecastHours = 12
+
+	locationPickPrefix = "wloc:"
+	// unanswered keyboards to pick one of the places of the same name expire after that
+	locationPickTTL = 15 * time.Minute
+)
+
+func init() {
+	registerFetcher(&FetcherSpec{
+		Name: "weather",
+		New:  newWeatherFetcher,
+	})
+	registerCommand(&Command{
+		Name:    "weather",
+		MinRole: PromotedUser,
+		Args: ArgSpec{
+			{Name: "city", Words: true, Optional: true},
+			{Name: "N", Kind: IntArg, Optional: true, Min: 1},
+			{Name: "unit", Kind: EnumArg, Optional: true, Values: []string{"days", "hours"}},
+			{Name: "days", Kind: IntArg, Flag: true, Min: 1},
+			{Name: "hours", Kind: IntArg, Flag: true, Min: 1},
+			{Name: "chart", Kind: BoolArg, Flag: true},
+		},
+		Help:     "help.weather",
+		Fetchers: []string{"weather"},
+		Handler:  weatherHandlerClosure,
+	})
+	registerMessageHandler(&MessageHandler{
+		Name:     "weather-location",
+		MinRole:  PromotedUser,
+		Fetchers: []string{"weather"},
+		Match:    isLocation,
+		Handler:  locationWeatherHandlerClosure,
+	})
+	// the picks are asked for by /watch too, which needs the alerts and not the forecasts
+	registerMessageHandler(&MessageHandler{
+		Name:    "weather-location-pick",
+		MinRole: PromotedUser,
+		Match:   isLocationPick,
+		Handler: locationPickHandlerClosure,
+	})
+}
+
+// newWeatherFetcher builds the providers listed in WEATHER_PROVIDERS in priority order,
+// each with its own retries and circuit breaker, behind a shared response cache
+func newWeatherFetcher(b *Bot, _ string) (any, error) {
+	plan, err := fetch.ParseAccuWeatherPlan(envString("ACCU_WEATHER_PLAN", fetch.AccuWeatherFreePlan.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	var providers []fetch.WeatherProvider
+	for _, name := range strings.Split(envString("WEATHER_PROVIDERS", defaultWeatherProviders), ",") {
+		var provider fetch.WeatherProvider
+		apiKey := ""
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "accuweather":
+			apiKey = os.Getenv("ACCU_WEATHER_API_KEY")
+			if apiKey == "" {
+				b.logger.Warn().Msg("ACCU_WEATHER_API_KEY is not set, accuweather provider is disabled")
+				continue
+			}
+			accuWeatherFetcher := &fetch.AccuWeatherFetcher{}
+			accuWeatherFetcher.SetBaseURL(os.Getenv("ACCU_WEATHER_BASE_URL"))
+			accuWeatherFetcher.SetLocationCache(b.locations)
+			accuWeatherFetcher.SetQuota(b.accuWeatherQuota)
+			accuWeatherFetcher.SetPlan(plan)
+			provider = accuWeatherFetcher
+		case "openmeteo":
+			openMeteoFetcher := &fetch.OpenMeteoFetcher{}
+			openMeteoFetcher.SetBaseURL(os.Getenv("OPEN_METEO_BASE_URL"))
+			openMeteoFetcher.SetGeocodingBaseURL(os.Getenv("OPEN_METEO_GEOCODING_BASE_URL"))
+			openMeteoFetcher.SetLocationCache(b.locations)
+			provider = openMeteoFetcher
+		case "":
+			continue
+		default:
+			return nil, fmt.Errorf("unknown weather provider %q", name)
+		}
+
+		rf := newResilientFetcher[fetch.WeatherQuery, *fetch.Forecast](b, name, provider, true)
+		if err := rf.Set(apiKey, b.logger); err != nil {
+			return nil, err
+		}
+		providers = append(providers, fetch.NamedWeatherProvider(provider.Name(), rf))
+	}
+
+	if len(providers) == 0 {
+		return nil, errFetcherDisabled
+	}
+
+	dailyTTL := envDuration("WEATHER_CACHE_TTL_DAILY", defaultDailyForecastTTL)
+	hourlyTTL := envDuration("WEATHER_CACHE_TTL_HOURLY", defaultHourlyForecastTTL)
+	currentTTL := envDuration("WEATHER_CACHE_TTL_CURRENT", defaultCurrentWeatherTTL)
+	ttl := func(q fetch.WeatherQuery) time.Duration {
+		if q.Current {
+			return currentTTL
+		}
+		if q.Hours > 0 {
+			return hourlyTTL
+		}
+		return dailyTTL
+	}
+
+	wf := fetch.NewWeatherFetcher(providers...)
+	cf := fetch.NewCachedFetcher[fetch.WeatherQuery, *fetch.Forecast](wf, envInt("WEATHER_CACHE_SIZE", defaultForecastCacheSize), ttl)
+	if err := cf.Set("", b.logger); err != nil {
+		return nil, err
+	}
+	return fetch.Fetchable[fetch.WeatherQuery, *fetch.Forecast](cf), nil
+}
+
+func weatherHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		wf := getFetcher[fetch.Fetchable[fetch.WeatherQuery, *fetch.Forecast]](b, "weather")
+
+		go func() {
+			if err := b.db.LogUserActivity(update.Message.From.ID, update.Message.Text); err != nil {
+				b.logger.Error().Err(err).Msg("Failed to log user activity")
+			}
+		}()
+
+		// examples: "/weather london 5 days", "/weather new york 12 hours", "/weather "rio de janeiro" --hours 6"
+		args := commandArgs(ctx)
+		q, ok := b.cityQuery(ctx, update, args.String("city"))
+		if !ok {
+			return
+		}
+
+		n := args.Int("N")
+		switch {
+		case args.Has("days") && args.Has("hours"):
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   b.updateLocale(ctx, update).T("weather.days_or_hours"),
+			})
+			return
+		case args.Has("days"):
+			q.Days = args.Int("days")
+		case args.Has("hours"):
+			q.Hours = args.Int("hours")
+		case args.String("unit") == "hours" && n > 0:
+			q.Hours = n
+		case args.String("unit") == "hours":
+			q.Hours = defaultForecastHours
+		case n > 0:
+			q.Days = n
+		default:
+			q.Days = defaultForecastDays
+		}
+
+		// --chart=no asks for text when the setting is chart
+		output := ""
+		if args.Has("chart") {
+			output = outputText
+			if args.Bool("chart") {
+				output = outputChart
+			}
+		}
+		b.sendForecast(ctx, wf, update.Message.From.ID, update.Message.Chat.ID, q, output, nil)
+	}
+}
+
+// cityQuery builds the query for the city or the home city of the user if the city is empty,
+// using the place the user picked when the name was ambiguous before. It answers the user
+// and returns false when there is no city
+func (b *Bot) cityQuery(ctx context.Context, update *telegramBotModels.Update, city string) (fetch.WeatherQuery, bool) {
+	userID := update.Message.From.ID
+	if city == "" {
+		settings := b.userSettings(ctx, userID)
+		city = settings.HomeCity
+		if city == "" {
+			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   settingsLocale(settings, update.Message.From.LanguageCode).T("weather.no_city"),
+			})
+			return fetch.WeatherQuery{}, false
+		}
+	}
+
+	return fetch.WeatherQuery{
+		City:     city,
+		Location: b.locationChoice(ctx, userID, city),
+		Language: i18n.Match(update.Message.From.LanguageCode),
+	}, true
+}
+
+// locationChoice returns the place the user picked when the city name was ambiguous or nil
+func (b *Bot) locationChoice(ctx context.Context, userID int64, city string) *fetch.Location {
+	choice, err := b.db.GetLocationChoice(ctx, userID, fetch.NormalizeCity(city))
+	if err != nil {
+		b.logger.Error().Err(err).Msg("Failed to get location choice")
+		return nil
+	}
+	if choice == nil {
+		return nil
+	}
+	return toFetchLocation(choice)
+}
+
+// isLocation matches a shared location pin or the first message of a live location, the live
+// updates come as edited messages and are ignored
+func isLocation(_ *Bot, update *telegramBotModels.Update) bool {
+	m := update.Message
+	return m != nil && m.From != nil && m.Location != nil
+}
+
+func locationWeatherHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		wf := getFetcher[fetch.Fetchable[fetch.WeatherQuery, *fetch.Forecast]](b, "weather")
+
+		position := &fetch.GeoPosition{
+			Latitude:  update.Message.Location.Latitude,
+			Longitude: update.Message.Location.Longitude,
+		}
+
+		go func() {
+			if err := b.db.LogUserActivity(update.Message.From.ID, "location "+position.String()); err != nil {
+				b.logger.Error().Err(err).Msg("Failed to log user activity")
+			}
+		}()
+
+		q := fetch.WeatherQuery{Position: position, Days: defaultForecastDays, Language: i18n.Match(update.Message.From.LanguageCode)}
+		b.sendForecast(ctx, wf, update.Message.From.ID, update.Message.Chat.ID, q, "", &telegramBotModels.ReplyParameters{
+			MessageID: update.Message.ID,
+		})
+	}
+}
+
+// sendForecast fetches and sends the forecast in the language, units and time zone of the user,
+// a city name shared by several places is answered with a keyboard to pick one of them. The
+// language of the query is the one of the Telegram app and the language setting overrides it.
+// The output is text or chart, empty uses the setting of the user. It returns the error of
+// the Telegram API when nothing could be sent to the chat, e.g. the bot is blocked there
+func (b *Bot) sendForecast(ctx context.Context, wf fetch.Fetchable[fetch.WeatherQuery, *fetch.Forecast], userID, chatID int64, q fetch.WeatherQuery, output string, replyTo *telegramBotModels.ReplyParameters) error {
+	settings := b.userSettings(ctx, userID)
+	if settings.Language != "" {
+		q.Language = settings.Language
+	}
+	view := userForecastView(settings, q.Language)
+
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	forecast, err := wf.Fetch(fetchCtx, q)
+	var ambiguous *fetch.AmbiguousLocationError
+	if errors.As(err, &ambiguous) {
+		return b.askLocation(ctx, chatID, &locationPick{
+			userID:     userID,
+			query:      q,
+			output:     output,
+			candidates: ambiguous.Candidates,
+		}, replyTo)
+	}
+	if err != nil {
+		text := view.Locale.T("weather.fetch_failed", err)
+		var planErr *fetch.PlanLimitError
+		if errors.As(err, &planErr) {
+			text = view.Locale.T("weather.too_far", view.Locale.N("forecast."+planErr.Unit, planErr.Max))
+		}
+		_, err = b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID:          chatID,
+			Text:            text,
+			ReplyParameters: replyTo,
+		})
+		return err
+	}
+
+	if q.Current {
+		_, err = b.sendMarkdown(ctx, chatID, renderCurrentConditions(forecast, view), replyTo, view.Locale)
+		return err
+	}
+	if output == "" {
+		output = userOutput(settings)
+	}
+	if output == outputChart {
+		err := b.sendForecastChart(ctx, chatID, forecast, view, replyTo)
+		if err == nil {
+			return nil
+		}
+		b.logger.Error().Err(err).Msg("Failed to send forecast chart, sending text instead")
+	}
+	_, err = b.sendMarkdown(ctx, chatID, renderForecast(forecast, view), replyTo, view.Locale)
+	return err
+}
+
+func (b *Bot) sendForecastChart(ctx context.Context, chatID int64, forecast *fetch.Forecast, v forecastView, replyTo *telegramBotModels.ReplyParameters) error {
+	chart, err := renderForecastChart(forecast, v)
+	if err != nil {
+		return err
+	}
+	_, err = b.bot.SendPhoto(ctx, &telegramBot.SendPhotoParams{
+		ChatID:          chatID,
+		Photo:           &telegramBotModels.InputFileUpload{Filename: "forecast.png", Data: bytes.NewReader(chart)},
+		Caption:         renderChartCaption(forecast, v),
+		ReplyParameters: replyTo,
+	})
+	return err
+}
+
+// /////////////////////////////////////////////////////////////////////////////
+// Picking one of the places of the same name
+// /////////////////////////////////////////////////////////////////////////////
+
+type locationPickKey struct {
+	chatID    int64
+	messageID int
+}
+
+// pickPurpose tells what to do with the picked place, the query of a watch or a subscription
+// is not a complete forecast query
+type pickPurpose int
+
+const (
+	pickForecast pickPurpose = iota
+	pickWatch
+	pickSubscription
+)
+
+type locationPick struct {
+	userID     int64
+	query      fetch.WeatherQuery
+	output     string
+	purpose    pickPurpose
+	candidates []fetch.Location
+	created    time.Time
+}
+
+// locationPicks keeps the keyboards waiting for an answer in memory, they are dropped
+// after locationPickTTL or on restart and the user has to send the command again
+type locationPicks struct {
+	mu    sync.Mutex
+	picks map[locationPickKey]*locationPick
+	now   func() time.Time
+}
+
+func newLocationPicks() *locationPicks {
+	return &locationPicks{
+		picks: make(map[locationPickKey]*locationPick),
+		now:   time.Now,
+	}
+}
+
+func (p *locationPicks) add(key locationPickKey, pick *locationPick) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for k, existing := range p.picks {
+		if p.now().Sub(existing.created) > locationPickTTL {
+			delete(p.picks, k)
+		}
+	}
+	pick.created = p.now()
+	p.picks[key] = pick
+}
+
+func (p *locationPicks) get(key locationPickKey) (*locationPick, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pick, ok := p.picks[key]
+	if !ok || p.now().Sub(pick.created) > locationPickTTL {
+		delete(p.picks, key)
+		return nil, false
+	}
+	return pick, true
+}
+
+func (p *locationPicks) remove(key locationPickKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.picks, key)
+}
+
+// locationKeyboard lists the candidates one per row, the callback data is the index
+func locationKeyboard(candidates []fetch.Location) *telegramBotModels.InlineKeyboardMarkup {
+	rows := make([][]telegramBotModels.InlineKeyboardButton, len(candidates))
+	for i, l := range candidates {
+		rows[i] = []telegramBotModels.InlineKeyboardButton{{
+			Text:         l.Label(),
+			CallbackData: locationPickPrefix + strconv.Itoa(i),
+		}}
+	}
+	return &telegramBotModels.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// askLocation sends the keyboard with the candidates of the pick and keeps the pick until
+// the user answers
+func (b *Bot) askLocation(ctx context.Context, chatID int64, pick *locationPick, replyTo *telegramBotModels.ReplyParameters) error {
+	msg, err := b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+		ChatID:          chatID,
+		Text:            b.userLocale(ctx, pick.userID, pick.query.Language).T("weather.ambiguous", pick.candidates[0].Name),
+		ReplyMarkup:     locationKeyboard(pick.candidates),
+		ReplyParameters: replyTo,
+	})
+	if err != nil {
+		b.logger.Error().Err(err).Msg("Failed to send location keyboard")
+		return err
+	}
+	b.picks.add(locationPickKey{chatID: chatID, messageID: msg.ID}, pick)
+	return nil
+}
+
+func isLocationPick(_ *Bot, update *telegramBotModels.Update) bool {
+	return update.CallbackQuery != nil && strings.HasPrefix(update.CallbackQuery.Data, locationPickPrefix)
+}
+
+// locationPickHandlerClosure remembers the picked place for the query of the user, replaces
+// the keyboard with the place and follows up by the purpose of the pick
+func locationPickHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		cq := update.CallbackQuery
+		answer := func(text string) {
+			if _, err := b.bot.AnswerCallbackQuery(ctx, &telegramBot.AnswerCallbackQueryParams{
+				CallbackQueryID: cq.ID,
+				Text:            text,
+			}); err != nil {
+				b.logger.Error().Err(err).Msg("Failed to answer callback query")
+			}
+		}
+		l := b.updateLocale(ctx, update)
+
+		msg := cq.Message.Message
+		if msg == nil {
+			answer(l.T("weather.pick_expired"))
+			return
+		}
+		key := locationPickKey{chatID: msg.Chat.ID, messageID: msg.ID}
+		pick, ok := b.picks.get(key)
+		if !ok {
+			answer(l.T("weather.pick_expired"))
+			return
+		}
+		if pick.userID != cq.From.ID {
+			answer(l.T("weather.pick_not_yours"))
+			return
+		}
+		i, err := strconv.Atoi(strings.TrimPrefix(cq.Data, locationPickPrefix))
+		if err != nil || i < 0 || i >= len(pick.candidates) {
+			answer(l.T("weather.pick_unknown"))
+			return
+		}
+		b.picks.remove(key)
+		answer("")
+
+		location := pick.candidates[i]
+		query := fetch.NormalizeCity(pick.query.City)
+		if err := b.db.SaveLocationChoice(ctx, cq.From.ID, toDatabaseLocation(query, &location)); err != nil {
+			b.logger.Error().Err(err).Msg("Failed to save location choice")
+		}
+
+		// an edit without a reply markup drops the keyboard
+		if _, err := b.bot.EditMessageText(ctx, &telegramBot.EditMessageTextParams{
+			ChatID:    msg.Chat.ID,
+			MessageID: msg.ID,
+			Text:      "📍 " + location.Label(),
+		}); err != nil {
+			b.logger.Error().Err(err).Msg("Failed to edit location keyboard")
+		}
+
+		b.completePick(ctx, msg.Chat.ID, pick, &location)
+	}
+}
+
+// completePick sends the forecast for the picked place, pushes its current alerts to a new
+// watch or confirms the place of a subscription, whose next runs use the saved choice
+func (b *Bot) completePick(ctx context.Context, chatID int64, pick *locationPick, location *fetch.Location) {
+	q := pick.query
+	q.Location = location
+
+	switch pick.purpose {
+	case pickWatch:
+		b.sendWatchedAlerts(ctx, pick.userID, chatID, q)
+	case pickSubscription:
+		if _, err := b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: chatID,
+			Text:   b.userLocale(ctx, pick.userID, q.Language).T("subscription.place", q.City, location.Label()),
+		}); err != nil {
+			b.logger.Error().Err(err).Msg("Failed to confirm subscription location")
+		}
+	default:
+		wf := getFetcher[fetch.Fetchable[fetch.WeatherQuery, *fetch.Forecast]](b, "weather")
+		if wf == nil {
+			return
+		}
+		b.sendForecast(ctx, wf, pick.userID, chatID, q, pick.output, nil)
+	}
+}
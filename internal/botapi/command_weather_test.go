@@ -0,0 +1,198 @@
+package botapi
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+)
+
+func TestLocationKeyboard(t *testing.T) {
+	keyboard := locationKeyboard([]fetch.Location{
+		{Key: "623", Name: "Paris", Region: "Ile-de-France", Country: "France"},
+		{Key: "351", Name: "Paris", Region: "Texas", Country: "United States"},
+	})
+	assert.Equal(t, [][]telegramBotModels.InlineKeyboardButton{
+		{{Text: "Paris, Ile-de-France, France", CallbackData: "wloc:0"}},
+		{{Text: "Paris, Texas, United States", CallbackData: "wloc:1"}},
+	}, keyboard.InlineKeyboard)
+}
+
+func TestLocationPicks(t *testing.T) {
+	now := time.Date(2024, 3, 18, 12, 0, 0, 0, time.UTC)
+	picks := newLocationPicks()
+	picks.now = func() time.Time { return now }
+
+	first := locationPickKey{chatID: 1, messageID: 10}
+	second := locationPickKey{chatID: 1, messageID: 11}
+	picks.add(first, &locationPick{userID: 1, query: fetch.WeatherQuery{City: "paris", Days: 1}})
+
+	pick, ok := picks.get(first)
+	if assert.True(t, ok) {
+		assert.Equal(t, "paris", pick.query.City)
+	}
+	_, ok = picks.get(second)
+	assert.False(t, ok)
+
+	// an expired keyboard is gone and is pruned when another one is added
+	now = now.Add(locationPickTTL + time.Second)
+	_, ok = picks.get(first)
+	assert.False(t, ok)
+
+	picks.add(first, &locationPick{userID: 1})
+	now = now.Add(locationPickTTL + time.Second)
+	picks.add(second, &locationPick{userID: 2})
+	assert.Len(t, picks.picks, 1)
+
+	picks.remove(second)
+	assert.Empty(t, picks.picks)
+}
+
+// recordingFetcher records the valid queries and answers all of them with the result
+type recordingFetcher[Q fetch.Query, R any] struct {
+	mu      sync.Mutex
+	queries []Q
+	result  R
+}
+
+func (rf *recordingFetcher[Q, R]) Set(string, *zerolog.Logger) error {
+	return nil
+}
+
+func (rf *recordingFetcher[Q, R]) Fetch(_ context.Context, q Q) (R, error) {
+	var zero R
+	if err := q.Validate(); err != nil {
+		return zero, err
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.queries = append(rf.queries, q)
+	return rf.result, nil
+}
+
+// noDatabaseDriver fails every connection, the handlers log the errors and go on
+type noDatabaseDriver struct{}
+
+func (noDatabaseDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("no database in the tests")
+}
+
+func init() {
+	sql.Register("botapi-no-database", noDatabaseDriver{})
+}
+
+// newTestBot returns a bot talking to a fake Telegram API, which records the sent texts by
+// method and answers every request with a message
+func newTestBot(t *testing.T, fetchers map[string]any) (*Bot, func() map[string][]string) {
+	var mu sync.Mutex
+	sent := make(map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseMultipartForm(1 << 20)
+		mu.Lock()
+		method := path.Base(r.URL.Path)
+		sent[method] = append(sent[method], r.FormValue("text"))
+		mu.Unlock()
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":5,"type":"private"}}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	tb, err := telegramBot.New("test-token", telegramBot.WithServerURL(server.URL), telegramBot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("error creating bot: %v", err)
+	}
+	db, _ := sql.Open("botapi-no-database", "")
+	logger := zerolog.Nop()
+	b := &Bot{
+		bot:      tb,
+		fetchers: fetchers,
+		picks:    newLocationPicks(),
+		logger:   &logger,
+		db:       database.NewDatabaseFromDB(db),
+	}
+	return b, func() map[string][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return sent
+	}
+}
+
+func TestLocationPickHandler(t *testing.T) {
+	candidates := []fetch.Location{
+		{Key: "623", Name: "Paris", Region: "Ile-de-France", Country: "France"},
+		{Key: "351", Name: "Paris", Region: "Texas", Country: "United States"},
+	}
+	pickUpdate := &telegramBotModels.Update{CallbackQuery: &telegramBotModels.CallbackQuery{
+		ID:      "1",
+		From:    telegramBotModels.User{ID: 7},
+		Data:    locationPickPrefix + "1",
+		Message: telegramBotModels.MaybeInaccessibleMessage{Message: &telegramBotModels.Message{ID: 10, Chat: telegramBotModels.Chat{ID: 5}}},
+	}}
+	pickKey := locationPickKey{chatID: 5, messageID: 10}
+
+	tests := []struct {
+		name         string
+		pick         *locationPick
+		wantForecast []fetch.WeatherQuery
+		wantAlerts   []fetch.AlertsQuery
+		wantText     string
+	}{
+		{
+			name:         "Forecast",
+			pick:         &locationPick{userID: 7, query: fetch.WeatherQuery{City: "paris", Days: 3}, purpose: pickForecast, candidates: candidates},
+			wantForecast: []fetch.WeatherQuery{{City: "paris", Days: 3, Location: &candidates[1]}},
+			wantText:     "Paris",
+		},
+		{
+			name:       "Watch pushes the alerts and sends no forecast",
+			pick:       &locationPick{userID: 7, query: fetch.WeatherQuery{City: "paris"}, purpose: pickWatch, candidates: candidates},
+			wantAlerts: []fetch.AlertsQuery{{City: "paris", Location: &candidates[1], Language: "en"}},
+			wantText:   "Watching Paris, Texas, United States for severe weather alerts, there are no alerts at the moment",
+		},
+		{
+			name:     "Subscription only confirms the place",
+			pick:     &locationPick{userID: 7, query: fetch.WeatherQuery{City: "paris", Days: 1}, purpose: pickSubscription, candidates: candidates},
+			wantText: "Your subscriptions for paris use Paris, Texas, United States",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := &recordingFetcher[fetch.WeatherQuery, *fetch.Forecast]{result: &fetch.Forecast{
+				Location: "Paris",
+				Daily:    []fetch.DailyForecast{{Date: time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC), MinTemp: 4, MaxTemp: 12}},
+			}}
+			af := &recordingFetcher[fetch.AlertsQuery, []fetch.Alert]{}
+			b, sent := newTestBot(t, map[string]any{
+				"weather": fetch.Fetchable[fetch.WeatherQuery, *fetch.Forecast](wf),
+				"alerts":  fetch.Fetchable[fetch.AlertsQuery, []fetch.Alert](af),
+			})
+			b.picks.add(pickKey, tt.pick)
+
+			locationPickHandlerClosure(b)(context.Background(), b.bot, pickUpdate)
+
+			assert.Equal(t, tt.wantForecast, wf.queries)
+			assert.Equal(t, tt.wantAlerts, af.queries)
+			assert.Equal(t, []string{"📍 Paris, Texas, United States"}, sent()["editMessageText"])
+			if texts := sent()["sendMessage"]; assert.Len(t, texts, 1) {
+				assert.Contains(t, texts[0], tt.wantText)
+			}
+			_, ok := b.picks.get(pickKey)
+			assert.False(t, ok, "the pick is answered once")
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package botapi
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+	"github.com/pkg/errors"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+// Command describes a bot command. Handlers, /help output and authorization are all derived from it
+type Command struct {
+	Name    string
+	Aliases []string
+	MinRole UserRole
+	// Args declares the arguments, they are parsed before the handler is called which gets
+	// them with commandArgs, the usage in /help and in the errors is rendered from them
+	Args ArgSpec
+	// Help is the message ID of the description in /help, e.g. "help.weather"
+	Help string
+	// Fetchers lists the fetchers the command needs, the command is disabled if any of them is not configured
+	Fetchers []string
+	Handler  func(b *Bot) telegramBot.HandlerFunc
+}
+
+// MessageHandler handles updates that are not commands, e.g. replies to the bot messages
+type MessageHandler struct {
+	Name     string
+	MinRole  UserRole
+	Fetchers []string
+	Match    func(b *Bot, update *telegramBotModels.Update) bool
+	Handler  func(b *Bot) telegramBot.HandlerFunc
+}
+
+// FetcherSpec describes how to build a fetcher and which env key it requires
+type FetcherSpec struct {
+	Name   string
+	EnvKey string
+	New    func(b *Bot, apiKey string) (any, error)
+}
+
+// errFetcherDisabled is returned by FetcherSpec.New when the fetcher has nothing to work with
+var errFetcherDisabled = errors.New("fetcher is not configured")
+
+var (
+	commandRegistry        []*Command
+	messageHandlerRegistry []*MessageHandler
+	fetcherRegistry        []*FetcherSpec
+)
+
+func registerCommand(c *Command) {
+	for _, existing := range commandRegistry {
+		if existing.Name == c.Name {
+			panic(fmt.Sprintf("command /%s is registered twice", c.Name))
+		}
+	}
+	if err := c.Args.validate(); err != nil {
+		panic(fmt.Sprintf("command /%s has invalid arguments: %v", c.Name, err))
+	}
+	commandRegistry = append(commandRegistry, c)
+}
+
+// commandMinRole returns the role the command requires, the jobs running on behalf of a user
+// check it again since the user may have lost the role since. Unknown commands need an admin
+func commandMinRole(name string) UserRole {
+	for _, c := range commandRegistry {
+		if c.Name == name {
+			return c.MinRole
+		}
+	}
+	return AdminUser
+}
+
+func registerMessageHandler(h *MessageHandler) {
+	messageHandlerRegistry = append(messageHandlerRegistry, h)
+}
+
+func registerFetcher(spec *FetcherSpec) {
+	for _, existing := range fetcherRegistry {
+		if existing.Name == spec.Name {
+			panic(fmt.Sprintf("fetcher %s is registered twice", spec.Name))
+		}
+	}
+	fetcherRegistry = append(fetcherRegistry, spec)
+}
+
+// getFetcher returns the configured fetcher with the given name or nil if it is disabled
+func getFetcher[F any](b *Bot, name string) F {
+	f, _ := b.fetchers[name].(F)
+	return f
+}
+
+func (c *Command) usage() string {
+	if len(c.Args) == 0 {
+		return "/" + c.Name
+	}
+	return "/" + c.Name + " " + c.Args.Usage()
+}
+
+func (c *Command) enabled(b *Bot) bool {
+	return b.fetchersEnabled(c.Fetchers)
+}
+
+func (b *Bot) fetchersEnabled(names []string) bool {
+	for _, name := range names {
+		if _, ok := b.fetchers[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Bot) setFetchers() error {
+	for _, spec := range fetcherRegistry {
+		apiKey := ""
+		if spec.EnvKey != "" {
+			apiKey = os.Getenv(spec.EnvKey)
+			if apiKey == "" {
+				b.logger.Warn().Str("fetcher", spec.Name).Msgf("%s is not set, fetcher is disabled", spec.EnvKey)
+				continue
+			}
+		}
+
+		f, err := spec.New(b, apiKey)
+		if errors.Is(err, errFetcherDisabled) {
+			b.logger.Warn().Str("fetcher", spec.Name).Msg("fetcher is not configured and is disabled")
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error setting %s fetcher", spec.Name)
+		}
+		b.fetchers[spec.Name] = f
+	}
+	return nil
+}
+
+func (b *Bot) setHandlers() {
+	for _, c := range commandRegistry {
+		var handler telegramBot.HandlerFunc
+		if c.enabled(b) {
+			handler = c.Handler(b)
+			if len(c.Args) > 0 {
+				handler = argsMiddleware(b, c, handler)
+			}
+			handler = authorizationMiddleware(b, handler, c.MinRole)
+		} else {
+			b.logger.Warn().Str("command", c.Name).Msg("command is disabled, required fetchers are not configured")
+			handler = disabledCommandHandler(b, c)
+		}
+
+		names := append([]string{c.Name}, c.Aliases...)
+		b.handlers[c.Name] = b.bot.RegisterHandlerMatchFunc(matchCommand(names, b.username), handler)
+	}
+
+	for _, h := range messageHandlerRegistry {
+		if !b.fetchersEnabled(h.Fetchers) {
+			b.logger.Warn().Str("handler", h.Name).Msg("message handler is disabled, required fetchers are not configured")
+			continue
+		}
+		match := h.Match
+		b.handlers[h.Name] = b.bot.RegisterHandlerMatchFunc(func(update *telegramBotModels.Update) bool {
+			return match(b, update)
+		}, authorizationMiddleware(b, h.Handler(b), h.MinRole))
+	}
+}
+
+// commandName extracts the command from the message text, stripping the optional @botname suffix.
+// A command addressed to another bot, e.g. /weather@otherbot in a group, has no name
+func commandName(text, username string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+	name, bot, addressed := strings.Cut(strings.TrimPrefix(fields[0], "/"), "@")
+	if addressed && !strings.EqualFold(bot, username) {
+		return ""
+	}
+	return strings.ToLower(name)
+}
+
+// commandPayload returns the text after the command token
+func commandPayload(text string) string {
+	text = strings.TrimSpace(text)
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimSpace(text[i:])
+}
+
+// parseIDOrAll parses the "<id|all>" argument of the commands deleting the items of the user,
+// all is 0
+func parseIDOrAll(arg string) (int64, bool) {
+	arg = strings.TrimPrefix(arg, "#")
+	if strings.EqualFold(arg, "all") {
+		return 0, true
+	}
+	id, err := strconv.ParseInt(arg, 10, 64)
+	return id, err == nil && id > 0
+}
+
+func matchCommand(names []string, username string) telegramBot.MatchFunc {
+	return func(update *telegramBotModels.Update) bool {
+		if update.Message == nil {
+			return false
+		}
+		name := commandName(update.Message.Text, username)
+		for _, n := range names {
+			if name == n {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func disabledCommandHandler(b *Bot, c *Command) telegramBot.HandlerFunc {
+	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
+		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   b.updateLocale(ctx, update).T("bot.not_available", c.Name),
+		})
+	}
+}
+
+// helpText lists the enabled commands, admin commands are shown to admins only
+func (b *Bot) helpText(role UserRole, l i18n.Localizer) string {
+	maxRole := max(role, PromotedUser)
+	commands := make([]*Command, 0, len(commandRegistry))
+	for _, c := range commandRegistry {
+		if c.enabled(b) && c.MinRole <= maxRole {
+			commands = append(commands, c)
+		}
+	}
+	sort.SliceStable(commands, func(i, j int) bool {
+		if commands[i].MinRole != commands[j].MinRole {
+			return commands[i].MinRole < commands[j].MinRole
+		}
+		return commands[i].Name < commands[j].Name
+	})
+
+	var r strings.Builder
+	r.WriteString(l.T("bot.available_commands"))
+	for _, c := range commands {
+		r.WriteString(fmt.Sprintf("\n%s - %s", c.usage(), l.T(c.Help)))
+		if c.MinRole > RegularUser {
+			r.WriteString(fmt.Sprintf(" (%s)", l.T(c.MinRole.messageID())))
+		}
+	}
+	return r.String()
+}
@@ -0,0 +1,23 @@
+package botapi
+
+import (
+	"testing"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandName(t *testing.T) {
+	assert.Equal(t, "weather", commandName("/Weather berlin", "supernova_bot"))
+	assert.Equal(t, "weather", commandName("/weather@Supernova_Bot berlin", "supernova_bot"))
+	assert.Equal(t, "", commandName("/weather@other_bot berlin", "supernova_bot"))
+	assert.Equal(t, "", commandName("weather berlin", "supernova_bot"))
+	assert.Equal(t, "", commandName("", "supernova_bot"))
+}
+
+func TestCommandHelp(t *testing.T) {
+	en := i18n.For("en")
+	for _, c := range commandRegistry {
+		assert.NotEqual(t, c.Help, en.T(c.Help), c.Name)
+	}
+}
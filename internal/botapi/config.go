@@ -0,0 +1,42 @@
+package botapi
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// /////////////////////////////////////////////////////////////////////////////
+// Optional env settings, invalid or missing values fall back to defaults
+// /////////////////////////////////////////////////////////////////////////////
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envFloat(key string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
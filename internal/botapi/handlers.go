@@ -2,41 +2,55 @@ package botapi
 
 import (
 	"context"
-	"fmt"
-	"strconv"
-	"strings"
+	"time"
 
 	telegramBot "github.com/go-telegram/bot"
 	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
 )
 
-// /////////////////////////////////////////////////////////////////////////////
-// Raw handlers
-// /////////////////////////////////////////////////////////////////////////////
+// upper bound for a single upstream fetch triggered by a command
+const fetchTimeout = 30 * time.Second
 
-func defaultHandler(ctx context.Context, b *telegramBot.Bot, update *telegramBotModels.Update) {
-	b.SendMessage(ctx, &telegramBot.SendMessageParams{
-		ChatID: update.Message.Chat.ID,
-		Text:   "Type /help to get a list of available commands",
+func init() {
+	registerCommand(&Command{
+		Name:    "help",
+		MinRole: RegularUser,
+		Help:    "help.help",
+		Handler: helpHandlerClosure,
 	})
-}
-
-func helpHandler(ctx context.Context, b *telegramBot.Bot, update *telegramBotModels.Update) {
-	// TODO: update this message with the actual available commands
-	b.SendMessage(ctx, &telegramBot.SendMessageParams{
-		ChatID: update.Message.Chat.ID,
-		Text: "Available commands: " +
-			"\n/help - get a list of available commands" +
-			"\n/getid - get your user ID" +
-			"\n/weather <city> <N> days|hours - get weather forecast for the city for N days or hours (PROMOTED USER)" +
-			"\n/chat <prompt> - get a chatgpt response to the prompt (PROMOTED USER)",
+	registerCommand(&Command{
+		Name:    "getid",
+		MinRole: RegularUser,
+		Help:    "help.getid",
+		Handler: getIDHandlerClosure,
+	})
+	registerCommand(&Command{
+		Name:    "allow",
+		MinRole: AdminUser,
+		Args:    ArgSpec{{Name: "user_id", Kind: IntArg, Min: 1}},
+		Help:    "help.allow",
+		Handler: allowHandlerClosure,
 	})
 }
 
-func getIDHandler(ctx context.Context, b *telegramBot.Bot, update *telegramBotModels.Update) {
+// /////////////////////////////////////////////////////////////////////////////
+// Raw handlers
+// /////////////////////////////////////////////////////////////////////////////
+
+func defaultHandler(ctx context.Context, b *telegramBot.Bot, update *telegramBotModels.Update) {
+	// e.g. edited messages or buttons of keyboards the bot no longer handles
+	if update.Message == nil {
+		if update.CallbackQuery != nil {
+			b.AnswerCallbackQuery(ctx, &telegramBot.AnswerCallbackQueryParams{CallbackQueryID: update.CallbackQuery.ID})
+		}
+		return
+	}
+	// the user settings are out of reach here, the language of the Telegram app has to do
 	b.SendMessage(ctx, &telegramBot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
-		Text:   fmt.Sprintf("Your ID is: %d", update.Message.From.ID),
+		Text:   i18n.For(updateLanguageCode(update)).T("bot.help_hint"),
 	})
 }
 
@@ -44,174 +58,53 @@ func getIDHandler(ctx context.Context, b *telegramBot.Bot, update *telegramBotMo
 // Custom closures
 // /////////////////////////////////////////////////////////////////////////////
 
-func weatherHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+func getIDHandlerClosure(b *Bot) telegramBot.HandlerFunc {
 	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
-		wf := b.fetchers["weather"]
-		if wf == nil {
-			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "Weather fetcher is not available",
-			})
-			return
-		}
-
-		go func() {
-			if err := b.db.LogUserActivity(update.Message.From.ID, update.Message.Text); err != nil {
-				b.logger.Error().Err(err).Msg("Failed to log user activity")
-			}
-		}()
-
-		// example: "/weather london (any case) 5 days" or "/weather london 12 hours"
-		messageParts := strings.Fields(update.Message.Text)
-
-		if len(messageParts) < 4 {
-			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "Please provide a city and forecast type (days or hours). Example: /weather london 5 days",
-			})
-			return
-		}
-
-		city := messageParts[1]
-		periodType := strings.ToLower(messageParts[3])
-
-		qParams := map[string]interface{}{
-			"city": city,
-		}
-
-		if strings.Contains(periodType, "day") {
-			days, err := strconv.Atoi(messageParts[2])
-			if err != nil || days < 1 {
-				b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-					ChatID: update.Message.Chat.ID,
-					Text:   "Invalid number of days. Please provide a valid number from 1 to 5 (more is truncated)",
-				})
-				return
-			}
-			qParams["days"] = days
-		} else if strings.Contains(periodType, "hour") {
-			hours, err := strconv.Atoi(messageParts[2])
-			if err != nil || hours < 1 {
-				b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-					ChatID: update.Message.Chat.ID,
-					Text:   "Invalid number of hours. Please provide a valid number from 1 to 12 (more is truncated)",
-				})
-				return
-			}
-			qParams["hours"] = hours
-		} else {
-			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "Please specify either 'days' or 'hours'. Example: /weather london 3 days",
-			})
-			return
-		}
-
-		r, err := wf.Fetch(qParams)
-		if err != nil {
-			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   fmt.Sprintf("Failed to fetch weather: %v", err),
-			})
-			return
-		}
-
 		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
-			Text:   r,
+			Text:   b.updateLocale(ctx, update).T("bot.your_id", update.Message.From.ID),
 		})
 	}
 }
 
-func allowHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+func helpHandlerClosure(b *Bot) telegramBot.HandlerFunc {
 	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
-		go func() {
-			if err := b.db.LogUserActivity(update.Message.From.ID, update.Message.Text); err != nil {
-				b.logger.Error().Err(err).Msg("Failed to log user activity")
-			}
-		}()
-
-		if b.getUserRole(update.Message.From.ID) != AdminUser {
-			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "You are not authorized to use this command",
-			})
-			return
-		}
-
-		args := strings.Fields(update.Message.Text)
-		if len(args) != 2 {
-			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "Usage: /allow <user_id>",
-			})
-			return
-		}
-
-		userID, err := strconv.ParseInt(args[1], 10, 64)
-		if err != nil {
-			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "Invalid user ID. Please provide a valid numeric ID",
-			})
-			return
-		}
-
-		err = b.db.AllowUser(userID)
-		if err != nil {
-			b.logger.Error().Err(err).Msg("Failed to allow user")
-			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "Failed to allow user. Please try again later",
-			})
-			return
-		}
-
-		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-			ChatID: update.Message.Chat.ID,
-			Text:   fmt.Sprintf("User with ID %d has been allowed to use admin commands", userID),
-		})
+		l := b.updateLocale(ctx, update)
+		b.sendText(ctx, update.Message.Chat.ID, b.helpText(b.getUserRole(update.Message.From.ID), l), nil, l)
 	}
 }
 
-func chatHandlerClosure(b *Bot) telegramBot.HandlerFunc {
+func allowHandlerClosure(b *Bot) telegramBot.HandlerFunc {
 	return func(ctx context.Context, _ *telegramBot.Bot, update *telegramBotModels.Update) {
-		cf := b.fetchers["chat"]
-		if cf == nil {
-			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "Chat fetcher is not available",
-			})
-			return
-		}
-
 		go func() {
 			if err := b.db.LogUserActivity(update.Message.From.ID, update.Message.Text); err != nil {
 				b.logger.Error().Err(err).Msg("Failed to log user activity")
 			}
 		}()
 
-		prompt := strings.TrimPrefix(update.Message.Text, "/chat ")
-		if prompt == "" {
+		l := b.updateLocale(ctx, update)
+		if b.getUserRole(update.Message.From.ID) != AdminUser {
 			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
 				ChatID: update.Message.Chat.ID,
-				Text:   "Please provide a message after /chat command.",
+				Text:   l.T("bot.not_authorized"),
 			})
 			return
 		}
 
-		response, err := cf.Fetch(map[string]interface{}{"prompt": prompt})
+		userID := commandArgs(ctx).Int64("user_id")
+		err := b.db.AllowUser(userID)
 		if err != nil {
+			b.logger.Error().Err(err).Msg("Failed to allow user")
 			b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
 				ChatID: update.Message.Chat.ID,
-				Text:   fmt.Sprintf("Error: %v", err),
+				Text:   l.T("bot.allow_failed"),
 			})
 			return
 		}
 
 		b.bot.SendMessage(ctx, &telegramBot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
-			Text:   response,
+			Text:   l.T("bot.allowed", userID),
 		})
 	}
 }
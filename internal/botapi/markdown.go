@@ -0,0 +1,179 @@
+package botapi
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// /////////////////////////////////////////////////////////////////////////////
+// Markdown to Telegram HTML, HTML is used rather than MarkdownV2 since it only
+// needs <, > and & escaped and survives unbalanced markers in LLM answers
+// /////////////////////////////////////////////////////////////////////////////
+
+var (
+	htmlEscaper   = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+	headingRegexp = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	bulletRegexp  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+)
+
+func escapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+// markdownToHTML converts the Markdown subset LLMs use: code blocks, inline code, bold, italic,
+// strikethrough, links, headings and bullet lists. Everything else is escaped and unmatched
+// markers are kept as they are
+func markdownToHTML(md string) string {
+	var lines, code []string
+	inCode := false
+	lang := ""
+	for _, line := range strings.Split(md, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, codeFence) && !inCode:
+			inCode, lang, code = true, strings.TrimSpace(strings.TrimPrefix(trimmed, codeFence)), nil
+		case strings.HasPrefix(trimmed, codeFence):
+			inCode = false
+			lines = append(lines, renderCodeBlock(lang, code))
+		case inCode:
+			code = append(code, line)
+		default:
+			lines = append(lines, renderMarkdownLine(line))
+		}
+	}
+	if inCode {
+		lines = append(lines, renderCodeBlock(lang, code))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func renderCodeBlock(lang string, code []string) string {
+	open := "<pre><code>"
+	if lang != "" {
+		open = `<pre><code class="language-` + escapeHTML(lang) + `">`
+	}
+	return open + escapeHTML(strings.Join(code, "\n")) + "</code></pre>"
+}
+
+func renderMarkdownLine(line string) string {
+	if m := headingRegexp.FindStringSubmatch(line); m != nil {
+		return "<b>" + renderInline(m[1]) + "</b>"
+	}
+	if m := bulletRegexp.FindStringSubmatch(line); m != nil {
+		return m[1] + "• " + renderInline(m[2])
+	}
+	return renderInline(line)
+}
+
+// inlineStyles are tried in order, the longer markers first
+var inlineStyles = []struct {
+	marker string
+	tag    string
+}{
+	{"**", "b"},
+	{"__", "b"},
+	{"~~", "s"},
+	{"*", "i"},
+	{"_", "i"},
+}
+
+func renderInline(s string) string {
+	var r strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] == '`' {
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				r.WriteString("<code>" + escapeHTML(s[i+1:i+1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+		}
+
+		if s[i] == '[' {
+			if text, url, n, ok := markdownLink(s[i:]); ok {
+				r.WriteString(`<a href="` + escapeHTML(url) + `">` + renderInline(text) + "</a>")
+				i += n
+				continue
+			}
+		}
+
+		styled := false
+		for _, style := range inlineStyles {
+			if !strings.HasPrefix(s[i:], style.marker) {
+				continue
+			}
+			if inner, ok := delimited(s, i, style.marker); ok {
+				r.WriteString("<" + style.tag + ">" + renderInline(inner) + "</" + style.tag + ">")
+				i += len(inner) + 2*len(style.marker)
+				styled = true
+			}
+			break
+		}
+		if styled {
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(s[i:])
+		r.WriteString(escapeHTML(s[i : i+size]))
+		i += size
+	}
+	return r.String()
+}
+
+// delimited returns the text between the marker at i and its closing marker. The text may not
+// start or end with a space so that "2 * 3 * 4" stays as it is, underscores also have to be
+// on word boundaries so that snake_case_names stay as they are
+func delimited(s string, i int, marker string) (string, bool) {
+	start := i + len(marker)
+	if start >= len(s) || s[start] == ' ' {
+		return "", false
+	}
+	if marker[0] == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", false
+	}
+
+	for end := start + 1; end <= len(s)-len(marker); end++ {
+		if !strings.HasPrefix(s[end:], marker) || s[end-1] == ' ' {
+			continue
+		}
+		// a longer run like ** is not the end of a single *
+		if strings.HasPrefix(s[end+len(marker):], marker[:1]) && len(marker) == 1 {
+			end++
+			continue
+		}
+		if marker[0] == '_' && end+len(marker) < len(s) && isWordByte(s[end+len(marker)]) {
+			continue
+		}
+		return s[start:end], true
+	}
+	return "", false
+}
+
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// markdownLink parses [text](url) at the start of s, only web links are accepted
+func markdownLink(s string) (text, url string, n int, ok bool) {
+	closeText := strings.Index(s, "](")
+	if closeText < 2 {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(s[closeText+2:], ')')
+	if closeURL < 0 {
+		return "", "", 0, false
+	}
+	text, url = s[1:closeText], s[closeText+2:closeText+2+closeURL]
+	if strings.ContainsAny(text, "[]") || !(strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://")) {
+		return "", "", 0, false
+	}
+	return text, url, closeText + 3 + closeURL, true
+}
+
+// htmlToPlain drops the tags for the plain text fallback
+func htmlToPlain(s string) string {
+	return html.UnescapeString(htmlTagRegexp.ReplaceAllString(s, ""))
+}
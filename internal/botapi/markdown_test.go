@@ -0,0 +1,81 @@
+package botapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{
+			name: "Escaping",
+			md:   `if a < b && c > "d"`,
+			want: "if a &lt; b &amp;&amp; c &gt; &quot;d&quot;",
+		},
+		{
+			name: "Bold, italic and strikethrough",
+			md:   "**bold** __bold__ *italic* _italic_ ~~gone~~",
+			want: "<b>bold</b> <b>bold</b> <i>italic</i> <i>italic</i> <s>gone</s>",
+		},
+		{
+			name: "Nested styles",
+			md:   "**bold with *italic* inside**",
+			want: "<b>bold with <i>italic</i> inside</b>",
+		},
+		{
+			name: "Unmatched and spaced markers",
+			md:   "2 * 3 * 4 and **open",
+			want: "2 * 3 * 4 and **open",
+		},
+		{
+			name: "Snake case",
+			md:   "call snake_case_name now",
+			want: "call snake_case_name now",
+		},
+		{
+			name: "Inline code is not formatted",
+			md:   "run `go test **/*_test.go` <now>",
+			want: "run <code>go test **/*_test.go</code> &lt;now&gt;",
+		},
+		{
+			name: "Links",
+			md:   "see [the **docs**](https://go.dev/doc?a=1&b=2) or [local](file:///etc)",
+			want: `see <a href="https://go.dev/doc?a=1&amp;b=2">the <b>docs</b></a> or [local](file:///etc)`,
+		},
+		{
+			name: "Headings and bullets",
+			md:   "## Steps\n- first\n  * second",
+			want: "<b>Steps</b>\n• first\n  • second",
+		},
+		{
+			name: "Code block",
+			md:   "Example:\n```go\nif a < b {\n\t**x**\n}\n```\nDone",
+			want: "Example:\n<pre><code class=\"language-go\">if a &lt; b {\n\t**x**\n}</code></pre>\nDone",
+		},
+		{
+			name: "Unclosed code block",
+			md:   "```\nx := 1",
+			want: "<pre><code>x := 1</code></pre>",
+		},
+		{
+			name: "Unicode",
+			md:   "**Grüße** 👋 _früh_",
+			want: "<b>Grüße</b> 👋 <i>früh</i>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, markdownToHTML(tt.md))
+		})
+	}
+}
+
+func TestHTMLToPlain(t *testing.T) {
+	assert.Equal(t, "bold a < b\ncode", htmlToPlain(markdownToHTML("**bold** a < b\n```\ncode\n```")))
+}
@@ -9,14 +9,53 @@ import (
 
 func authorizationMiddleware(b *Bot, handler telegramBot.HandlerFunc, minRole UserRole) telegramBot.HandlerFunc {
 	return func(ctx context.Context, bot *telegramBot.Bot, update *telegramBotModels.Update) {
-		userRole := b.getUserRole(update.Message.From.ID)
+		userID, chatID, ok := updateSender(update)
+		if !ok {
+			return
+		}
+
+		userRole := b.getUserRole(userID)
 		if userRole >= minRole {
 			handler(ctx, bot, update)
+		} else if update.CallbackQuery != nil {
+			bot.AnswerCallbackQuery(ctx, &telegramBot.AnswerCallbackQueryParams{
+				CallbackQueryID: update.CallbackQuery.ID,
+				Text:            b.updateLocale(ctx, update).T("bot.not_authorized"),
+			})
 		} else {
 			bot.SendMessage(ctx, &telegramBot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "You are not authorized to use this command.",
+				ChatID: chatID,
+				Text:   b.updateLocale(ctx, update).T("bot.not_authorized"),
 			})
 		}
 	}
 }
+
+// updateSender returns the user and the chat of a message or of a callback query from an
+// inline keyboard, other updates, e.g. channel posts, have no sender to authorize
+func updateSender(update *telegramBotModels.Update) (userID, chatID int64, ok bool) {
+	if m := update.Message; m != nil && m.From != nil {
+		return m.From.ID, m.Chat.ID, true
+	}
+	if q := update.CallbackQuery; q != nil {
+		switch {
+		case q.Message.Message != nil:
+			return q.From.ID, q.Message.Message.Chat.ID, true
+		case q.Message.InaccessibleMessage != nil:
+			return q.From.ID, q.Message.InaccessibleMessage.Chat.ID, true
+		}
+	}
+	return 0, 0, false
+}
+
+// updateLanguageCode returns the IETF language tag of the Telegram app of the sender, e.g. "de-AT",
+// Telegram does not always send it
+func updateLanguageCode(update *telegramBotModels.Update) string {
+	if m := update.Message; m != nil && m.From != nil {
+		return m.From.LanguageCode
+	}
+	if q := update.CallbackQuery; q != nil {
+		return q.From.LanguageCode
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package botapi
+
+import (
+	"testing"
+
+	telegramBotModels "github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateSender(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     *telegramBotModels.Update
+		wantUserID int64
+		wantChatID int64
+		wantOK     bool
+	}{
+		{
+			name: "Message",
+			update: &telegramBotModels.Update{Message: &telegramBotModels.Message{
+				From: &telegramBotModels.User{ID: 1},
+				Chat: telegramBotModels.Chat{ID: 2},
+			}},
+			wantUserID: 1,
+			wantChatID: 2,
+			wantOK:     true,
+		},
+		{
+			name: "Callback query",
+			update: &telegramBotModels.Update{CallbackQuery: &telegramBotModels.CallbackQuery{
+				From: telegramBotModels.User{ID: 1},
+				Message: telegramBotModels.MaybeInaccessibleMessage{
+					Message: &telegramBotModels.Message{Chat: telegramBotModels.Chat{ID: 2}},
+				},
+			}},
+			wantUserID: 1,
+			wantChatID: 2,
+			wantOK:     true,
+		},
+		{
+			name: "Callback query of an old message",
+			update: &telegramBotModels.Update{CallbackQuery: &telegramBotModels.CallbackQuery{
+				From: telegramBotModels.User{ID: 1},
+				Message: telegramBotModels.MaybeInaccessibleMessage{
+					Type:                telegramBotModels.MaybeInaccessibleMessageTypeInaccessibleMessage,
+					InaccessibleMessage: &telegramBotModels.InaccessibleMessage{Chat: telegramBotModels.Chat{ID: 2}},
+				},
+			}},
+			wantUserID: 1,
+			wantChatID: 2,
+			wantOK:     true,
+		},
+		{
+			name:   "Channel post",
+			update: &telegramBotModels.Update{Message: &telegramBotModels.Message{Chat: telegramBotModels.Chat{ID: 2}}},
+		},
+		{
+			name:   "Edited message",
+			update: &telegramBotModels.Update{EditedMessage: &telegramBotModels.Message{From: &telegramBotModels.User{ID: 1}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, chatID, ok := updateSender(tt.update)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantUserID, userID)
+			assert.Equal(t, tt.wantChatID, chatID)
+		})
+	}
+}
+
+func TestUpdateLanguageCode(t *testing.T) {
+	assert.Equal(t, "de-AT", updateLanguageCode(&telegramBotModels.Update{Message: &telegramBotModels.Message{
+		From: &telegramBotModels.User{ID: 1, LanguageCode: "de-AT"},
+	}}))
+	assert.Equal(t, "ru", updateLanguageCode(&telegramBotModels.Update{CallbackQuery: &telegramBotModels.CallbackQuery{
+		From: telegramBotModels.User{ID: 1, LanguageCode: "ru"},
+	}}))
+	assert.Equal(t, "", updateLanguageCode(&telegramBotModels.Update{Message: &telegramBotModels.Message{}}))
+}
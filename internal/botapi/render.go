@@ -0,0 +1,258 @@
+package botapi
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+// /////////////////////////////////////////////////////////////////////////////
+// Text renderers for fetcher results
+// /////////////////////////////////////////////////////////////////////////////
+
+// renderCacheAge tells how old a cached result is, fresh results get no note
+func renderCacheAge(fetchedAt time.Time, l i18n.Localizer) string {
+	if fetchedAt.IsZero() {
+		return ""
+	}
+	age := time.Since(fetchedAt)
+	if age < time.Minute {
+		return ""
+	}
+	return fmt.Sprintf("_%s_\n\n", l.N("forecast.cached", int(age.Minutes())))
+}
+
+func conditionEmoji(c fetch.Condition, daylight bool) string {
+	switch c {
+	case fetch.ConditionClear:
+		if !daylight {
+			return "🌙"
+		}
+		return "☀️"
+	case fetch.ConditionPartlyCloudy:
+		if !daylight {
+			return "☁️"
+		}
+		return "⛅"
+	case fetch.ConditionCloudy:
+		return "☁️"
+	case fetch.ConditionFog:
+		return "🌫"
+	case fetch.ConditionDrizzle:
+		return "🌦"
+	case fetch.ConditionRain:
+		return "🌧"
+	case fetch.ConditionSleet:
+		return "🌨"
+	case fetch.ConditionSnow:
+		return "❄️"
+	case fetch.ConditionThunderstorm:
+		return "⛈"
+	case fetch.ConditionWind:
+		return "💨"
+	default:
+		return "🌡"
+	}
+}
+
+func renderPrecipitation(probability float64) string {
+	if probability <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" 💧%.0f%%", probability)
+}
+
+// forecastView holds the user settings a forecast is rendered with
+type forecastView struct {
+	Imperial bool
+	// TimeZone converts the hourly times, nil keeps the local time of the place
+	TimeZone *time.Location
+	// Locale translates the labels, the zero value is English
+	Locale i18n.Localizer
+}
+
+// temperature converts the Celsius of the forecast model to the units of the user
+func (v forecastView) temperature(celsius float64) float64 {
+	if v.Imperial {
+		return celsius*9/5 + 32
+	}
+	return celsius
+}
+
+func (v forecastView) unit() string {
+	if v.Imperial {
+		return "°F"
+	}
+	return "°C"
+}
+
+// windSpeed converts the km/h of the forecast model to the units of the user
+func (v forecastView) windSpeed(kmh float64) string {
+	if v.Imperial {
+		return v.Locale.T("unit.mph", kmh/1.609344)
+	}
+	return v.Locale.T("unit.kmh", kmh)
+}
+
+// pressure converts the hPa of the forecast model to the units of the user
+func (v forecastView) pressure(hPa float64) string {
+	if v.Imperial {
+		return v.Locale.T("unit.inhg", hPa*0.02953)
+	}
+	return v.Locale.T("unit.hpa", hPa)
+}
+
+// localTime converts the time to the time zone of the user if set
+func (v forecastView) localTime(t time.Time) time.Time {
+	if v.TimeZone != nil {
+		return t.In(v.TimeZone)
+	}
+	return t
+}
+
+// date renders the weekday and the date, e.g. "Mon 18.03"
+func (v forecastView) date(t time.Time) string {
+	return v.Locale.T("weekday."+strings.ToLower(t.Weekday().String()[:3])) + t.Format(" 02.01")
+}
+
+// dateTime renders the weekday, the date and the time as they are, e.g. "Tue 02.07 09:00"
+func dateTime(t time.Time, l i18n.Localizer) string {
+	return forecastView{Locale: l}.date(t) + t.Format(" 15:04")
+}
+
+// phrase keeps the phrase of the provider if it is in the language of the user and names the
+// condition otherwise, e.g. for the Open-Meteo phrases that are always in English
+func (v forecastView) phrase(f *fetch.Forecast, phrase string, c fetch.Condition) string {
+	language := f.Language
+	if language == "" {
+		language = i18n.DefaultLanguage
+	}
+	if phrase != "" && language == v.Locale.Language() {
+		return phrase
+	}
+	return v.Locale.T("condition." + strings.ReplaceAll(strings.ToLower(c.String()), " ", "_"))
+}
+
+var compassPoints = []string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+// compassDirection names the direction the wind blows from
+func compassDirection(degrees float64) string {
+	i := int(math.Round(math.Mod(degrees, 360)/22.5)) % len(compassPoints)
+	if i < 0 {
+		i += len(compassPoints)
+	}
+	return compassPoints[i]
+}
+
+// uvIndexCategory follows the WHO UV index scale
+func uvIndexCategory(index float64) string {
+	switch {
+	case index < 3:
+		return "low"
+	case index < 6:
+		return "moderate"
+	case index < 8:
+		return "high"
+	case index < 11:
+		return "very high"
+	default:
+		return "extreme"
+	}
+}
+
+// renderForecast renders Markdown, one compact line per day or hour
+func renderForecast(f *fetch.Forecast, v forecastView) string {
+	var r strings.Builder
+	r.WriteString(renderCacheAge(f.FetchedAt, v.Locale))
+	if f.Location != "" {
+		r.WriteString(fmt.Sprintf("**%s**\n\n", f.Location))
+	}
+	if len(f.Daily) > 0 {
+		for _, day := range f.Daily {
+			r.WriteString(fmt.Sprintf("**%s** %s %.0f…%.0f%s%s\n",
+				v.date(day.Date), conditionEmoji(day.Day.Condition, true),
+				v.temperature(day.MinTemp), v.temperature(day.MaxTemp), v.unit(), renderPrecipitation(day.PrecipitationProbability)))
+			r.WriteString(v.phrase(f, day.Day.Phrase, day.Day.Condition))
+			if day.Night.Phrase != "" {
+				r.WriteString(fmt.Sprintf(", %s %s %s", v.Locale.T("forecast.night"),
+					conditionEmoji(day.Night.Condition, false), v.phrase(f, day.Night.Phrase, day.Night.Condition)))
+			}
+			r.WriteString("\n\n")
+		}
+	} else {
+		date := ""
+		for _, hour := range f.Hourly {
+			t := v.localTime(hour.Time)
+			if d := v.date(t); d != date {
+				if date != "" {
+					r.WriteString("\n")
+				}
+				if v.TimeZone != nil {
+					r.WriteString(fmt.Sprintf("**%s** (%s)\n", d, t.Format("MST")))
+				} else {
+					r.WriteString(fmt.Sprintf("**%s**\n", d))
+				}
+				date = d
+			}
+			r.WriteString(fmt.Sprintf("`%s` %s %.1f%s%s %s\n",
+				t.Format("15:04"), conditionEmoji(hour.Condition, hour.IsDaylight),
+				v.temperature(hour.Temp), v.unit(), renderPrecipitation(hour.PrecipitationProbability), v.phrase(f, hour.Phrase, hour.Condition)))
+		}
+		r.WriteString("\n")
+	}
+	if f.Source != "" {
+		r.WriteString(fmt.Sprintf("_%s_", v.source(f)))
+	}
+	return r.String()
+}
+
+// renderCurrentConditions renders Markdown, the temperatures first and a line per measurement
+func renderCurrentConditions(f *fetch.Forecast, v forecastView) string {
+	c := f.Current
+	var r strings.Builder
+	r.WriteString(renderCacheAge(f.FetchedAt, v.Locale))
+	if f.Location != "" {
+		r.WriteString(fmt.Sprintf("**%s**\n\n", f.Location))
+	}
+	l := v.Locale
+	r.WriteString(fmt.Sprintf("%s **%.1f%s** %s, %s\n",
+		conditionEmoji(c.Condition, c.IsDaylight), v.temperature(c.Temp), v.unit(), v.phrase(f, c.Phrase, c.Condition),
+		l.T("forecast.feels_like", fmt.Sprintf("%.1f%s", v.temperature(c.FeelsLike), v.unit()))))
+	r.WriteString("💨 " + l.T("forecast.wind", v.windSpeed(c.WindSpeed), l.T("compass."+strings.ToLower(compassDirection(c.WindDirection)))) + "\n")
+	r.WriteString("💧 " + l.T("forecast.humidity", c.Humidity) + "\n")
+	r.WriteString("🔆 " + l.T("forecast.uv_index", c.UVIndex, l.T("uv."+strings.ReplaceAll(uvIndexCategory(c.UVIndex), " ", "_"))) + "\n")
+	r.WriteString("🧭 " + l.T("forecast.pressure", v.pressure(c.Pressure)) + "\n\n")
+	if !c.Time.IsZero() {
+		t := v.localTime(c.Time)
+		observed := t.Format("15:04")
+		if v.TimeZone != nil {
+			observed += t.Format(" (MST)")
+		}
+		r.WriteString(fmt.Sprintf("_%s_\n", l.T("forecast.observed_at", observed)))
+	}
+	if f.Source != "" {
+		r.WriteString(fmt.Sprintf("_%s_", v.source(f)))
+	}
+	return r.String()
+}
+
+// source names the provider of the forecast and why the providers before it did not answer
+func (v forecastView) source(f *fetch.Forecast) string {
+	source := v.Locale.T("forecast.source", f.Source)
+	if p := f.PlanLimit; p != nil {
+		source += " (" + renderPlanLimit(p, v.Locale) + ")"
+	}
+	return source
+}
+
+func renderPlanLimit(p *fetch.PlanLimitError, l i18n.Localizer) string {
+	limit := l.N("forecast."+p.Unit, p.Max)
+	if p.Plan == "" {
+		return l.T("forecast.provider_limit", p.Provider, limit)
+	}
+	return l.T("forecast.plan_limit", p.Provider, p.Plan, limit)
+}
@@ -0,0 +1,126 @@
+package botapi
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+func TestRenderForecast(t *testing.T) {
+	daily := &fetch.Forecast{
+		Source:   "AccuWeather",
+		Location: "Berlin, DE",
+		Daily: []fetch.DailyForecast{{
+			Date:                     time.Date(2024, 3, 18, 7, 0, 0, 0, time.UTC),
+			MinTemp:                  3.6,
+			MaxTemp:                  12.2,
+			Day:                      fetch.PeriodForecast{Phrase: "Sunny", Condition: fetch.ConditionClear},
+			Night:                    fetch.PeriodForecast{Phrase: "Clear", Condition: fetch.ConditionClear},
+			PrecipitationProbability: 10,
+		}},
+	}
+	assert.Equal(t, "**Berlin, DE**\n\n**Mon 18.03** ☀️ 4…12°C 💧10%\nSunny, night 🌙 Clear\n\n_Source: AccuWeather_", renderForecast(daily, forecastView{}))
+	assert.Contains(t, renderForecast(daily, forecastView{Imperial: true}), "**Mon 18.03** ☀️ 38…54°F 💧10%")
+
+	hourly := &fetch.Forecast{
+		Source: "Open-Meteo",
+		Hourly: []fetch.HourlyForecast{
+			{Time: time.Date(2024, 3, 18, 23, 0, 0, 0, time.UTC), Temp: 5.25, Phrase: "Rain", Condition: fetch.ConditionRain, PrecipitationProbability: 80},
+			{Time: time.Date(2024, 3, 19, 0, 0, 0, 0, time.UTC), Temp: 4.9, Phrase: "Clear", Condition: fetch.ConditionClear},
+		},
+	}
+	assert.Equal(t, "**Mon 18.03**\n`23:00` 🌧 5.2°C 💧80% Rain\n\n**Tue 19.03**\n`00:00` 🌙 4.9°C Clear\n\n_Source: Open-Meteo_", renderForecast(hourly, forecastView{}))
+	assert.Contains(t, markdownToHTML(renderForecast(hourly, forecastView{})), "<code>23:00</code> 🌧 5.2°C")
+
+	// both hours fall on Tuesday in Berlin
+	berlin := time.FixedZone("CET", 3600)
+	assert.Equal(t, "**Tue 19.03** (CET)\n`00:00` 🌧 41.5°F 💧80% Rain\n`01:00` 🌙 40.8°F Clear\n\n_Source: Open-Meteo_",
+		renderForecast(hourly, forecastView{Imperial: true, TimeZone: berlin}))
+
+	// the reply tells why the preferred provider did not answer
+	hourly.PlanLimit = &fetch.PlanLimitError{Provider: "AccuWeather", Plan: "free", Unit: "hours", Requested: 24, Max: 12}
+	assert.True(t, strings.HasSuffix(renderForecast(hourly, forecastView{}), "_Source: Open-Meteo (the AccuWeather free plan covers at most 12 hours)_"))
+	assert.True(t, strings.HasSuffix(renderForecast(hourly, forecastView{Locale: i18n.For("de")}), "_Quelle: Open-Meteo (der Tarif AccuWeather free umfasst höchstens 12 Stunden)_"))
+}
+
+func TestRenderCurrentConditions(t *testing.T) {
+	current := &fetch.Forecast{
+		Source:   "AccuWeather",
+		Location: "Berlin, Germany",
+		Current: &fetch.CurrentConditions{
+			Time:          time.Date(2024, 11, 2, 13, 5, 0, 0, time.UTC),
+			Temp:          11.1,
+			FeelsLike:     9.4,
+			Phrase:        "Cloudy",
+			Condition:     fetch.ConditionCloudy,
+			IsDaylight:    true,
+			Humidity:      71,
+			WindSpeed:     14.8,
+			WindDirection: 293,
+			UVIndex:       1,
+			Pressure:      1014,
+		},
+	}
+	assert.Equal(t, "**Berlin, Germany**\n\n☁️ **11.1°C** Cloudy, feels like 9.4°C\n💨 Wind 15 km/h WNW\n💧 Humidity 71%\n"+
+		"🔆 UV index 1, low\n🧭 Pressure 1014 hPa\n\n_Observed at 13:05_\n_Source: AccuWeather_",
+		renderCurrentConditions(current, forecastView{}))
+
+	imperial := renderCurrentConditions(current, forecastView{Imperial: true, TimeZone: time.FixedZone("CET", 3600)})
+	assert.Contains(t, imperial, "**52.0°F** Cloudy, feels like 48.9°F")
+	assert.Contains(t, imperial, "Wind 9 mph WNW")
+	assert.Contains(t, imperial, "Pressure 29.94 inHg")
+	assert.Contains(t, imperial, "_Observed at 14:05 (CET)_")
+}
+
+func TestRenderLocalized(t *testing.T) {
+	daily := &fetch.Forecast{
+		Source: "Open-Meteo",
+		Daily: []fetch.DailyForecast{{
+			Date:    time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC),
+			MinTemp: 3.6,
+			MaxTemp: 12.2,
+			Day:     fetch.PeriodForecast{Phrase: "Rain", Condition: fetch.ConditionRain},
+			Night:   fetch.PeriodForecast{Phrase: "Clear", Condition: fetch.ConditionClear},
+		}},
+	}
+	// the English phrases of Open-Meteo are replaced by the condition names
+	assert.Equal(t, "**Пн 18.03** 🌧 4…12°C\nДождь, ночью 🌙 Ясно\n\n_Источник: Open-Meteo_",
+		renderForecast(daily, forecastView{Locale: i18n.For("ru")}))
+
+	// the phrases AccuWeather sent in the language of the user are kept
+	daily.Source, daily.Language = "AccuWeather", "de"
+	daily.Daily[0].Day.Phrase = "Regenschauer"
+	assert.Equal(t, "**Mo 18.03** 🌧 4…12°C\nRegenschauer, nachts 🌙 Clear\n\n_Quelle: AccuWeather_",
+		renderForecast(daily, forecastView{Locale: i18n.For("de")}))
+
+	current := &fetch.Forecast{Current: &fetch.CurrentConditions{
+		Temp:          11.1,
+		FeelsLike:     9.4,
+		Phrase:        "Cloudy",
+		Condition:     fetch.ConditionCloudy,
+		IsDaylight:    true,
+		Humidity:      71,
+		WindSpeed:     14.8,
+		WindDirection: 293,
+		UVIndex:       1,
+		Pressure:      1014,
+	}}
+	assert.Equal(t, "☁️ **11.1°C** Облачно, ощущается как 9.4°C\n💨 Ветер 15 км/ч, ЗСЗ\n💧 Влажность 71%\n"+
+		"🔆 УФ-индекс 1, низкий\n🧭 Давление 1014 гПа\n\n", renderCurrentConditions(current, forecastView{Locale: i18n.For("ru")}))
+
+	current.FetchedAt = time.Now().Add(-5 * time.Minute)
+	assert.True(t, strings.HasPrefix(renderCurrentConditions(current, forecastView{Locale: i18n.For("ru")}), "_из кэша, 5 минут назад_\n\n"))
+}
+
+func TestCompassDirection(t *testing.T) {
+	assert.Equal(t, "N", compassDirection(0))
+	assert.Equal(t, "N", compassDirection(355))
+	assert.Equal(t, "NE", compassDirection(44))
+	assert.Equal(t, "SSW", compassDirection(200))
+	assert.Equal(t, "N", compassDirection(360))
+}
@@ -0,0 +1,230 @@
+package botapi
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	telegramBot "github.com/go-telegram/bot"
+	telegramBotModels "github.com/go-telegram/bot/models"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/i18n"
+)
+
+const (
+	codeFence      = "```"
+	codeFenceClose = "\n" + codeFence
+
+	// texts longer than that are sent as a document, 0 disables documents
+	defaultReplyDocumentThreshold = 3 * maxMessageLength
+)
+
+// boundaries to split a long text at, in the order of preference
+var splitSeparators = []string{"\n\n", "\n", " "}
+
+// splitMessage splits the text into chunks of at most limit characters on paragraph, line and
+// then word boundaries. A code block cut in two is closed at the end of the chunk and reopened
+// with the same language in the next one so that every chunk renders on its own
+func splitMessage(text string, limit int) []string {
+	var chunks []string
+	reopen := ""
+	rest := text
+	for {
+		body := reopen + rest
+		if utf8.RuneCountInString(body) <= limit {
+			return append(chunks, body)
+		}
+
+		// leave room to close a code block
+		window := string([]rune(body)[:limit-len(codeFenceClose)])
+		end, skip := cutWindow(window, len(reopen))
+		chunk := body[:end]
+		rest = body[end+skip:]
+
+		if header, open := openCodeFence(chunk); open {
+			chunk += codeFenceClose
+			reopen = header + "\n"
+		} else {
+			reopen = ""
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+// cutWindow finds the best boundary in the second half of the window after from bytes,
+// it returns the chunk end and the length of the separator dropped between the chunks
+func cutWindow(window string, from int) (int, int) {
+	for _, sep := range splitSeparators {
+		end := strings.LastIndex(window, sep)
+		for end > from && end >= len(window)/2 {
+			if !insideInlineCode(window[:end]) {
+				return end, len(sep)
+			}
+			end = strings.LastIndex(window[:end], sep)
+		}
+	}
+	return len(window), 0
+}
+
+// openCodeFence reports whether the text ends inside a code block and returns its opening line
+func openCodeFence(text string) (string, bool) {
+	header, open := "", false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, codeFence) {
+			continue
+		}
+		if open {
+			header, open = "", false
+		} else {
+			header, open = line, true
+		}
+	}
+	return header, open
+}
+
+// insideInlineCode reports whether the text ends inside an `inline code` span of its last line
+func insideInlineCode(text string) bool {
+	if _, open := openCodeFence(text); open {
+		return false
+	}
+	line := text[strings.LastIndex(text, "\n")+1:]
+	return strings.Count(line, "`")%2 == 1
+}
+
+// sendText sends the text split into as many messages as needed, in order, the first one
+// replies to replyTo if set. Texts over REPLY_DOCUMENT_THRESHOLD characters go as a document
+// with a caption in the language of the locale. It returns the IDs of the messages sent and the
+// error that stopped the sending
+func (b *Bot) sendText(ctx context.Context, chatID int64, text string, replyTo *telegramBotModels.ReplyParameters, l i18n.Localizer) ([]int, error) {
+	return b.send(ctx, chatID, text, replyTo, false, l)
+}
+
+// sendMarkdown is sendText for Markdown rendered as Telegram HTML unless REPLY_PARSE_MODE is plain
+func (b *Bot) sendMarkdown(ctx context.Context, chatID int64, md string, replyTo *telegramBotModels.ReplyParameters, l i18n.Localizer) ([]int, error) {
+	return b.send(ctx, chatID, md, replyTo, richReplies(), l)
+}
+
+func richReplies() bool {
+	return strings.ToLower(envString("REPLY_PARSE_MODE", "html")) == "html"
+}
+
+func (b *Bot) send(ctx context.Context, chatID int64, text string, replyTo *telegramBotModels.ReplyParameters, markdown bool, l i18n.Localizer) ([]int, error) {
+	threshold := envInt("REPLY_DOCUMENT_THRESHOLD", defaultReplyDocumentThreshold)
+	if length := utf8.RuneCountInString(text); threshold > 0 && length > threshold {
+		id, err := b.sendDocument(ctx, chatID, text, replyTo, markdown, l)
+		if err == nil {
+			return []int{id}, nil
+		}
+		b.logger.Error().Err(err).Msg("Failed to send reply document, sending messages instead")
+	}
+
+	return b.sendChunks(ctx, chatID, splitMessage(text, maxMessageLength), replyTo, markdown)
+}
+
+// sendChunks sends the chunks in order, Markdown chunks the Telegram rejects the entities of
+// are sent again as plain text. It returns the IDs of the messages sent and the error that
+// stopped the sending
+func (b *Bot) sendChunks(ctx context.Context, chatID int64, chunks []string, replyTo *telegramBotModels.ReplyParameters, markdown bool) ([]int, error) {
+	var ids []int
+	for i, chunk := range chunks {
+		params := &telegramBot.SendMessageParams{
+			ChatID: chatID,
+			Text:   chunk,
+		}
+		if i == 0 {
+			params.ReplyParameters = replyTo
+		}
+		if markdown {
+			params.Text = markdownToHTML(chunk)
+			params.ParseMode = telegramBotModels.ParseModeHTML
+		}
+
+		msg, err := b.bot.SendMessage(ctx, params)
+		if err != nil && markdown {
+			b.logger.Warn().Err(err).Msg("Failed to send formatted message, sending plain text")
+			params.Text = htmlToPlain(params.Text)
+			params.ParseMode = ""
+			msg, err = b.bot.SendMessage(ctx, params)
+		}
+		if err != nil {
+			// the rest makes no sense without the missing part
+			b.logger.Error().Err(err).Int("chunk", i+1).Int("chunks", len(chunks)).Msg("Failed to send message")
+			return ids, err
+		}
+		ids = append(ids, msg.ID)
+	}
+	return ids, nil
+}
+
+// sendMarkdownMessage sends a text that fits into a single message and returns the message ID
+// to edit it later, falling back to plain text like sendChunks
+func (b *Bot) sendMarkdownMessage(ctx context.Context, chatID int64, md string) (int, error) {
+	params := &telegramBot.SendMessageParams{
+		ChatID: chatID,
+		Text:   md,
+	}
+	if !richReplies() {
+		msg, err := b.bot.SendMessage(ctx, params)
+		if err != nil {
+			return 0, err
+		}
+		return msg.ID, nil
+	}
+
+	params.Text = markdownToHTML(md)
+	params.ParseMode = telegramBotModels.ParseModeHTML
+	msg, err := b.bot.SendMessage(ctx, params)
+	if err != nil {
+		b.logger.Warn().Err(err).Msg("Failed to send formatted message, sending plain text")
+		params.Text = htmlToPlain(params.Text)
+		params.ParseMode = ""
+		msg, err = b.bot.SendMessage(ctx, params)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return msg.ID, nil
+}
+
+// editMarkdown replaces the message text with the rendered Markdown, falling back to plain text
+func (b *Bot) editMarkdown(ctx context.Context, chatID int64, messageID int, md string) error {
+	params := &telegramBot.EditMessageTextParams{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Text:      md,
+	}
+	if !richReplies() {
+		_, err := b.bot.EditMessageText(ctx, params)
+		return err
+	}
+
+	params.Text = markdownToHTML(md)
+	params.ParseMode = telegramBotModels.ParseModeHTML
+	if _, err := b.bot.EditMessageText(ctx, params); err != nil {
+		b.logger.Warn().Err(err).Msg("Failed to edit formatted message, editing plain text")
+		params.Text = htmlToPlain(params.Text)
+		params.ParseMode = ""
+		_, err = b.bot.EditMessageText(ctx, params)
+		return err
+	}
+	return nil
+}
+
+func (b *Bot) sendDocument(ctx context.Context, chatID int64, text string, replyTo *telegramBotModels.ReplyParameters, markdown bool, l i18n.Localizer) (int, error) {
+	filename := "reply.txt"
+	if markdown || strings.Contains(text, codeFence) {
+		filename = "reply.md"
+	}
+
+	msg, err := b.bot.SendDocument(ctx, &telegramBot.SendDocumentParams{
+		ChatID:          chatID,
+		Document:        &telegramBotModels.InputFileUpload{Filename: filename, Data: strings.NewReader(text)},
+		Caption:         l.N("bot.reply_document", utf8.RuneCountInString(text)),
+		ReplyParameters: replyTo,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return msg.ID, nil
+}
@@ -0,0 +1,90 @@
+package botapi
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "Short text",
+			text:  "hello world",
+			limit: 20,
+			want:  []string{"hello world"},
+		},
+		{
+			name:  "Paragraphs",
+			text:  "first paragraph\n\nsecond paragraph",
+			limit: 24,
+			want:  []string{"first paragraph", "second paragraph"},
+		},
+		{
+			name:  "Lines before words",
+			text:  "one two three\nfour five six",
+			limit: 20,
+			want:  []string{"one two three", "four five six"},
+		},
+		{
+			name:  "Words",
+			text:  "one two three four five six",
+			limit: 16,
+			want:  []string{"one two", "three four", "five six"},
+		},
+		{
+			name:  "Hard cut",
+			text:  "abcdefghijklmnopqrstuvwxyz",
+			limit: 14,
+			want:  []string{"abcdefghij", "klmnopqrst", "uvwxyz"},
+		},
+		{
+			name:  "Multibyte characters",
+			text:  "ääääääääääää",
+			limit: 10,
+			want:  []string{"ääääää", "ääääää"},
+		},
+		{
+			name:  "Code block is closed and reopened",
+			text:  "```go\nline one\nline two\nline three\n```\ndone",
+			limit: 30,
+			want:  []string{"```go\nline one\nline two\n```", "```go\nline three\n```\ndone"},
+		},
+		{
+			name:  "Inline code is not broken",
+			text:  "some words here `a b c` tail",
+			limit: 24,
+			want:  []string{"some words here", "`a b c` tail"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.text, tt.limit)
+			assert.Equal(t, tt.want, got)
+			for _, chunk := range got {
+				assert.LessOrEqual(t, utf8.RuneCountInString(chunk), tt.limit)
+			}
+		})
+	}
+}
+
+func TestSplitMessage_Long(t *testing.T) {
+	paragraph := strings.Repeat("word ", 300) + "\n\n"
+	text := strings.Repeat(paragraph, 10) + "```\n" + strings.Repeat("code line\n", 1000) + "```"
+
+	chunks := splitMessage(text, maxMessageLength)
+	assert.Greater(t, len(chunks), 3)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, utf8.RuneCountInString(chunk), maxMessageLength)
+		_, open := openCodeFence(chunk)
+		assert.False(t, open, "every chunk closes its code blocks")
+	}
+}
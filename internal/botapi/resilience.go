@@ -0,0 +1,37 @@
+package botapi
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = time.Minute
+)
+
+// newResilientFetcher wraps the fetcher with retries and a circuit breaker configured by
+// <NAME>_RETRY_ATTEMPTS, <NAME>_RETRY_BASE_DELAY, <NAME>_RETRY_MAX_DELAY, <NAME>_RETRY_JITTER,
+// <NAME>_BREAKER_THRESHOLD and <NAME>_BREAKER_COOLDOWN env keys
+func newResilientFetcher[Q fetch.Query, R any](b *Bot, name string, f fetch.Fetchable[Q, R], idempotent bool) *fetch.ResilientFetcher[Q, R] {
+	prefix := strings.ToUpper(name) + "_"
+
+	policy := fetch.DefaultRetryPolicy()
+	policy.MaxAttempts = envInt(prefix+"RETRY_ATTEMPTS", policy.MaxAttempts)
+	policy.BaseDelay = envDuration(prefix+"RETRY_BASE_DELAY", policy.BaseDelay)
+	policy.MaxDelay = envDuration(prefix+"RETRY_MAX_DELAY", policy.MaxDelay)
+	policy.Jitter = envFloat(prefix+"RETRY_JITTER", policy.Jitter)
+	policy.Idempotent = idempotent
+
+	breaker := fetch.NewCircuitBreaker(
+		name,
+		envInt(prefix+"BREAKER_THRESHOLD", defaultBreakerThreshold),
+		envDuration(prefix+"BREAKER_COOLDOWN", defaultBreakerCooldown),
+		b.logger,
+	)
+	b.breakers = append(b.breakers, breaker)
+
+	return fetch.NewResilientFetcher(f, policy, breaker)
+}
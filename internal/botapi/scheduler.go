@@ -0,0 +1,172 @@
+package botapi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+)
+
+// /////////////////////////////////////////////////////////////////////////////
+// Scheduler running the daily subscriptions outside of the incoming updates
+// /////////////////////////////////////////////////////////////////////////////
+
+const (
+	defaultSchedulerInterval = time.Minute
+	// runs missed by up to that long, e.g. while the bot was restarting, are sent late once,
+	// older ones are skipped until the next day
+	defaultSubscriptionCatchUp = 2 * time.Hour
+	schedulerBatchSize         = 100
+	// the due runs are sent by that many workers, a run may wait for a slow forecast
+	defaultSchedulerWorkers = 4
+)
+
+// scheduler polls the subscriptions table for due runs, the next run of every subscription
+// is stored there so a restart neither loses nor repeats runs
+type scheduler struct {
+	b        *Bot
+	interval time.Duration
+	catchUp  time.Duration
+	workers  int
+	now      func() time.Time
+}
+
+func newScheduler(b *Bot) *scheduler {
+	return &scheduler{
+		b:        b,
+		interval: envDuration("SCHEDULER_INTERVAL", defaultSchedulerInterval),
+		catchUp:  envDuration("SUBSCRIPTION_CATCH_UP", defaultSubscriptionCatchUp),
+		workers:  max(1, envInt("SCHEDULER_WORKERS", defaultSchedulerWorkers)),
+		now:      time.Now,
+	}
+}
+
+// run blocks until the context is done, the runs missed while the bot was down are handled
+// right away
+func (s *scheduler) run(ctx context.Context) {
+	s.b.logger.Info().Dur("interval", s.interval).Msg("running subscription scheduler")
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick hands the due runs to the workers and waits for them, so the next tick does not pick
+// up the runs still being sent
+func (s *scheduler) tick(ctx context.Context) {
+	due, err := s.b.db.DueSubscriptions(ctx, s.now(), schedulerBatchSize)
+	if err != nil {
+		s.b.logger.Error().Err(err).Msg("Failed to get due subscriptions")
+		return
+	}
+
+	jobs := make(chan *database.Subscription)
+	var wg sync.WaitGroup
+	for range min(s.workers, len(due)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sub := range jobs {
+				s.runDue(ctx, sub)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range due {
+		select {
+		case jobs <- &due[i]:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// runDue claims and sends a due run. The catch up is checked at the time of the claim since
+// the run may have waited for a worker, and the user must still be allowed to subscribe
+func (s *scheduler) runDue(ctx context.Context, sub *database.Subscription) {
+	now := s.now()
+	next := nextRun(sub.MinuteOfDay, subscriptionTimeZone(sub), now)
+	inTime := now.Sub(sub.NextRun) <= s.catchUp
+	allowed := s.b.getUserRole(sub.UserID) >= commandMinRole("subscribe")
+
+	// the run is claimed before it is sent, a crash in between loses it rather than repeats it
+	claimed, err := s.b.db.AdvanceSubscription(ctx, sub.ID, sub.NextRun, next, inTime && allowed)
+	if err != nil {
+		s.b.logger.Error().Err(err).Int64("subscription", sub.ID).Msg("Failed to advance subscription")
+		return
+	}
+	switch {
+	case !claimed:
+	case !inTime:
+		s.b.logger.Warn().Int64("subscription", sub.ID).Time("due", sub.NextRun).Msg("skipping missed subscription run")
+	case !allowed:
+		s.b.logger.Warn().Int64("subscription", sub.ID).Int64("user", sub.UserID).Msg("skipping subscription run, the user may no longer subscribe")
+	default:
+		s.b.runSubscription(ctx, sub)
+	}
+}
+
+func (b *Bot) runSubscription(ctx context.Context, sub *database.Subscription) {
+	switch sub.Kind {
+	case subscriptionWeather:
+		b.runWeatherSubscription(ctx, sub)
+	default:
+		b.logger.Error().Str("kind", sub.Kind).Int64("subscription", sub.ID).Msg("unknown subscription kind")
+	}
+}
+
+func subscriptionTimeZone(sub *database.Subscription) *time.Location {
+	tz, err := time.LoadLocation(sub.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return tz
+}
+
+// nextRun returns the first time after the given one that is the minute of the day in the
+// time zone, in the time zone of that day so daylight saving changes keep the local time
+func nextRun(minuteOfDay int, tz *time.Location, after time.Time) time.Time {
+	local := after.In(tz)
+	for day := 0; ; day++ {
+		t := time.Date(local.Year(), local.Month(), local.Day()+day, minuteOfDay/60, minuteOfDay%60, 0, 0, tz)
+		if t.After(after) {
+			return t
+		}
+	}
+}
+
+// parseClock parses "7:30", "07:30" or "7" to the minute of the day
+func parseClock(s string) (int, error) {
+	hours, minutes, hasMinutes := strings.Cut(s, ":")
+	h, err := strconv.Atoi(hours)
+	m := 0
+	if err == nil && hasMinutes {
+		if len(minutes) != 2 {
+			err = fmt.Errorf("invalid minutes")
+		} else {
+			m, err = strconv.Atoi(minutes)
+		}
+	}
+	if err != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, argError("subscription.bad_time", s)
+	}
+	return h*60 + m, nil
+}
+
+func formatClock(minuteOfDay int) string {
+	return fmt.Sprintf("%02d:%02d", minuteOfDay/60, minuteOfDay%60)
+}
@@ -0,0 +1,72 @@
+package botapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextRun(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		name   string
+		minute int
+		after  time.Time
+		want   time.Time
+	}{
+		{
+			name:   "Later today",
+			minute: 7*60 + 30,
+			after:  time.Date(2024, 11, 2, 5, 0, 0, 0, time.UTC),
+			want:   time.Date(2024, 11, 2, 7, 30, 0, 0, berlin),
+		},
+		{
+			name:   "Tomorrow when the time has passed",
+			minute: 7*60 + 30,
+			after:  time.Date(2024, 11, 2, 7, 30, 0, 0, berlin),
+			want:   time.Date(2024, 11, 3, 7, 30, 0, 0, berlin),
+		},
+		{
+			name:   "The day in the time zone, not in UTC",
+			minute: 60,
+			after:  time.Date(2024, 11, 2, 23, 30, 0, 0, time.UTC),
+			want:   time.Date(2024, 11, 3, 1, 0, 0, 0, berlin),
+		},
+		{
+			name:   "Across the daylight saving change",
+			minute: 7 * 60,
+			after:  time.Date(2024, 3, 30, 12, 0, 0, 0, berlin),
+			want:   time.Date(2024, 3, 31, 5, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, tt.want.Equal(nextRun(tt.minute, berlin, tt.after)), "got %v", nextRun(tt.minute, berlin, tt.after))
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	for text, want := range map[string]int{"07:30": 450, "7:30": 450, "7": 420, "23:59": 1439, "0:00": 0} {
+		got, err := parseClock(text)
+		if assert.NoError(t, err, text) {
+			assert.Equal(t, want, got, text)
+		}
+	}
+	for _, text := range []string{"24:00", "7:5", "7:60", "seven", "", "-1"} {
+		_, err := parseClock(text)
+		assert.Error(t, err, text)
+	}
+	assert.Equal(t, "07:05", formatClock(425))
+}
+
+func TestCommandMinRole(t *testing.T) {
+	assert.Equal(t, PromotedUser, commandMinRole("subscribe"))
+	assert.Equal(t, AdminUser, commandMinRole("no-such-command"))
+}
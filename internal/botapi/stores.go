@@ -0,0 +1,74 @@
+package botapi
+
+import (
+	"context"
+
+	"github.com/gehirndienst/supernova-go-bot/internal/database"
+	"github.com/gehirndienst/supernova-go-bot/internal/fetch"
+)
+
+// /////////////////////////////////////////////////////////////////////////////
+// Adapters of the database to the fetch stores
+// /////////////////////////////////////////////////////////////////////////////
+
+type locationStore struct {
+	db *database.Database
+}
+
+func (s *locationStore) Get(ctx context.Context, query string) (*fetch.Location, error) {
+	l, err := s.db.GetLocation(ctx, query)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	return &fetch.Location{
+		Key:       l.Key,
+		Name:      l.Name,
+		Region:    l.Region,
+		Country:   l.Country,
+		TimeZone:  l.TimeZone,
+		Latitude:  l.Latitude,
+		Longitude: l.Longitude,
+	}, nil
+}
+
+func (s *locationStore) Save(ctx context.Context, query string, l *fetch.Location) error {
+	return s.db.SaveLocation(ctx, &database.Location{
+		Query:     query,
+		Key:       l.Key,
+		Name:      l.Name,
+		Region:    l.Region,
+		Country:   l.Country,
+		TimeZone:  l.TimeZone,
+		Latitude:  l.Latitude,
+		Longitude: l.Longitude,
+	})
+}
+
+func (s *locationStore) Delete(ctx context.Context, query string) (int64, error) {
+	return s.db.DeleteLocations(ctx, query)
+}
+
+func toFetchLocation(l *database.Location) *fetch.Location {
+	return &fetch.Location{
+		Key:       l.Key,
+		Name:      l.Name,
+		Region:    l.Region,
+		Country:   l.Country,
+		TimeZone:  l.TimeZone,
+		Latitude:  l.Latitude,
+		Longitude: l.Longitude,
+	}
+}
+
+func toDatabaseLocation(query string, l *fetch.Location) *database.Location {
+	return &database.Location{
+		Query:     query,
+		Key:       l.Key,
+		Name:      l.Name,
+		Region:    l.Region,
+		Country:   l.Country,
+		TimeZone:  l.TimeZone,
+		Latitude:  l.Latitude,
+		Longitude: l.Longitude,
+	}
+}
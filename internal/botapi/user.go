@@ -7,3 +7,26 @@ const (
 	PromotedUser
 	AdminUser
 )
+
+func (r UserRole) String() string {
+	switch r {
+	case PromotedUser:
+		return "PROMOTED USER"
+	case AdminUser:
+		return "ADMIN"
+	default:
+		return "REGULAR USER"
+	}
+}
+
+// messageID names the role in the message catalogs
+func (r UserRole) messageID() string {
+	switch r {
+	case PromotedUser:
+		return "role.promoted"
+	case AdminUser:
+		return "role.admin"
+	default:
+		return "role.regular"
+	}
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// WatchedLocation is a city whose severe weather alerts are pushed to the chat, Language is the
+// language of the Telegram app of the user when watching
+type WatchedLocation struct {
+	ID        int64
+	UserID    int64
+	ChatID    int64
+	City      string
+	Language  string
+	CreatedAt time.Time
+}
+
+// AlertNotification is the message an alert was pushed with, Location is the key the alert
+// was polled for and Text is the last text of the message to tell an updated alert
+type AlertNotification struct {
+	AlertID   string
+	ChatID    int64
+	MessageID int
+	Location  string
+	Text      string
+	Ended     bool
+}
+
+func (d *Database) AddWatchedLocation(ctx context.Context, w *WatchedLocation) (int64, error) {
+	var id int64
+	err := d.db.QueryRowContext(ctx,
+		"INSERT INTO watched_locations (user_id, chat_id, city, language) VALUES ($1, $2, $3, $4) RETURNING id",
+		w.UserID, w.ChatID, w.City, w.Language,
+	).Scan(&id)
+	return id, err
+}
+
+// ListWatchedLocations returns the locations watched by the user or by everybody if userID is 0
+func (d *Database) ListWatchedLocations(ctx context.Context, userID int64) ([]WatchedLocation, error) {
+	query := "SELECT id, user_id, chat_id, city, language, created_at FROM watched_locations ORDER BY id"
+	var args []any
+	if userID != 0 {
+		query = "SELECT id, user_id, chat_id, city, language, created_at FROM watched_locations WHERE user_id = $1 ORDER BY id"
+		args = append(args, userID)
+	}
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locations []WatchedLocation
+	for rows.Next() {
+		var w WatchedLocation
+		if err := rows.Scan(&w.ID, &w.UserID, &w.ChatID, &w.City, &w.Language, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		locations = append(locations, w)
+	}
+	return locations, rows.Err()
+}
+
+// DeleteWatchedLocations removes the watched location of the user or all of them if id is 0
+func (d *Database) DeleteWatchedLocations(ctx context.Context, userID, id int64) (int64, error) {
+	var res sql.Result
+	var err error
+	if id == 0 {
+		res, err = d.db.ExecContext(ctx, "DELETE FROM watched_locations WHERE user_id = $1", userID)
+	} else {
+		res, err = d.db.ExecContext(ctx, "DELETE FROM watched_locations WHERE user_id = $1 AND id = $2", userID, id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteChatWatchedLocations removes every location watched in the chat
+func (d *Database) DeleteChatWatchedLocations(ctx context.Context, chatID int64) (int64, error) {
+	res, err := d.db.ExecContext(ctx, "DELETE FROM watched_locations WHERE chat_id = $1", chatID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetAlertNotification returns nil without an error if the alert was not pushed to the chat
+func (d *Database) GetAlertNotification(ctx context.Context, alertID string, chatID int64) (*AlertNotification, error) {
+	var n AlertNotification
+	err := d.db.QueryRowContext(ctx,
+		"SELECT alert_id, chat_id, message_id, location, text, ended FROM alert_notifications WHERE alert_id = $1 AND chat_id = $2",
+		alertID, chatID,
+	).Scan(&n.AlertID, &n.ChatID, &n.MessageID, &n.Location, &n.Text, &n.Ended)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// ActiveAlertNotifications returns the alerts pushed to the chat for the location that have not ended
+func (d *Database) ActiveAlertNotifications(ctx context.Context, chatID int64, location string) ([]AlertNotification, error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT alert_id, chat_id, message_id, location, text, ended FROM alert_notifications WHERE chat_id = $1 AND location = $2 AND NOT ended",
+		chatID, location,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []AlertNotification
+	for rows.Next() {
+		var n AlertNotification
+		if err := rows.Scan(&n.AlertID, &n.ChatID, &n.MessageID, &n.Location, &n.Text, &n.Ended); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (d *Database) SaveAlertNotification(ctx context.Context, n *AlertNotification) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO alert_notifications (alert_id, chat_id, message_id, location, text, ended)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (alert_id, chat_id) DO UPDATE SET
+			message_id = EXCLUDED.message_id,
+			location = EXCLUDED.location,
+			text = EXCLUDED.text,
+			ended = EXCLUDED.ended,
+			updated_at = CURRENT_TIMESTAMP`,
+		n.AlertID, n.ChatID, n.MessageID, n.Location, n.Text, n.Ended,
+	)
+	return err
+}
+
+// PruneAlertNotifications forgets the alerts that ended before the time
+func (d *Database) PruneAlertNotifications(ctx context.Context, before time.Time) (int64, error) {
+	res, err := d.db.ExecContext(ctx, "DELETE FROM alert_notifications WHERE ended AND updated_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+type ChatMessage struct {
+	ChatID    int64
+	UserID    int64
+	Role      string
+	Content   string
+	CreatedAt time.Time
+	// MessageIDs are the Telegram messages an assistant answer was sent in, a reply to any of
+	// them continues the conversation
+	MessageIDs []int
+}
+
+func (d *Database) AppendChatMessages(ctx context.Context, messages ...ChatMessage) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, m := range messages {
+		var id int64
+		if err := tx.QueryRowContext(ctx,
+			"INSERT INTO chat_messages (chat_id, user_id, role, content) VALUES ($1, $2, $3, $4) RETURNING id",
+			m.ChatID, m.UserID, m.Role, m.Content,
+		).Scan(&id); err != nil {
+			return err
+		}
+		for _, messageID := range m.MessageIDs {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO chat_reply_messages (chat_id, message_id, chat_message_id) VALUES ($1, $2, $3)
+				ON CONFLICT (chat_id, message_id) DO NOTHING`,
+				m.ChatID, messageID, id,
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// IsChatReplyMessage reports whether the Telegram message carries a stored chat answer
+func (d *Database) IsChatReplyMessage(ctx context.Context, chatID int64, messageID int) (bool, error) {
+	var exists bool
+	err := d.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM chat_reply_messages WHERE chat_id = $1 AND message_id = $2)",
+		chatID, messageID,
+	).Scan(&exists)
+	return exists, err
+}
+
+// GetChatHistory returns up to limit latest messages of the chat in chronological order
+func (d *Database) GetChatHistory(ctx context.Context, chatID int64, limit int) ([]ChatMessage, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT chat_id, user_id, role, content, created_at FROM (
+			SELECT id, chat_id, user_id, role, content, created_at FROM chat_messages
+			WHERE chat_id = $1 ORDER BY id DESC LIMIT $2
+		) latest ORDER BY id ASC`,
+		chatID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ChatMessage
+	for rows.Next() {
+		var m ChatMessage
+		if err := rows.Scan(&m.ChatID, &m.UserID, &m.Role, &m.Content, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (d *Database) ResetChatHistory(ctx context.Context, chatID int64) (int64, error) {
+	res, err := d.db.ExecContext(ctx, "DELETE FROM chat_messages WHERE chat_id = $1", chatID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
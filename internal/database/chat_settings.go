@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const (
+	ChatSettingsScopeUser = "user"
+	ChatSettingsScopeChat = "chat"
+)
+
+// ChatSettings holds the /chat preferences of a user or a chat, nil fields are not set
+type ChatSettings struct {
+	Model        *string
+	SystemPrompt *string
+	Temperature  *float64
+}
+
+// GetChatSettings returns empty settings if nothing is stored for the scope
+func (d *Database) GetChatSettings(ctx context.Context, scope string, scopeID int64) (*ChatSettings, error) {
+	var s ChatSettings
+	err := d.db.QueryRowContext(ctx,
+		"SELECT model, system_prompt, temperature FROM chat_settings WHERE scope = $1 AND scope_id = $2",
+		scope, scopeID,
+	).Scan(&s.Model, &s.SystemPrompt, &s.Temperature)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &ChatSettings{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (d *Database) SaveChatSettings(ctx context.Context, scope string, scopeID int64, s *ChatSettings) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO chat_settings (scope, scope_id, model, system_prompt, temperature)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (scope, scope_id) DO UPDATE SET
+			model = EXCLUDED.model,
+			system_prompt = EXCLUDED.system_prompt,
+			temperature = EXCLUDED.temperature,
+			updated_at = CURRENT_TIMESTAMP`,
+		scope, scopeID, s.Model, s.SystemPrompt, s.Temperature,
+	)
+	return err
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ChatUsage is the token count of a single chat request, Cost is estimated from the model prices
+type ChatUsage struct {
+	UserID           int64
+	ChatID           int64
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool
+	Cost             float64
+}
+
+type UsageTotals struct {
+	Requests int64
+	Tokens   int64
+	Cost     float64
+}
+
+type UserUsage struct {
+	UserID int64
+	UsageTotals
+}
+
+// ChatBudget overrides the role budget of a user, nil fields are taken from the role budget
+type ChatBudget struct {
+	DailyTokens   *int64
+	MonthlyTokens *int64
+	DailyCost     *float64
+	MonthlyCost   *float64
+}
+
+func (d *Database) RecordChatUsage(ctx context.Context, u ChatUsage) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO chat_usage (user_id, chat_id, model, prompt_tokens, completion_tokens, estimated, cost)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		u.UserID, u.ChatID, u.Model, u.PromptTokens, u.CompletionTokens, u.Estimated, u.Cost,
+	)
+	return err
+}
+
+func (d *Database) GetChatUsageTotals(ctx context.Context, userID int64, since time.Time) (UsageTotals, error) {
+	var t UsageTotals
+	err := d.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(prompt_tokens + completion_tokens), 0), COALESCE(SUM(cost), 0)
+		FROM chat_usage WHERE user_id = $1 AND created_at >= $2`,
+		userID, since,
+	).Scan(&t.Requests, &t.Tokens, &t.Cost)
+	return t, err
+}
+
+// ListChatUsageByUser returns the usage since the given time per user, the heaviest users first
+func (d *Database) ListChatUsageByUser(ctx context.Context, since time.Time) ([]UserUsage, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT user_id, COUNT(*), SUM(prompt_tokens + completion_tokens) AS tokens, SUM(cost)
+		FROM chat_usage WHERE created_at >= $1
+		GROUP BY user_id ORDER BY tokens DESC`,
+		since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []UserUsage
+	for rows.Next() {
+		var u UserUsage
+		if err := rows.Scan(&u.UserID, &u.Requests, &u.Tokens, &u.Cost); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// GetChatBudget returns an empty budget if the user has no own budget
+func (d *Database) GetChatBudget(ctx context.Context, userID int64) (*ChatBudget, error) {
+	var b ChatBudget
+	err := d.db.QueryRowContext(ctx,
+		"SELECT daily_tokens, monthly_tokens, daily_cost, monthly_cost FROM chat_budgets WHERE user_id = $1",
+		userID,
+	).Scan(&b.DailyTokens, &b.MonthlyTokens, &b.DailyCost, &b.MonthlyCost)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &ChatBudget{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (d *Database) SaveChatBudget(ctx context.Context, userID int64, b *ChatBudget) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO chat_budgets (user_id, daily_tokens, monthly_tokens, daily_cost, monthly_cost)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			daily_tokens = EXCLUDED.daily_tokens,
+			monthly_tokens = EXCLUDED.monthly_tokens,
+			daily_cost = EXCLUDED.daily_cost,
+			monthly_cost = EXCLUDED.monthly_cost`,
+		userID, b.DailyTokens, b.MonthlyTokens, b.DailyCost, b.MonthlyCost,
+	)
+	return err
+}
+
+func (d *Database) DeleteChatBudget(ctx context.Context, userID int64) (int64, error) {
+	res, err := d.db.ExecContext(ctx, "DELETE FROM chat_budgets WHERE user_id = $1", userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -33,6 +33,11 @@ func NewDatabase() (*Database, error) {
 	return &Database{db: db}, nil
 }
 
+// NewDatabaseFromDB wraps an open connection, e.g. one of another driver in the tests
+func NewDatabaseFromDB(db *sql.DB) *Database {
+	return &Database{db: db}
+}
+
 func (d *Database) AllowUser(userID int64) error {
 	_, err := d.db.Exec("INSERT INTO allowed_users (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING", userID)
 	return err
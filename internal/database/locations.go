@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Location struct {
+	Query     string
+	Key       string
+	Name      string
+	Region    string
+	Country   string
+	TimeZone  string
+	Latitude  float64
+	Longitude float64
+	CreatedAt time.Time
+}
+
+// GetLocation returns nil without an error if the query is not cached
+func (d *Database) GetLocation(ctx context.Context, query string) (*Location, error) {
+	var l Location
+	err := d.db.QueryRowContext(ctx,
+		"SELECT query, location_key, name, region, country, timezone, latitude, longitude, created_at FROM locations WHERE query = $1",
+		query,
+	).Scan(&l.Query, &l.Key, &l.Name, &l.Region, &l.Country, &l.TimeZone, &l.Latitude, &l.Longitude, &l.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (d *Database) SaveLocation(ctx context.Context, l *Location) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO locations (query, location_key, name, region, country, timezone, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (query) DO UPDATE SET
+			location_key = EXCLUDED.location_key,
+			name = EXCLUDED.name,
+			region = EXCLUDED.region,
+			country = EXCLUDED.country,
+			timezone = EXCLUDED.timezone,
+			latitude = EXCLUDED.latitude,
+			longitude = EXCLUDED.longitude,
+			created_at = CURRENT_TIMESTAMP`,
+		l.Query, l.Key, l.Name, l.Region, l.Country, l.TimeZone, l.Latitude, l.Longitude,
+	)
+	return err
+}
+
+func (d *Database) ListLocations(ctx context.Context, limit int) ([]Location, error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT query, location_key, name, region, country, timezone, latitude, longitude, created_at FROM locations ORDER BY created_at DESC LIMIT $1",
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locations []Location
+	for rows.Next() {
+		var l Location
+		if err := rows.Scan(&l.Query, &l.Key, &l.Name, &l.Region, &l.Country, &l.TimeZone, &l.Latitude, &l.Longitude, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return locations, rows.Err()
+}
+
+func (d *Database) CountLocations(ctx context.Context) (int, error) {
+	var n int
+	err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM locations").Scan(&n)
+	return n, err
+}
+
+// DeleteLocations removes the cached query in every language, e.g. "munich" and "munich|de",
+// or all the cached queries if it is empty
+func (d *Database) DeleteLocations(ctx context.Context, query string) (int64, error) {
+	var res sql.Result
+	var err error
+	if query == "" {
+		res, err = d.db.ExecContext(ctx, "DELETE FROM locations")
+	} else {
+		res, err = d.db.ExecContext(ctx, "DELETE FROM locations WHERE split_part(query, '|', 1) = $1", query)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetLocationChoice returns the city the user picked for the ambiguous query or nil
+func (d *Database) GetLocationChoice(ctx context.Context, userID int64, query string) (*Location, error) {
+	var l Location
+	err := d.db.QueryRowContext(ctx,
+		`SELECT query, location_key, name, region, country, timezone, latitude, longitude, created_at
+		FROM location_choices WHERE user_id = $1 AND query = $2`,
+		userID, query,
+	).Scan(&l.Query, &l.Key, &l.Name, &l.Region, &l.Country, &l.TimeZone, &l.Latitude, &l.Longitude, &l.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (d *Database) SaveLocationChoice(ctx context.Context, userID int64, l *Location) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO location_choices (user_id, query, location_key, name, region, country, timezone, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id, query) DO UPDATE SET
+			location_key = EXCLUDED.location_key,
+			name = EXCLUDED.name,
+			region = EXCLUDED.region,
+			country = EXCLUDED.country,
+			timezone = EXCLUDED.timezone,
+			latitude = EXCLUDED.latitude,
+			longitude = EXCLUDED.longitude,
+			created_at = CURRENT_TIMESTAMP`,
+		userID, l.Query, l.Key, l.Name, l.Region, l.Country, l.TimeZone, l.Latitude, l.Longitude,
+	)
+	return err
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Subscription is a job run every day at MinuteOfDay in TimeZone, NextRun is kept in the
+// table so that the schedule survives restarts. Language is the language of the Telegram app
+// of the user when subscribing
+type Subscription struct {
+	ID          int64
+	UserID      int64
+	ChatID      int64
+	Kind        string
+	City        string
+	MinuteOfDay int
+	TimeZone    string
+	Language    string
+	NextRun     time.Time
+	LastRun     *time.Time
+	CreatedAt   time.Time
+}
+
+const subscriptionColumns = "id, user_id, chat_id, kind, city, minute_of_day, timezone, language, next_run, last_run, created_at"
+
+func scanSubscriptions(rows *sql.Rows) ([]Subscription, error) {
+	defer rows.Close()
+
+	var subscriptions []Subscription
+	for rows.Next() {
+		var s Subscription
+		var lastRun sql.NullTime
+		if err := rows.Scan(&s.ID, &s.UserID, &s.ChatID, &s.Kind, &s.City, &s.MinuteOfDay, &s.TimeZone,
+			&s.Language, &s.NextRun, &lastRun, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		if lastRun.Valid {
+			s.LastRun = &lastRun.Time
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, rows.Err()
+}
+
+// AddSubscription saves the subscription and returns its ID
+func (d *Database) AddSubscription(ctx context.Context, s *Subscription) (int64, error) {
+	var id int64
+	err := d.db.QueryRowContext(ctx,
+		`INSERT INTO subscriptions (user_id, chat_id, kind, city, minute_of_day, timezone, language, next_run)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		s.UserID, s.ChatID, s.Kind, s.City, s.MinuteOfDay, s.TimeZone, s.Language, s.NextRun,
+	).Scan(&id)
+	return id, err
+}
+
+func (d *Database) ListSubscriptions(ctx context.Context, userID int64) ([]Subscription, error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT "+subscriptionColumns+" FROM subscriptions WHERE user_id = $1 ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanSubscriptions(rows)
+}
+
+// DueSubscriptions returns the subscriptions whose next run is not after now, the longest
+// overdue first
+func (d *Database) DueSubscriptions(ctx context.Context, now time.Time, limit int) ([]Subscription, error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT "+subscriptionColumns+" FROM subscriptions WHERE next_run <= $1 ORDER BY next_run LIMIT $2",
+		now, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanSubscriptions(rows)
+}
+
+// AdvanceSubscription moves the subscription from the run it was due for to the next one.
+// It returns false if another instance has already advanced it, so a run is claimed only once
+func (d *Database) AdvanceSubscription(ctx context.Context, id int64, due, next time.Time, ran bool) (bool, error) {
+	query := "UPDATE subscriptions SET next_run = $3 WHERE id = $1 AND next_run = $2"
+	if ran {
+		query = "UPDATE subscriptions SET next_run = $3, last_run = CURRENT_TIMESTAMP WHERE id = $1 AND next_run = $2"
+	}
+	res, err := d.db.ExecContext(ctx, query, id, due, next)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RescheduleSubscription moves the subscription to the time zone, next is its next run there
+func (d *Database) RescheduleSubscription(ctx context.Context, id int64, timeZone string, next time.Time) error {
+	_, err := d.db.ExecContext(ctx, "UPDATE subscriptions SET timezone = $2, next_run = $3 WHERE id = $1", id, timeZone, next)
+	return err
+}
+
+// DeleteSubscriptions removes the subscription of the user or all of them if id is 0
+func (d *Database) DeleteSubscriptions(ctx context.Context, userID, id int64) (int64, error) {
+	var res sql.Result
+	var err error
+	if id == 0 {
+		res, err = d.db.ExecContext(ctx, "DELETE FROM subscriptions WHERE user_id = $1", userID)
+	} else {
+		res, err = d.db.ExecContext(ctx, "DELETE FROM subscriptions WHERE user_id = $1 AND id = $2", userID, id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// UserSettings holds the preferences of a user, empty fields use the defaults
+type UserSettings struct {
+	Units    string
+	Language string
+	TimeZone string
+	HomeCity string
+	// Output is how forecasts are sent, as text or as a chart
+	Output string
+}
+
+// GetUserSettings returns empty settings if the user has not saved any
+func (d *Database) GetUserSettings(ctx context.Context, userID int64) (*UserSettings, error) {
+	var s UserSettings
+	err := d.db.QueryRowContext(ctx,
+		"SELECT units, language, timezone, home_city, output FROM user_settings WHERE user_id = $1",
+		userID,
+	).Scan(&s.Units, &s.Language, &s.TimeZone, &s.HomeCity, &s.Output)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &UserSettings{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (d *Database) SaveUserSettings(ctx context.Context, userID int64, s *UserSettings) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO user_settings (user_id, units, language, timezone, home_city, output)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET
+			units = EXCLUDED.units,
+			language = EXCLUDED.language,
+			timezone = EXCLUDED.timezone,
+			home_city = EXCLUDED.home_city,
+			output = EXCLUDED.output,
+			updated_at = CURRENT_TIMESTAMP`,
+		userID, s.Units, s.Language, s.TimeZone, s.HomeCity, s.Output,
+	)
+	return err
+}
@@ -0,0 +1,543 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultAccuWeatherBaseURL = "http://dataservice.accuweather.com"
+)
+
+// AccuWeatherPlan lists the forecast ranges the package of the API key includes in ascending
+// order, a query gets the shortest range that covers it and the result is trimmed
+type AccuWeatherPlan struct {
+	Name  string
+	Days  []int
+	Hours []int
+}
+
+var (
+	AccuWeatherFreePlan     = AccuWeatherPlan{Name: "free", Days: []int{1, 5}, Hours: []int{1, 12}}
+	AccuWeatherStandardPlan = AccuWeatherPlan{Name: "standard", Days: []int{1, 5, 10}, Hours: []int{1, 12, 24, 72}}
+	AccuWeatherPremiumPlan  = AccuWeatherPlan{Name: "premium", Days: []int{1, 5, 10, 15}, Hours: []int{1, 12, 24, 72, 120}}
+
+	accuWeatherPlans = []AccuWeatherPlan{AccuWeatherFreePlan, AccuWeatherStandardPlan, AccuWeatherPremiumPlan}
+)
+
+// ParseAccuWeatherPlan finds the plan by its name, empty is the free plan
+func ParseAccuWeatherPlan(name string) (AccuWeatherPlan, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return AccuWeatherFreePlan, nil
+	}
+	names := make([]string, len(accuWeatherPlans))
+	for i, p := range accuWeatherPlans {
+		if p.Name == name {
+			return p, nil
+		}
+		names[i] = p.Name
+	}
+	return AccuWeatherPlan{}, fmt.Errorf("unknown accuweather plan %q, use one of %s", name, strings.Join(names, ", "))
+}
+
+// MaxDays is the longest daily forecast of the plan
+func (p AccuWeatherPlan) MaxDays() int {
+	return p.Days[len(p.Days)-1]
+}
+
+// MaxHours is the longest hourly forecast of the plan
+func (p AccuWeatherPlan) MaxHours() int {
+	return p.Hours[len(p.Hours)-1]
+}
+
+// forecastRange returns the path of the shortest forecast covering the query, e.g. "daily/5day/"
+// for 3 days, or a PlanLimitError when the query is longer than the plan allows
+func (p AccuWeatherPlan) forecastRange(q WeatherQuery) (string, error) {
+	if q.Hours > 0 {
+		for _, hours := range p.Hours {
+			if hours >= q.Hours {
+				return fmt.Sprintf("hourly/%dhour/", hours), nil
+			}
+		}
+		return "", &PlanLimitError{Provider: "AccuWeather", Plan: p.Name, Unit: "hours", Requested: q.Hours, Max: p.MaxHours()}
+	}
+	for _, days := range p.Days {
+		if days >= q.Days {
+			return fmt.Sprintf("daily/%dday/", days), nil
+		}
+	}
+	return "", &PlanLimitError{Provider: "AccuWeather", Plan: p.Name, Unit: "days", Requested: q.Days, Max: p.MaxDays()}
+}
+
+type AccuWeatherFetcher struct {
+	BaseFetcher
+	locations *LocationCache
+	quota     *Quota
+	plan      AccuWeatherPlan
+}
+
+type LocationResponse struct {
+	Key           string `json:"Key"`
+	LocalizedName string `json:"LocalizedName"`
+	Region        struct {
+		ID            string `json:"ID"`
+		LocalizedName string `json:"LocalizedName"`
+	} `json:"AdministrativeArea"`
+	Country struct {
+		ID            string `json:"ID"`
+		LocalizedName string `json:"LocalizedName"`
+	} `json:"Country"`
+	TimeZone struct {
+		Name string `json:"Name"`
+	} `json:"TimeZone"`
+	GeoPosition struct {
+		Latitude  float64 `json:"Latitude"`
+		Longitude float64 `json:"Longitude"`
+	} `json:"GeoPosition"`
+}
+
+func (lr LocationResponse) toLocation() *Location {
+	return &Location{
+		Key:       lr.Key,
+		Name:      lr.LocalizedName,
+		Region:    lr.Region.LocalizedName,
+		Country:   lr.Country.LocalizedName,
+		TimeZone:  lr.TimeZone.Name,
+		Latitude:  lr.GeoPosition.Latitude,
+		Longitude: lr.GeoPosition.Longitude,
+	}
+}
+
+type DailyForecastResponses struct {
+	DailyForecastResponses []DailyForecastResponse `json:"DailyForecasts"`
+}
+
+type DailyForecastPeriodResponse struct {
+	Icon                   int    `json:"Icon"`
+	IconPhrase             string `json:"IconPhrase"`
+	HasPrecipitation       bool   `json:"HasPrecipitation"`
+	PrecipitationType      string `json:"PrecipitationType"`
+	PrecipitationIntensity string `json:"PrecipitationIntensity"`
+}
+
+type TemperatureResponse struct {
+	Value float32 `json:"Value"`
+	Unit  string  `json:"Unit"`
+}
+
+func (t TemperatureResponse) celsius() float64 {
+	if t.Unit == "F" {
+		return fahrenheitToCelsius(float64(t.Value))
+	}
+	return float64(t.Value)
+}
+
+type DailyForecastResponse struct {
+	Date        string `json:"Date"`
+	Temperature struct {
+		Minimum TemperatureResponse `json:"Minimum"`
+		Maximum TemperatureResponse `json:"Maximum"`
+	} `json:"Temperature"`
+	Day   DailyForecastPeriodResponse `json:"Day"`
+	Night DailyForecastPeriodResponse `json:"Night"`
+}
+
+type HourlyForecastResponse struct {
+	DateTime                 string              `json:"DateTime"`
+	WeatherIcon              int                 `json:"WeatherIcon"`
+	IconPhrase               string              `json:"IconPhrase"`
+	HasPrecipitation         bool                `json:"HasPrecipitation"`
+	IsDaylight               bool                `json:"IsDaylight"`
+	Temperature              TemperatureResponse `json:"Temperature"`
+	PrecipitationProbability float32             `json:"PrecipitationProbability"`
+	MobileLink               string              `json:"MobileLink"`
+	Link                     string              `json:"Link"`
+}
+
+// MetricResponse is the metric variant of a value sent in both unit systems, current
+// conditions have temperatures in C, speeds in km/h and the pressure in mb
+type MetricResponse struct {
+	Metric struct {
+		Value float32 `json:"Value"`
+		Unit  string  `json:"Unit"`
+	} `json:"Metric"`
+}
+
+type CurrentConditionsResponse struct {
+	LocalObservationDateTime string         `json:"LocalObservationDateTime"`
+	WeatherText              string         `json:"WeatherText"`
+	WeatherIcon              int            `json:"WeatherIcon"`
+	IsDayTime                bool           `json:"IsDayTime"`
+	Temperature              MetricResponse `json:"Temperature"`
+	RealFeelTemperature      MetricResponse `json:"RealFeelTemperature"`
+	RelativeHumidity         float32        `json:"RelativeHumidity"`
+	Wind                     struct {
+		Direction struct {
+			Degrees float32 `json:"Degrees"`
+		} `json:"Direction"`
+		Speed MetricResponse `json:"Speed"`
+	} `json:"Wind"`
+	UVIndex  float32        `json:"UVIndex"`
+	Pressure MetricResponse `json:"Pressure"`
+}
+
+// accuWeatherCondition maps AccuWeather icon numbers, see developer.accuweather.com/weather-icons
+func accuWeatherCondition(icon int) Condition {
+	switch icon {
+	case 1, 2, 30, 31, 33, 34:
+		return ConditionClear
+	case 3, 4, 35, 36:
+		return ConditionPartlyCloudy
+	case 6, 7, 8, 38:
+		return ConditionCloudy
+	case 5, 11, 37:
+		return ConditionFog
+	case 12, 13, 14, 18, 39, 40:
+		return ConditionRain
+	case 24, 25, 26, 29:
+		return ConditionSleet
+	case 19, 20, 21, 22, 23, 43, 44:
+		return ConditionSnow
+	case 15, 16, 17, 41, 42:
+		return ConditionThunderstorm
+	case 32:
+		return ConditionWind
+	default:
+		return ConditionUnknown
+	}
+}
+
+func (p DailyForecastPeriodResponse) toPeriodForecast() PeriodForecast {
+	return PeriodForecast{
+		Phrase:           p.IconPhrase,
+		Condition:        accuWeatherCondition(p.Icon),
+		HasPrecipitation: p.HasPrecipitation,
+	}
+}
+
+func parseForecastTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
+
+func (d DailyForecastResponse) toDailyForecast() DailyForecast {
+	return DailyForecast{
+		Date:    parseForecastTime(d.Date),
+		MinTemp: d.Temperature.Minimum.celsius(),
+		MaxTemp: d.Temperature.Maximum.celsius(),
+		Day:     d.Day.toPeriodForecast(),
+		Night:   d.Night.toPeriodForecast(),
+	}
+}
+
+func (h HourlyForecastResponse) toHourlyForecast() HourlyForecast {
+	return HourlyForecast{
+		Time:                     parseForecastTime(h.DateTime),
+		Temp:                     h.Temperature.celsius(),
+		Phrase:                   h.IconPhrase,
+		Condition:                accuWeatherCondition(h.WeatherIcon),
+		IsDaylight:               h.IsDaylight,
+		HasPrecipitation:         h.HasPrecipitation,
+		PrecipitationProbability: float64(h.PrecipitationProbability),
+	}
+}
+
+func (c CurrentConditionsResponse) toCurrentConditions() *CurrentConditions {
+	return &CurrentConditions{
+		Time:          parseForecastTime(c.LocalObservationDateTime),
+		Temp:          float64(c.Temperature.Metric.Value),
+		FeelsLike:     float64(c.RealFeelTemperature.Metric.Value),
+		Phrase:        c.WeatherText,
+		Condition:     accuWeatherCondition(c.WeatherIcon),
+		IsDaylight:    c.IsDayTime,
+		Humidity:      float64(c.RelativeHumidity),
+		WindSpeed:     float64(c.Wind.Speed.Metric.Value),
+		WindDirection: float64(c.Wind.Direction.Degrees),
+		UVIndex:       float64(c.UVIndex),
+		Pressure:      float64(c.Pressure.Metric.Value),
+	}
+}
+
+func (af *AccuWeatherFetcher) Name() string {
+	return "AccuWeather"
+}
+
+func (af *AccuWeatherFetcher) Set(APIKey string, logger *zerolog.Logger) error {
+	if err := af.BaseFetcher.Set(APIKey, logger); err != nil {
+		return err
+	}
+	if af.locations == nil {
+		af.locations = NewLocationCache(nil, defaultLocationCacheSize)
+	}
+	return nil
+}
+
+// SetLocationCache shares a (persistent) location cache with the fetcher
+func (af *AccuWeatherFetcher) SetLocationCache(locations *LocationCache) {
+	af.locations = locations
+}
+
+// SetQuota shares the daily request quota of the API key with the fetcher
+func (af *AccuWeatherFetcher) SetQuota(quota *Quota) {
+	af.quota = quota
+}
+
+// SetPlan sets the plan of the API key, the free plan is used until it is set
+func (af *AccuWeatherFetcher) SetPlan(plan AccuWeatherPlan) {
+	af.plan = plan
+}
+
+func (af *AccuWeatherFetcher) planOrDefault() AccuWeatherPlan {
+	if len(af.plan.Days) == 0 || len(af.plan.Hours) == 0 {
+		return AccuWeatherFreePlan
+	}
+	return af.plan
+}
+
+// do sends the request and records the quota the response reports
+func (af *AccuWeatherFetcher) do(req *http.Request) (*http.Response, error) {
+	resp, err := af.client.Do(req)
+	if err == nil {
+		af.quota.observe(resp)
+	}
+	return resp, err
+}
+
+// buildCityURL searches the city, the names of the found cities are in the language
+func (af *AccuWeatherFetcher) buildCityURL(city, language string) string {
+	cityURL := fmt.Sprintf("%s/locations/v1/search?q=%s&apikey=%s",
+		af.urlOrDefault(DefaultAccuWeatherBaseURL), url.QueryEscape(NormalizeCity(city)), af.APIKey)
+	if language != "" {
+		cityURL += "&language=" + url.QueryEscape(language)
+	}
+	return cityURL
+}
+
+// buildGeoURL resolves the rounded position to the nearest AccuWeather city
+func (af *AccuWeatherFetcher) buildGeoURL(p GeoPosition, language string) string {
+	r := p.Rounded()
+	geoURL := fmt.Sprintf("%s/locations/v1/cities/geoposition/search?q=%.2f,%.2f&apikey=%s",
+		af.urlOrDefault(DefaultAccuWeatherBaseURL), r.Latitude, r.Longitude, af.APIKey)
+	if language != "" {
+		geoURL += "&language=" + url.QueryEscape(language)
+	}
+	return geoURL
+}
+
+// getLocation resolves the query to a location key, a search with several cities named like
+// the query returns an AmbiguousLocationError and is not cached until the user picks one.
+// The names are in the language of the query and cached per language
+func (af *AccuWeatherFetcher) getLocation(ctx context.Context, q WeatherQuery) (*Location, error) {
+	if q.Location != nil {
+		if q.Location.Key != "" {
+			return q.Location, nil
+		}
+		// picked from another provider, only the position is known
+		position := q.Location.position()
+		q = WeatherQuery{Position: &position, Language: q.Language}
+	}
+
+	query := localizedQuery(q.locationQuery(), q.Language)
+	cached, err := af.locations.Get(ctx, query)
+	if err != nil {
+		// a broken persistent cache must not break forecasts
+		af.logger.Error().Err(err).Msg("error reading weather fetcher location cache")
+	}
+	if cached != nil && cached.Key != "" {
+		return cached, nil
+	}
+
+	locationURL := af.buildCityURL(q.City, q.Language)
+	if q.Position != nil {
+		locationURL = af.buildGeoURL(*q.Position, q.Language)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, locationURL, nil)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error creating weather fetcher location key request")
+		return nil, err
+	}
+
+	resp, err := af.do(req)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error getting weather fetcher location key")
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error reading weather fetcher location key response")
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		af.logger.Error().
+			Int("status_code", resp.StatusCode).
+			Msgf("weather fetcher location search failed: %s", string(body))
+		return nil, newStatusError("location search", resp)
+	}
+
+	// the text search returns a list, the geoposition search a single city or null
+	var locations []LocationResponse
+	if q.Position != nil {
+		var location *LocationResponse
+		err = json.Unmarshal(body, &location)
+		if location != nil && location.Key != "" {
+			locations = append(locations, *location)
+		}
+	} else {
+		err = json.Unmarshal(body, &locations)
+	}
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error unmarshalling weather fetcher location key response")
+		return nil, err
+	}
+
+	if len(locations) == 0 {
+		af.logger.Error().Msg("weather fetcher: no locations found")
+		return nil, ErrLocationNotFound
+	}
+
+	if q.Position == nil {
+		found := make([]Location, len(locations))
+		for i, l := range locations {
+			found[i] = *l.toLocation()
+		}
+		if candidates := ambiguousLocations(q.City, found); candidates != nil {
+			return nil, &AmbiguousLocationError{Query: NormalizeCity(q.City), Candidates: candidates}
+		}
+	}
+
+	location := locations[0].toLocation()
+	if err := af.locations.Save(ctx, query, location); err != nil {
+		af.logger.Error().Err(err).Msg("error saving weather fetcher location cache")
+	}
+
+	return location, nil
+}
+
+// buildURL builds the current conditions URL or the forecast URL of the range from forecastRange
+func (af *AccuWeatherFetcher) buildURL(locationKey string, q WeatherQuery, rangeSegment string) string {
+	if q.Current {
+		// the details add the feels-like temperature, wind, humidity, UV index and pressure
+		currentURL := fmt.Sprintf("%s/currentconditions/v1/%s?apikey=%s&details=true",
+			af.urlOrDefault(DefaultAccuWeatherBaseURL), locationKey, af.APIKey)
+		if q.Language != "" {
+			currentURL += "&language=" + url.QueryEscape(q.Language)
+		}
+		return currentURL
+	}
+
+	baseURL := af.urlOrDefault(DefaultAccuWeatherBaseURL) + "/forecasts/v1/"
+	forecastURL := fmt.Sprintf("%s%s%s?apikey=%s", baseURL, rangeSegment, locationKey, af.APIKey)
+	if q.Language != "" {
+		forecastURL += "&language=" + url.QueryEscape(q.Language)
+	}
+	return forecastURL
+}
+
+func (af *AccuWeatherFetcher) Fetch(ctx context.Context, q WeatherQuery) (*Forecast, error) {
+	if !af.isSet() {
+		return nil, fmt.Errorf("accuweather fetcher is not set")
+	}
+
+	if err := q.Validate(); err != nil {
+		af.logger.Error().Err(err).Msg("invalid weather query")
+		return nil, err
+	}
+
+	// checked before the location search to spend no request on a forecast the plan lacks
+	rangeSegment := ""
+	if !q.Current {
+		var err error
+		if rangeSegment, err = af.planOrDefault().forecastRange(q); err != nil {
+			af.logger.Warn().Err(err).Msg("weather query exceeds the accuweather plan")
+			return nil, err
+		}
+	}
+
+	location, err := af.getLocation(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, af.buildURL(location.Key, q, rangeSegment), nil)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error creating weather fetcher forecast request")
+		return nil, err
+	}
+
+	resp, err := af.do(req)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error getting weather fetcher forecast")
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error reading weather fetcher forecast response")
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		af.logger.Error().
+			Int("status_code", resp.StatusCode).
+			Msgf("weather fetcher forecast request failed: %s", string(body))
+		return nil, newStatusError("forecast", resp)
+	}
+
+	forecast := Forecast{
+		Location:  locationName(location),
+		FetchedAt: time.Now(),
+		Language:  q.Language,
+	}
+	switch {
+	case q.Current:
+		var currentConditionsResponses []CurrentConditionsResponse
+		if err := json.Unmarshal(body, &currentConditionsResponses); err != nil {
+			af.logger.Error().Err(err).Msg("error unmarshalling weather fetcher current conditions response")
+			return nil, err
+		}
+		if len(currentConditionsResponses) == 0 {
+			return nil, errors.New("no current conditions for the location")
+		}
+		forecast.Current = currentConditionsResponses[0].toCurrentConditions()
+	case q.Days > 0:
+		var dailyForecastResponses DailyForecastResponses
+		if err := json.Unmarshal(body, &dailyForecastResponses); err != nil {
+			af.logger.Error().Err(err).Msg("error unmarshalling weather fetcher daily forecast response")
+			return nil, err
+		}
+		days := dailyForecastResponses.DailyForecastResponses
+		for _, d := range days[:min(q.Days, len(days))] {
+			forecast.Daily = append(forecast.Daily, d.toDailyForecast())
+		}
+	default:
+		var hourlyForecastResponses []HourlyForecastResponse
+		if err := json.Unmarshal(body, &hourlyForecastResponses); err != nil {
+			af.logger.Error().Err(err).Msg("error unmarshalling weather fetcher hourly forecast response")
+			return nil, err
+		}
+		for _, h := range hourlyForecastResponses[:min(q.Hours, len(hourlyForecastResponses))] {
+			forecast.Hourly = append(forecast.Hourly, h.toHourlyForecast())
+		}
+	}
+
+	return &forecast, nil
+}
+
+func locationName(l *Location) string {
+	return strings.Trim(strings.Join([]string{l.Name, l.Country}, ", "), ", ")
+}
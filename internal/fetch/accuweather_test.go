@@ -0,0 +1,404 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAccuWeatherFetcher(t *testing.T, client *http.Client, apiKey, baseURL string) *AccuWeatherFetcher {
+	t.Helper()
+	logger := zerolog.Nop()
+	wf := &AccuWeatherFetcher{}
+	wf.SetHTTPClient(client)
+	if baseURL != "" {
+		wf.SetBaseURL(baseURL)
+	}
+	if err := wf.Set(apiKey, &logger); err != nil {
+		t.Fatalf("error setting accuweather fetcher: %v", err)
+	}
+	return wf
+}
+
+func TestAccuWeatherFetcher_Fetch(t *testing.T) {
+	client, apiKey := newCassette(t, "weather_fetch", "ACCU_WEATHER_API_KEY")
+	wf := newTestAccuWeatherFetcher(t, client, apiKey, "")
+
+	tests := []struct {
+		name    string
+		query   WeatherQuery
+		wantErr bool
+	}{
+		{
+			name:    "Valid city and days",
+			query:   WeatherQuery{City: "London", Days: 1},
+			wantErr: false,
+		},
+		{
+			name:    "Valid city and hours",
+			query:   WeatherQuery{City: "London", Hours: 1},
+			wantErr: false,
+		},
+		{
+			name:    "Invalid city",
+			query:   WeatherQuery{City: "InvalidCity", Days: 1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wf.Fetch(context.Background(), tt.query)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, got)
+			}
+		})
+	}
+}
+
+func TestAccuWeatherFetcher_FetchOffline(t *testing.T) {
+	var locationCalls, geoCalls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/locations/v1/cities/geoposition/search", func(w http.ResponseWriter, r *http.Request) {
+		geoCalls++
+		if r.URL.Query().Get("q") == "52.52,13.40" {
+			fmt.Fprint(w, `{"Key":"178087","LocalizedName":"Berlin"}`)
+			return
+		}
+		fmt.Fprint(w, `null`)
+	})
+	mux.HandleFunc("/locations/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		locationCalls++
+		assert.Equal(t, "test-api-key", r.URL.Query().Get("apikey"))
+		switch r.URL.Query().Get("q") {
+		case "berlin":
+			fmt.Fprint(w, `[{"Key":"178087","LocalizedName":"Berlin"}]`)
+		case "quota":
+			fmt.Fprint(w, `[{"Key":"quota"}]`)
+		case "denied":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"Code":"Unauthorized","Message":"Api Authorization failed"}`)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	})
+	mux.HandleFunc("/forecasts/v1/daily/5day/178087", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"DailyForecasts":[
+			{"Date":"2024-11-02T07:00:00+01:00","Temperature":{"Minimum":{"Value":41,"Unit":"F"},"Maximum":{"Value":50,"Unit":"F"}}},
+			{"Date":"2024-11-03T07:00:00+01:00","Temperature":{"Minimum":{"Value":39,"Unit":"F"},"Maximum":{"Value":48,"Unit":"F"}}},
+			{"Date":"2024-11-04T07:00:00+01:00","Temperature":{"Minimum":{"Value":37,"Unit":"F"},"Maximum":{"Value":46,"Unit":"F"}}},
+			{"Date":"2024-11-05T07:00:00+01:00","Temperature":{"Minimum":{"Value":36,"Unit":"F"},"Maximum":{"Value":45,"Unit":"F"}}},
+			{"Date":"2024-11-06T07:00:00+01:00","Temperature":{"Minimum":{"Value":35,"Unit":"F"},"Maximum":{"Value":44,"Unit":"F"}}}
+		]}`)
+	})
+	mux.HandleFunc("/forecasts/v1/hourly/12hour/178087", func(w http.ResponseWriter, _ *http.Request) {
+		hours := make([]string, 12)
+		for i := range hours {
+			hours[i] = fmt.Sprintf(`{"DateTime":"2024-11-02T%02d:00:00+01:00","Temperature":{"Value":45,"Unit":"F"}}`, i+8)
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(hours, ","))
+	})
+	mux.HandleFunc("/forecasts/v1/daily/5day/quota", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"Code":"ServiceUnavailable","Message":"The allowed number of requests has been exceeded."}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wf := newTestAccuWeatherFetcher(t, server.Client(), "test-api-key", server.URL)
+
+	tests := []struct {
+		name       string
+		query      WeatherQuery
+		wantDays   int
+		wantHours  int
+		wantErrMsg string
+	}{
+		{
+			name:     "Daily forecast is truncated to the requested days",
+			query:    WeatherQuery{City: "Berlin", Days: 3},
+			wantDays: 3,
+		},
+		{
+			name:      "Hourly forecast is truncated to the requested hours",
+			query:     WeatherQuery{City: "berlin", Hours: 6},
+			wantHours: 6,
+		},
+		{
+			name:     "Position",
+			query:    WeatherQuery{Position: &GeoPosition{Latitude: 52.5200, Longitude: 13.4049}, Days: 3},
+			wantDays: 3,
+		},
+		{
+			name:     "Nearby position",
+			query:    WeatherQuery{Position: &GeoPosition{Latitude: 52.5213, Longitude: 13.3951}, Days: 2},
+			wantDays: 2,
+		},
+		{
+			name:       "Position without a city",
+			query:      WeatherQuery{Position: &GeoPosition{Latitude: 0, Longitude: -30}, Days: 1},
+			wantErrMsg: "no locations found",
+		},
+		{
+			name:       "Unknown city",
+			query:      WeatherQuery{City: "Atlantis", Days: 1},
+			wantErrMsg: "no locations found",
+		},
+		{
+			name:       "Quota exceeded",
+			query:      WeatherQuery{City: "quota", Days: 2},
+			wantErrMsg: "status 503",
+		},
+		{
+			name:       "Unauthorized",
+			query:      WeatherQuery{City: "denied", Days: 2},
+			wantErrMsg: "status 401",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wf.Fetch(context.Background(), tt.query)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, "Berlin", got.Location)
+				assert.Len(t, got.Daily, tt.wantDays)
+				assert.Len(t, got.Hourly, tt.wantHours)
+			}
+		})
+	}
+
+	// "Berlin" and "berlin" share a single location lookup, so do the nearby positions
+	assert.Equal(t, 4, locationCalls)
+	assert.Equal(t, 2, geoCalls)
+}
+
+func TestAccuWeatherFetcher_AmbiguousLocation(t *testing.T) {
+	var locationCalls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/locations/v1/search", func(w http.ResponseWriter, _ *http.Request) {
+		locationCalls++
+		fmt.Fprint(w, `[
+			{"Key":"623","LocalizedName":"Paris","AdministrativeArea":{"ID":"75","LocalizedName":"Ile-de-France"},"Country":{"ID":"FR","LocalizedName":"France"},"GeoPosition":{"Latitude":48.857,"Longitude":2.341}},
+			{"Key":"351","LocalizedName":"Paris","AdministrativeArea":{"ID":"TX","LocalizedName":"Texas"},"Country":{"ID":"US","LocalizedName":"United States"},"GeoPosition":{"Latitude":33.661,"Longitude":-95.556}}
+		]`)
+	})
+	mux.HandleFunc("/forecasts/v1/daily/1day/351", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "de", r.URL.Query().Get("language"))
+		fmt.Fprint(w, `{"DailyForecasts":[{"Date":"2024-11-02T07:00:00-05:00","Temperature":{"Minimum":{"Value":50,"Unit":"F"},"Maximum":{"Value":68,"Unit":"F"}}}]}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wf := newTestAccuWeatherFetcher(t, server.Client(), "test-api-key", server.URL)
+
+	_, err := wf.Fetch(context.Background(), WeatherQuery{City: "Paris", Days: 1})
+	var ambiguous *AmbiguousLocationError
+	if !assert.ErrorAs(t, err, &ambiguous) {
+		return
+	}
+	assert.Equal(t, "paris", ambiguous.Query)
+	assert.Equal(t, []string{"Paris, Ile-de-France, France", "Paris, Texas, United States"},
+		[]string{ambiguous.Candidates[0].Label(), ambiguous.Candidates[1].Label()})
+
+	// the picked city skips the search
+	picked := ambiguous.Candidates[1]
+	got, err := wf.Fetch(context.Background(), WeatherQuery{City: "Paris", Location: &picked, Days: 1, Language: "de"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Paris, United States", got.Location)
+		assert.Len(t, got.Daily, 1)
+	}
+	assert.Equal(t, 1, locationCalls)
+}
+
+func TestAccuWeatherFetcher_LocalizedLocation(t *testing.T) {
+	var languages []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/locations/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		language := r.URL.Query().Get("language")
+		languages = append(languages, language)
+		name := map[string]string{"de": "München", "ru": "Мюнхен"}[language]
+		if name == "" {
+			name = "Munich"
+		}
+		fmt.Fprintf(w, `[{"Key":"178086","LocalizedName":%q,"Country":{"ID":"DE","LocalizedName":"Germany"}}]`, name)
+	})
+	mux.HandleFunc("/forecasts/v1/daily/1day/178086", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"DailyForecasts":[{"Date":"2024-11-02T07:00:00+01:00","Temperature":{"Minimum":{"Value":41,"Unit":"F"},"Maximum":{"Value":50,"Unit":"F"}}}]}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wf := newTestAccuWeatherFetcher(t, server.Client(), "test-api-key", server.URL)
+
+	// the names are cached per language, English under the plain query
+	for _, tt := range []struct{ language, want string }{
+		{"de", "München, Germany"},
+		{"", "Munich, Germany"},
+		{"de", "München, Germany"},
+		{"en", "Munich, Germany"},
+		{"ru", "Мюнхен, Germany"},
+	} {
+		got, err := wf.Fetch(context.Background(), WeatherQuery{City: "Munich", Days: 1, Language: tt.language})
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.want, got.Location)
+		}
+	}
+	assert.Equal(t, []string{"de", "", "ru"}, languages)
+}
+
+func TestAccuWeatherFetcher_CurrentConditions(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/locations/v1/search", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"Key":"178087","LocalizedName":"Berlin","Country":{"ID":"DE","LocalizedName":"Germany"}}]`)
+	})
+	mux.HandleFunc("/currentconditions/v1/178087", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.URL.Query().Get("details"))
+		fmt.Fprint(w, `[{"LocalObservationDateTime":"2024-11-02T14:05:00+01:00","WeatherText":"Cloudy","WeatherIcon":7,"IsDayTime":true,
+			"Temperature":{"Metric":{"Value":11.1,"Unit":"C"},"Imperial":{"Value":52,"Unit":"F"}},
+			"RealFeelTemperature":{"Metric":{"Value":9.4,"Unit":"C"},"Imperial":{"Value":49,"Unit":"F"}},
+			"RelativeHumidity":71,
+			"Wind":{"Direction":{"Degrees":293,"Localized":"WNW"},"Speed":{"Metric":{"Value":14.8,"Unit":"km/h"},"Imperial":{"Value":9.2,"Unit":"mi/h"}}},
+			"UVIndex":1,"UVIndexText":"Low",
+			"Pressure":{"Metric":{"Value":1014,"Unit":"mb"},"Imperial":{"Value":29.94,"Unit":"inHg"}}}]`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wf := newTestAccuWeatherFetcher(t, server.Client(), "test-api-key", server.URL)
+
+	got, err := wf.Fetch(context.Background(), WeatherQuery{City: "Berlin", Current: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Berlin, Germany", got.Location)
+	assert.Empty(t, got.Daily)
+	assert.Empty(t, got.Hourly)
+	if assert.NotNil(t, got.Current) {
+		assert.Equal(t, ConditionCloudy, got.Current.Condition)
+		assert.InDelta(t, 11.1, got.Current.Temp, 0.01)
+		assert.InDelta(t, 9.4, got.Current.FeelsLike, 0.01)
+		assert.InDelta(t, 14.8, got.Current.WindSpeed, 0.01)
+		assert.Equal(t, 293.0, got.Current.WindDirection)
+		assert.Equal(t, 71.0, got.Current.Humidity)
+		assert.Equal(t, 1.0, got.Current.UVIndex)
+		assert.Equal(t, 1014.0, got.Current.Pressure)
+		assert.Equal(t, time.Date(2024, 11, 2, 13, 5, 0, 0, time.UTC), got.Current.Time.UTC())
+	}
+}
+
+func TestAccuWeatherFetcher_FetchCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	wf := newTestAccuWeatherFetcher(t, server.Client(), "test-api-key", server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := wf.Fetch(ctx, WeatherQuery{City: "Berlin", Days: 1})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestParseAccuWeatherPlan(t *testing.T) {
+	plan, err := ParseAccuWeatherPlan(" Premium ")
+	assert.NoError(t, err)
+	assert.Equal(t, AccuWeatherPremiumPlan, plan)
+
+	plan, err = ParseAccuWeatherPlan("")
+	assert.NoError(t, err)
+	assert.Equal(t, AccuWeatherFreePlan, plan)
+
+	_, err = ParseAccuWeatherPlan("gold")
+	assert.EqualError(t, err, `unknown accuweather plan "gold", use one of free, standard, premium`)
+}
+
+func TestAccuWeatherPlan_ForecastRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		plan    AccuWeatherPlan
+		query   WeatherQuery
+		want    string
+		wantErr string
+	}{
+		{name: "One day", plan: AccuWeatherFreePlan, query: WeatherQuery{Days: 1}, want: "daily/1day/"},
+		{name: "Days round up", plan: AccuWeatherFreePlan, query: WeatherQuery{Days: 3}, want: "daily/5day/"},
+		{name: "Hours round up", plan: AccuWeatherFreePlan, query: WeatherQuery{Hours: 6}, want: "hourly/12hour/"},
+		{name: "Days beyond the free plan", plan: AccuWeatherFreePlan, query: WeatherQuery{Days: 7}, wantErr: "the AccuWeather free plan covers at most 5 days, 7 requested"},
+		{name: "Hours beyond the free plan", plan: AccuWeatherFreePlan, query: WeatherQuery{Hours: 24}, wantErr: "the AccuWeather free plan covers at most 12 hours, 24 requested"},
+		{name: "Standard days", plan: AccuWeatherStandardPlan, query: WeatherQuery{Days: 7}, want: "daily/10day/"},
+		{name: "Standard hours", plan: AccuWeatherStandardPlan, query: WeatherQuery{Hours: 48}, want: "hourly/72hour/"},
+		{name: "Days beyond the standard plan", plan: AccuWeatherStandardPlan, query: WeatherQuery{Days: 15}, wantErr: "the AccuWeather standard plan covers at most 10 days, 15 requested"},
+		{name: "Premium days", plan: AccuWeatherPremiumPlan, query: WeatherQuery{Days: 15}, want: "daily/15day/"},
+		{name: "Premium hours", plan: AccuWeatherPremiumPlan, query: WeatherQuery{Hours: 100}, want: "hourly/120hour/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.plan.forecastRange(tt.query)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAccuWeatherFetcher_Plan(t *testing.T) {
+	var requests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/locations/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		fmt.Fprint(w, `[{"Key":"178087","LocalizedName":"Berlin"}]`)
+	})
+	mux.HandleFunc("/forecasts/v1/daily/10day/178087", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		days := make([]string, 10)
+		for i := range days {
+			days[i] = fmt.Sprintf(`{"Date":"2024-11-%02dT07:00:00+01:00","Temperature":{"Minimum":{"Value":5,"Unit":"C"},"Maximum":{"Value":10,"Unit":"C"}}}`, i+2)
+		}
+		fmt.Fprintf(w, `{"DailyForecasts":[%s]}`, strings.Join(days, ","))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wf := newTestAccuWeatherFetcher(t, server.Client(), "test-api-key", server.URL)
+
+	// the free plan is the default and the query fails before the location search
+	_, err := wf.Fetch(context.Background(), WeatherQuery{City: "Berlin", Days: 7})
+	var planErr *PlanLimitError
+	if assert.ErrorAs(t, err, &planErr) {
+		assert.Equal(t, 5, planErr.Max)
+	}
+	assert.Empty(t, requests)
+
+	wf.SetPlan(AccuWeatherStandardPlan)
+	got, err := wf.Fetch(context.Background(), WeatherQuery{City: "Berlin", Days: 7})
+	if assert.NoError(t, err) {
+		assert.Len(t, got.Daily, 7)
+	}
+	assert.Equal(t, []string{"/locations/v1/search", "/forecasts/v1/daily/10day/178087"}, requests)
+}
@@ -0,0 +1,169 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlertsQuery asks for the severe weather alerts active for a city, Location is the place
+// the user picked when the name was ambiguous
+type AlertsQuery struct {
+	City     string
+	Location *Location
+	Language string
+}
+
+func (q AlertsQuery) Validate() error {
+	if q.Location == nil && strings.TrimSpace(q.City) == "" {
+		return errors.New("city is required")
+	}
+	return nil
+}
+
+func (q AlertsQuery) weatherQuery() WeatherQuery {
+	return WeatherQuery{City: q.City, Location: q.Location, Language: q.Language}
+}
+
+// AlertArea is a part of the alert region with its own validity period
+type AlertArea struct {
+	Name    string
+	Start   time.Time
+	End     time.Time
+	Summary string
+}
+
+// Alert is a severe weather warning issued by a public weather service. The ID stays the
+// same when the alert is updated and the alert disappears when it is cancelled or expires
+type Alert struct {
+	ID          string
+	Description string
+	Category    string
+	Level       string
+	Priority    int
+	Source      string
+	Link        string
+	Areas       []AlertArea
+}
+
+type AlertResponse struct {
+	AlertID     int `json:"AlertID"`
+	Description struct {
+		Localized string `json:"Localized"`
+	} `json:"Description"`
+	Category string `json:"Category"`
+	Priority int    `json:"Priority"`
+	Level    string `json:"Level"`
+	Source   string `json:"Source"`
+	Area     []struct {
+		Name      string `json:"Name"`
+		StartTime string `json:"StartTime"`
+		EndTime   string `json:"EndTime"`
+		Summary   string `json:"Summary"`
+	} `json:"Area"`
+	Link string `json:"Link"`
+}
+
+func (a AlertResponse) toAlert() Alert {
+	alert := Alert{
+		ID:          strconv.Itoa(a.AlertID),
+		Description: a.Description.Localized,
+		Category:    a.Category,
+		Level:       a.Level,
+		Priority:    a.Priority,
+		Source:      a.Source,
+		Link:        a.Link,
+	}
+	for _, area := range a.Area {
+		alert.Areas = append(alert.Areas, AlertArea{
+			Name:    area.Name,
+			Start:   parseForecastTime(area.StartTime),
+			End:     parseForecastTime(area.EndTime),
+			Summary: area.Summary,
+		})
+	}
+	return alert
+}
+
+// AccuWeatherAlertsFetcher fetches the alerts of AccuWeather, it shares the location lookup,
+// its cache and the quota of the API key with the forecasts
+type AccuWeatherAlertsFetcher struct {
+	AccuWeatherFetcher
+}
+
+func (af *AccuWeatherAlertsFetcher) buildAlertsURL(locationKey string, q AlertsQuery) string {
+	alertsURL := fmt.Sprintf("%s/alerts/v1/%s?apikey=%s&details=true",
+		af.urlOrDefault(DefaultAccuWeatherBaseURL), locationKey, af.APIKey)
+	if q.Language != "" {
+		alertsURL += "&language=" + url.QueryEscape(q.Language)
+	}
+	return alertsURL
+}
+
+// Fetch returns the active alerts of the place, the most severe first
+func (af *AccuWeatherAlertsFetcher) Fetch(ctx context.Context, q AlertsQuery) ([]Alert, error) {
+	if !af.isSet() {
+		return nil, fmt.Errorf("accuweather alerts fetcher is not set")
+	}
+
+	if err := q.Validate(); err != nil {
+		af.logger.Error().Err(err).Msg("invalid alerts query")
+		return nil, err
+	}
+
+	location, err := af.getLocation(ctx, q.weatherQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, af.buildAlertsURL(location.Key, q), nil)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error creating alerts fetcher request")
+		return nil, err
+	}
+
+	resp, err := af.do(req)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error getting alerts")
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error reading alerts response")
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		af.logger.Error().
+			Int("status_code", resp.StatusCode).
+			Msgf("alerts request failed: %s", string(body))
+		return nil, newStatusError("alerts", resp)
+	}
+
+	// places without alerts get an empty list or null
+	var alertResponses []AlertResponse
+	if err := json.Unmarshal(body, &alertResponses); err != nil {
+		af.logger.Error().Err(err).Msg("error unmarshalling alerts response")
+		return nil, err
+	}
+
+	alerts := make([]Alert, len(alertResponses))
+	for i, a := range alertResponses {
+		alerts[i] = a.toAlert()
+	}
+	// AccuWeather priorities count from 1 for the most severe
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].Priority < alerts[j].Priority
+	})
+	return alerts, nil
+}
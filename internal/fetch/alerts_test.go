@@ -0,0 +1,97 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccuWeatherAlertsFetcher_Fetch(t *testing.T) {
+	var locationCalls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/locations/v1/search", func(w http.ResponseWriter, _ *http.Request) {
+		locationCalls++
+		w.Header().Set("RateLimit-Remaining", "41")
+		fmt.Fprint(w, `[{"Key":"351","LocalizedName":"Houston","Country":{"ID":"US","LocalizedName":"United States"}}]`)
+	})
+	mux.HandleFunc("/alerts/v1/351", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.URL.Query().Get("details"))
+		w.Header().Set("RateLimit-Remaining", "40")
+		fmt.Fprint(w, `[
+			{"AlertID":41374,"Description":{"Localized":"Heat Advisory"},"Category":"HEAT","Priority":60,"Level":"Minor",
+				"Source":"U.S. National Weather Service","Area":[{"Name":"Harris","StartTime":"2024-07-02T11:00:00-05:00",
+				"EndTime":"2024-07-02T20:00:00-05:00","Summary":"Heat index values up to 110"}]},
+			{"AlertID":41375,"Description":{"Localized":"Flash Flood Warning"},"Category":"FLOOD","Priority":5,"Level":"Severe",
+				"Source":"U.S. National Weather Service","Area":[{"Name":"Harris","StartTime":"2024-07-02T09:00:00-05:00",
+				"EndTime":"2024-07-02T12:00:00-05:00","Summary":"Flash flooding ongoing"}]}
+		]`)
+	})
+	mux.HandleFunc("/alerts/v1/", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `null`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	logger := zerolog.Nop()
+	quota := NewQuota()
+	af := &AccuWeatherAlertsFetcher{}
+	af.SetHTTPClient(server.Client())
+	af.SetBaseURL(server.URL)
+	af.SetQuota(quota)
+	if err := af.Set("test-api-key", &logger); err != nil {
+		t.Fatalf("error setting alerts fetcher: %v", err)
+	}
+
+	_, known := quota.Remaining(time.Hour)
+	assert.False(t, known)
+
+	alerts, err := af.Fetch(context.Background(), AlertsQuery{City: "Houston"})
+	if assert.NoError(t, err) && assert.Len(t, alerts, 2) {
+		// the most severe first
+		assert.Equal(t, "41375", alerts[0].ID)
+		assert.Equal(t, "Flash Flood Warning", alerts[0].Description)
+		assert.Equal(t, "Severe", alerts[0].Level)
+		if assert.Len(t, alerts[0].Areas, 1) {
+			assert.Equal(t, time.Date(2024, 7, 2, 17, 0, 0, 0, time.UTC), alerts[0].Areas[0].End.UTC())
+		}
+	}
+	remaining, known := quota.Remaining(time.Hour)
+	assert.True(t, known)
+	assert.Equal(t, 40, remaining)
+
+	// a picked place skips the search, no alerts is not an error
+	alerts, err = af.Fetch(context.Background(), AlertsQuery{City: "Paris", Location: &Location{Key: "623"}})
+	assert.NoError(t, err)
+	assert.Empty(t, alerts)
+	assert.Equal(t, 1, locationCalls)
+
+	_, err = af.Fetch(context.Background(), AlertsQuery{})
+	assert.Error(t, err)
+}
+
+func TestQuota_Remaining(t *testing.T) {
+	now := time.Date(2024, 7, 2, 12, 0, 0, 0, time.UTC)
+	quota := NewQuota()
+	quota.now = func() time.Time { return now }
+
+	quota.observe(&http.Response{Header: http.Header{"Ratelimit-Remaining": []string{"12"}}})
+	remaining, known := quota.Remaining(time.Hour)
+	assert.True(t, known)
+	assert.Equal(t, 12, remaining)
+
+	// responses without the header keep the last reading
+	quota.observe(&http.Response{Header: http.Header{}})
+	remaining, _ = quota.Remaining(time.Hour)
+	assert.Equal(t, 12, remaining)
+
+	now = now.Add(2 * time.Hour)
+	_, known = quota.Remaining(time.Hour)
+	assert.False(t, known)
+}
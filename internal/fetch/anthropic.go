@@ -0,0 +1,278 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultAnthropicModel   = "claude-3-5-haiku-latest"
+	DefaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+
+	anthropicVersion          = "2023-06-01"
+	defaultAnthropicMaxTokens = 1024
+	maxAnthropicTemperature   = 1.0
+)
+
+// AnthropicFetcher talks to the Anthropic Messages API
+type AnthropicFetcher struct {
+	BaseFetcher
+}
+
+type AnthropicRequest struct {
+	Model       string    `json:"model"`
+	System      string    `json:"system,omitempty"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	Stream      bool      `json:"stream,omitempty"`
+}
+
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type AnthropicResponse struct {
+	Model   string         `json:"model"`
+	Usage   AnthropicUsage `json:"usage"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+// AnthropicStreamEvent covers the stream events used here: message_start,
+// content_block_delta, message_delta, message_stop and error
+type AnthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Model string         `json:"model"`
+		Usage AnthropicUsage `json:"usage"`
+	} `json:"message"`
+	Usage AnthropicUsage `json:"usage"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type AnthropicErrorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// newAnthropicRequest moves the system messages into the system field, the API requires
+// max_tokens and accepts temperatures up to 1 so the OpenAI range is clamped
+func newAnthropicRequest(q ChatQuery) AnthropicRequest {
+	model := q.Model
+	if model == "" {
+		model = DefaultAnthropicModel
+	}
+	maxTokens := q.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+	temperature := q.Temperature
+	if temperature != nil {
+		t := math.Min(*temperature, maxAnthropicTemperature)
+		temperature = &t
+	}
+
+	system, messages := splitSystem(q)
+	return AnthropicRequest{
+		Model:       model,
+		System:      system,
+		Messages:    messages,
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+	}
+}
+
+func (af *AnthropicFetcher) Name() string {
+	return "Anthropic"
+}
+
+func (af *AnthropicFetcher) statusError(resp *http.Response, body []byte) error {
+	var errResp AnthropicErrorResponse
+	_ = json.Unmarshal(body, &errResp)
+	af.logger.Error().
+		Int("status_code", resp.StatusCode).
+		Msgf("anthropic API request failed: %s", string(body))
+	// 529 overloaded counts as a server error for retries and the circuit breaker
+	statusErr := newStatusError("anthropic API", resp)
+	statusErr.Message = errResp.Error.Message
+	return statusErr
+}
+
+func (af *AnthropicFetcher) newRequest(ctx context.Context, reqBody AnthropicRequest) (*http.Request, error) {
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error marshalling request body")
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, af.urlOrDefault(DefaultAnthropicBaseURL)+"/messages", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error creating request")
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", af.APIKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	return req, nil
+}
+
+func (af *AnthropicFetcher) Fetch(ctx context.Context, q ChatQuery) (*ChatCompletion, error) {
+	if !af.isSet() {
+		return nil, errors.New("anthropic fetcher is not set")
+	}
+
+	if err := q.Validate(); err != nil {
+		af.logger.Error().Err(err).Msg("invalid chat query")
+		return nil, err
+	}
+
+	req, err := af.newRequest(ctx, newAnthropicRequest(q))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := af.client.Do(req)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error sending request")
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error reading response body")
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, af.statusError(resp, body)
+	}
+
+	var anthropicResp AnthropicResponse
+	if err := json.Unmarshal(body, &anthropicResp); err != nil {
+		af.logger.Error().Err(err).Msg("error unmarshalling response body")
+		return nil, err
+	}
+
+	var content strings.Builder
+	for _, block := range anthropicResp.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+	if content.Len() == 0 {
+		af.logger.Error().Msg("no valid response from Anthropic")
+		return nil, errors.New("no valid response from Anthropic")
+	}
+
+	completion := &ChatCompletion{
+		Content: content.String(),
+		Model:   anthropicResp.Model,
+		Usage: ChatUsage{
+			PromptTokens:     anthropicResp.Usage.InputTokens,
+			CompletionTokens: anthropicResp.Usage.OutputTokens,
+		},
+	}
+	completion.estimateUsage(q)
+	return completion, nil
+}
+
+// Stream uses the server-sent events mode of the Messages API, like the OpenAI
+// stream it is bounded by the ctx only
+func (af *AnthropicFetcher) Stream(ctx context.Context, q ChatQuery, onDelta func(delta string)) (*ChatCompletion, error) {
+	if !af.isSet() {
+		return nil, errors.New("anthropic fetcher is not set")
+	}
+
+	if err := q.Validate(); err != nil {
+		af.logger.Error().Err(err).Msg("invalid chat query")
+		return nil, err
+	}
+
+	reqBody := newAnthropicRequest(q)
+	reqBody.Stream = true
+
+	req, err := af.newRequest(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	streamClient := *af.client
+	streamClient.Timeout = 0
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error sending stream request")
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, af.statusError(resp, body)
+	}
+
+	var content strings.Builder
+	completion := &ChatCompletion{Model: reqBody.Model}
+
+	err = scanStream(resp.Body, "data:", func(data string) (bool, error) {
+		var event AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			af.logger.Error().Err(err).Msg("error unmarshalling stream event")
+			return false, err
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message.Model != "" {
+				completion.Model = event.Message.Model
+			}
+			completion.Usage.PromptTokens = event.Message.Usage.InputTokens
+		case "message_delta":
+			// the output token count is cumulative
+			completion.Usage.CompletionTokens = event.Usage.OutputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				content.WriteString(event.Delta.Text)
+				onDelta(event.Delta.Text)
+			}
+		case "message_stop":
+			return true, nil
+		case "error":
+			return false, errors.New("anthropic API stream failed: " + event.Error.Message)
+		}
+		return false, nil
+	})
+	if err != nil {
+		af.logger.Error().Err(err).Msg("error reading stream")
+		return nil, err
+	}
+
+	completion.Content = content.String()
+	if completion.Content == "" {
+		return nil, errors.New("no valid response from Anthropic")
+	}
+	completion.estimateUsage(q)
+	return completion, nil
+}
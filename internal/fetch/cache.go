@@ -0,0 +1,146 @@
+package fetch
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// CacheableQuery is a query that can be served from a cache, equal keys must yield equal results
+type CacheableQuery interface {
+	Query
+	CacheKey() string
+}
+
+type cacheEntry[R any] struct {
+	value     R
+	expiresAt time.Time
+}
+
+type flightCall[R any] struct {
+	done  chan struct{}
+	value R
+	err   error
+}
+
+// DefaultFlightTimeout bounds a coalesced upstream call, it no longer follows the context of
+// the caller that started it
+const DefaultFlightTimeout = time.Minute
+
+// CachedFetcher wraps any Fetchable with a TTL cache bounded by LRU eviction,
+// concurrent identical queries are coalesced into a single upstream call.
+// A result is shared by every caller of the key and by the cache, so it must be treated as
+// read-only: copy it before changing anything behind a pointer
+type CachedFetcher[Q CacheableQuery, R any] struct {
+	inner         Fetchable[Q, R]
+	ttl           func(q Q) time.Duration
+	flightTimeout time.Duration
+	cache         *lru[string, cacheEntry[R]]
+	logger        *zerolog.Logger
+
+	mu       sync.Mutex
+	inflight map[string]*flightCall[R]
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewCachedFetcher[Q CacheableQuery, R any](inner Fetchable[Q, R], size int, ttl func(q Q) time.Duration) *CachedFetcher[Q, R] {
+	return &CachedFetcher[Q, R]{
+		inner:         inner,
+		ttl:           ttl,
+		flightTimeout: DefaultFlightTimeout,
+		cache:         newLRU[string, cacheEntry[R]](size),
+		inflight:      make(map[string]*flightCall[R]),
+	}
+}
+
+// SetFlightTimeout changes how long a coalesced upstream call may run
+func (cf *CachedFetcher[Q, R]) SetFlightTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		cf.flightTimeout = timeout
+	}
+}
+
+func (cf *CachedFetcher[Q, R]) Set(APIKey string, logger *zerolog.Logger) error {
+	cf.logger = logger
+	return cf.inner.Set(APIKey, logger)
+}
+
+func (cf *CachedFetcher[Q, R]) Fetch(ctx context.Context, q Q) (R, error) {
+	var zero R
+	if err := q.Validate(); err != nil {
+		return zero, err
+	}
+
+	key := q.CacheKey()
+	if e, ok := cf.cache.get(key); ok {
+		if time.Now().Before(e.expiresAt) {
+			cf.hits.Add(1)
+			if cf.logger != nil {
+				cf.logger.Debug().Str("key", key).Msg("fetch cache hit")
+			}
+			return e.value, nil
+		}
+		cf.cache.remove(key)
+	}
+	cf.misses.Add(1)
+
+	cf.mu.Lock()
+	call, ok := cf.inflight[key]
+	if !ok {
+		call = &flightCall[R]{done: make(chan struct{})}
+		cf.inflight[key] = call
+		// the call is shared, so one caller giving up must not fail the others
+		flightCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cf.flightTimeout)
+		go func() {
+			defer cancel()
+			cf.fly(flightCtx, key, q, call)
+		}()
+	}
+	cf.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// fly makes the upstream call for the key and publishes the result to every waiter
+func (cf *CachedFetcher[Q, R]) fly(ctx context.Context, key string, q Q, call *flightCall[R]) {
+	call.value, call.err = cf.inner.Fetch(ctx, q)
+	if call.err == nil {
+		if ttl := cf.ttl(q); ttl > 0 {
+			cf.cache.add(key, cacheEntry[R]{value: call.value, expiresAt: time.Now().Add(ttl)})
+		}
+	}
+
+	cf.mu.Lock()
+	delete(cf.inflight, key)
+	cf.mu.Unlock()
+	close(call.done)
+}
+
+// CacheStats is a snapshot of the cache counters
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+}
+
+func (cf *CachedFetcher[Q, R]) Stats() CacheStats {
+	return CacheStats{
+		Hits:    cf.hits.Load(),
+		Misses:  cf.misses.Load(),
+		Entries: cf.cache.len(),
+	}
+}
+
+func (cf *CachedFetcher[Q, R]) Purge() {
+	cf.cache.purge()
+}
@@ -0,0 +1,155 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func (q stubQuery) CacheKey() string {
+	return q.Value
+}
+
+// blockingFetcher holds every call until release is closed
+type blockingFetcher struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (bf *blockingFetcher) Set(string, *zerolog.Logger) error {
+	return nil
+}
+
+func (bf *blockingFetcher) Fetch(_ context.Context, q stubQuery) (string, error) {
+	bf.calls.Add(1)
+	<-bf.release
+	return q.Value, nil
+}
+
+func TestCachedFetcher_TTL(t *testing.T) {
+	inner := &stubFetcher{}
+	cf := NewCachedFetcher[stubQuery, string](inner, 10, func(q stubQuery) time.Duration {
+		if q.Value == "short" {
+			return 20 * time.Millisecond
+		}
+		return time.Hour
+	})
+
+	for i := 0; i < 3; i++ {
+		got, err := cf.Fetch(context.Background(), stubQuery{Value: "long"})
+		assert.NoError(t, err)
+		assert.Equal(t, "long", got)
+	}
+	assert.Equal(t, 1, inner.calls)
+
+	_, _ = cf.Fetch(context.Background(), stubQuery{Value: "short"})
+	time.Sleep(30 * time.Millisecond)
+	_, _ = cf.Fetch(context.Background(), stubQuery{Value: "short"})
+	assert.Equal(t, 3, inner.calls)
+
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 3, Entries: 2}, cf.Stats())
+}
+
+func TestCachedFetcher_ErrorsAreNotCached(t *testing.T) {
+	inner := &stubFetcher{errs: []error{errors.New("boom")}}
+	cf := NewCachedFetcher[stubQuery, string](inner, 10, func(stubQuery) time.Duration { return time.Hour })
+
+	_, err := cf.Fetch(context.Background(), stubQuery{Value: "x"})
+	assert.Error(t, err)
+
+	got, err := cf.Fetch(context.Background(), stubQuery{Value: "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, "x", got)
+	assert.Equal(t, 2, inner.calls)
+}
+
+func TestCachedFetcher_LRUEviction(t *testing.T) {
+	inner := &stubFetcher{}
+	cf := NewCachedFetcher[stubQuery, string](inner, 2, func(stubQuery) time.Duration { return time.Hour })
+
+	for _, v := range []string{"a", "b", "a", "c", "a", "b"} {
+		_, _ = cf.Fetch(context.Background(), stubQuery{Value: v})
+	}
+	// "b" was evicted by "c" as the least recently used entry
+	assert.Equal(t, 4, inner.calls)
+	assert.Equal(t, 2, cf.Stats().Entries)
+}
+
+func TestCachedFetcher_Coalescing(t *testing.T) {
+	inner := &blockingFetcher{release: make(chan struct{})}
+	cf := NewCachedFetcher[stubQuery, string](inner, 10, func(stubQuery) time.Duration { return time.Hour })
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cf.Fetch(context.Background(), stubQuery{Value: "same"})
+		}(i)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), inner.calls.Load())
+	for _, r := range results {
+		assert.Equal(t, "same", r)
+	}
+}
+
+func TestWeatherQuery_CacheKey(t *testing.T) {
+	assert.Equal(t,
+		WeatherQuery{City: "London", Days: 5}.CacheKey(),
+		WeatherQuery{City: " london ", Days: 5}.CacheKey(),
+	)
+	assert.NotEqual(t,
+		WeatherQuery{City: "London", Days: 5}.CacheKey(),
+		WeatherQuery{City: "London", Hours: 5}.CacheKey(),
+	)
+	assert.Equal(t,
+		"geo:52.52,13.40|1|0",
+		WeatherQuery{Position: &GeoPosition{Latitude: 52.5213, Longitude: 13.3951}, Days: 1}.CacheKey(),
+	)
+	// the picked city does not share the forecast of the ambiguous search
+	assert.Equal(t,
+		"key:351|1|0",
+		WeatherQuery{City: "Paris", Location: &Location{Key: "351"}, Days: 1}.CacheKey(),
+	)
+	assert.Equal(t, "berlin|1|0|de", WeatherQuery{City: "Berlin", Days: 1, Language: "de"}.CacheKey())
+	assert.Equal(t, "berlin|0|0|now", WeatherQuery{City: "Berlin", Current: true}.CacheKey())
+}
+
+func TestCachedFetcher_CancelledCallerDoesNotFailWaiters(t *testing.T) {
+	inner := &blockingFetcher{release: make(chan struct{})}
+	cf := NewCachedFetcher[stubQuery, string](inner, 10, func(stubQuery) time.Duration { return time.Hour })
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := cf.Fetch(leaderCtx, stubQuery{Value: "same"})
+		leaderErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	waiter := make(chan string, 1)
+	go func() {
+		v, _ := cf.Fetch(context.Background(), stubQuery{Value: "same"})
+		waiter <- v
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-leaderErr, context.Canceled)
+
+	close(inner.release)
+	assert.Equal(t, "same", <-waiter)
+	assert.Equal(t, int32(1), inner.calls.Load())
+}
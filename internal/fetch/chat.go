@@ -2,19 +2,26 @@ package fetch
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"time"
+	"strings"
 
 	"github.com/rs/zerolog"
 )
 
+const (
+	DefaultChatModel     = "gpt-3.5-turbo"
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+)
+
+// ChatFetcher talks to the OpenAI chat completions API or to any server compatible
+// with it, e.g. llama.cpp, vLLM or Ollama on its /v1 endpoint
 type ChatFetcher struct {
 	BaseFetcher
-	client *http.Client
 }
 
 type Message struct {
@@ -22,93 +29,372 @@ type Message struct {
 	Content string `json:"content"`
 }
 
+type ChatQuery struct {
+	Messages []Message
+	Model    string
+	// System is sent as the first system message when not empty
+	System      string
+	Temperature *float64
+	MaxTokens   int
+}
+
+const MaxChatTemperature = 2.0
+
+func (q ChatQuery) Validate() error {
+	if len(q.Messages) == 0 {
+		return errors.New("at least one message is required")
+	}
+	if q.Temperature != nil && (*q.Temperature < 0 || *q.Temperature > MaxChatTemperature) {
+		return fmt.Errorf("temperature must be between 0 and %.0f", MaxChatTemperature)
+	}
+	if q.MaxTokens < 0 {
+		return errors.New("max tokens must be positive")
+	}
+	for _, m := range q.Messages {
+		if m.Role == "" {
+			return errors.New("message role is required")
+		}
+	}
+	if q.Messages[len(q.Messages)-1].Content == "" {
+		return errors.New("message is required")
+	}
+	return nil
+}
+
+// EstimateTokens approximates the token count of the text, about 4 characters per token for English
+func EstimateTokens(text string) int {
+	return (len([]rune(text)) + 3) / 4
+}
+
+// TrimHistory keeps the latest messages fitting into maxMessages and maxTokens (0 means no limit),
+// the last message is always kept and system messages at the start are preserved
+func TrimHistory(messages []Message, maxMessages, maxTokens int) []Message {
+	var system []Message
+	for len(messages) > 0 && messages[0].Role == "system" {
+		system = append(system, messages[0])
+		messages = messages[1:]
+	}
+
+	tokens := 0
+	for _, m := range system {
+		tokens += EstimateTokens(m.Content)
+	}
+
+	start := len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		kept := len(messages) - i
+		tokens += EstimateTokens(messages[i].Content)
+		if i < len(messages)-1 && ((maxMessages > 0 && kept > maxMessages) || (maxTokens > 0 && tokens > maxTokens)) {
+			break
+		}
+		start = i
+	}
+
+	// do not start the conversation with a dangling assistant answer
+	for start < len(messages)-1 && messages[start].Role == "assistant" {
+		start++
+	}
+
+	return append(system, messages[start:]...)
+}
+
+// ChatUsage is the token count reported by the backend or estimated from the text if it reports none
+type ChatUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool
+}
+
+func (u ChatUsage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+type ChatCompletion struct {
+	Content string
+	Model   string
+	Usage   ChatUsage
+}
+
+// estimateUsage fills in the usage for the backends which do not report it
+func (c *ChatCompletion) estimateUsage(q ChatQuery) {
+	if c.Usage.PromptTokens > 0 || c.Usage.CompletionTokens > 0 {
+		return
+	}
+	prompt := EstimateTokens(q.System)
+	for _, m := range q.Messages {
+		prompt += EstimateTokens(m.Content)
+	}
+	c.Usage = ChatUsage{PromptTokens: prompt, CompletionTokens: EstimateTokens(c.Content), Estimated: true}
+}
+
+// PartialCompletion is the answer of a request that broke off, the usage is estimated from
+// the query and the text received so far since the backend reported none
+func PartialCompletion(q ChatQuery, content string) *ChatCompletion {
+	c := &ChatCompletion{Content: content, Model: q.Model}
+	c.estimateUsage(q)
+	return c
+}
+
 type ChatGPTRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model         string                `json:"model"`
+	Messages      []Message             `json:"messages"`
+	Temperature   *float64              `json:"temperature,omitempty"`
+	MaxTokens     int                   `json:"max_tokens,omitempty"`
+	Stream        bool                  `json:"stream,omitempty"`
+	StreamOptions *ChatGPTStreamOptions `json:"stream_options,omitempty"`
+}
+
+// ChatGPTStreamOptions asks for the usage in the last stream chunk
+type ChatGPTStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type ChatGPTUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *ChatGPTUsage) toUsage() ChatUsage {
+	if u == nil {
+		return ChatUsage{}
+	}
+	return ChatUsage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+}
+
+func newChatGPTRequest(q ChatQuery) ChatGPTRequest {
+	model := q.Model
+	if model == "" {
+		model = DefaultChatModel
+	}
+
+	messages := q.Messages
+	if q.System != "" {
+		messages = append([]Message{{Role: "system", Content: q.System}}, messages...)
+	}
+
+	return ChatGPTRequest{
+		Model:       model,
+		Messages:    messages,
+		Temperature: q.Temperature,
+		MaxTokens:   q.MaxTokens,
+	}
+}
+
+type ChatGPTStreamChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *ChatGPTUsage `json:"usage"`
+}
+
+type ChatGPTErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
 }
 
 type ChatGPTResponse struct {
+	Model   string `json:"model"`
 	Choices []struct {
 		Message struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage *ChatGPTUsage `json:"usage"`
+}
+
+func (cf *ChatFetcher) Name() string {
+	return "OpenAI"
 }
 
+// Set allows an empty API key for self-hosted servers set with SetBaseURL
 func (cf *ChatFetcher) Set(APIKey string, logger *zerolog.Logger) error {
-	if err := cf.BaseFetcher.Set(APIKey, logger); err != nil {
-		return err
+	if APIKey != "" || cf.baseURL == "" {
+		return cf.BaseFetcher.Set(APIKey, logger)
 	}
-	cf.client = &http.Client{
-		Timeout: 10 * time.Second,
+	if logger == nil {
+		return errors.New("logger is required")
+	}
+	cf.logger = logger
+	if cf.client == nil {
+		cf.client = &http.Client{
+			Timeout: defaultClientTimeout,
+		}
 	}
 	return nil
 }
 
-func (cf *ChatFetcher) Fetch(qParams map[string]interface{}) (string, error) {
-	if !cf.isSet() {
-		cf.logger.Error().Msg("chat fetcher is not set")
-		return "", errors.New("chat fetcher is not set")
-	}
-
-	userMessage, ok := qParams["message"].(string)
-	if !ok || userMessage == "" {
-		cf.logger.Error().Msg("message is required")
-		return "", errors.New("message is required")
-	}
+func (cf *ChatFetcher) isSet() bool {
+	return cf.logger != nil && cf.client != nil && (cf.APIKey != "" || cf.baseURL != "")
+}
 
-	reqBody := ChatGPTRequest{
-		Model: "gpt-3.5-turbo",
-		Messages: []Message{
-			{Role: "user", Content: userMessage},
-		},
-	}
+func (cf *ChatFetcher) statusError(resp *http.Response, body []byte) error {
+	var errResp ChatGPTErrorResponse
+	_ = json.Unmarshal(body, &errResp)
+	cf.logger.Error().
+		Int("status_code", resp.StatusCode).
+		Msgf("chat API request failed: %s", string(body))
+	statusErr := newStatusError("chat API", resp)
+	statusErr.Message = errResp.Error.Message
+	return statusErr
+}
 
+func (cf *ChatFetcher) newRequest(ctx context.Context, reqBody ChatGPTRequest) (*http.Request, error) {
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
 		cf.logger.Error().Err(err).Msg("error marshalling request body")
-		return "", err
+		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cf.urlOrDefault(DefaultOpenAIBaseURL)+"/chat/completions", bytes.NewBuffer(jsonBody))
 	if err != nil {
 		cf.logger.Error().Err(err).Msg("error creating request")
-		return "", err
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cf.APIKey))
+	if cf.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cf.APIKey))
+	}
+	return req, nil
+}
+
+func (cf *ChatFetcher) Fetch(ctx context.Context, q ChatQuery) (*ChatCompletion, error) {
+	if !cf.isSet() {
+		return nil, errors.New("chat fetcher is not set")
+	}
+
+	if err := q.Validate(); err != nil {
+		cf.logger.Error().Err(err).Msg("invalid chat query")
+		return nil, err
+	}
+
+	req, err := cf.newRequest(ctx, newChatGPTRequest(q))
+	if err != nil {
+		return nil, err
+	}
 
 	resp, err := cf.client.Do(req)
 	if err != nil {
 		cf.logger.Error().Err(err).Msg("error sending request")
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		cf.logger.Error().Err(err).Msg("error reading response body")
-		return "", err
+		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		cf.logger.Error().
-			Int("status_code", resp.StatusCode).
-			Msgf("chat API request failed: %s", string(body))
-		return "", fmt.Errorf("chat API request failed with status %d", resp.StatusCode)
+		return nil, cf.statusError(resp, body)
 	}
 
 	var chatGPTResp ChatGPTResponse
 	if err := json.Unmarshal(body, &chatGPTResp); err != nil {
 		cf.logger.Error().Err(err).Msg("error unmarshalling response body")
-		return "", err
+		return nil, err
 	}
 
 	if len(chatGPTResp.Choices) == 0 || chatGPTResp.Choices[0].Message.Content == "" {
 		cf.logger.Error().Msg("no valid response from ChatGPT")
-		return "", errors.New("no valid response from ChatGPT")
+		return nil, errors.New("no valid response from ChatGPT")
 	}
 
-	return chatGPTResp.Choices[0].Message.Content, nil
+	completion := &ChatCompletion{
+		Content: chatGPTResp.Choices[0].Message.Content,
+		Model:   chatGPTResp.Model,
+		Usage:   chatGPTResp.Usage.toUsage(),
+	}
+	completion.estimateUsage(q)
+	return completion, nil
+}
+
+// ChatStreamer streams a completion, onDelta is called with every new piece of the answer
+type ChatStreamer interface {
+	Stream(ctx context.Context, q ChatQuery, onDelta func(delta string)) (*ChatCompletion, error)
+}
+
+// Stream uses the server-sent events mode of the chat completions API. The client timeout
+// does not apply since long answers take longer, the stream is bounded by the ctx only
+func (cf *ChatFetcher) Stream(ctx context.Context, q ChatQuery, onDelta func(delta string)) (*ChatCompletion, error) {
+	if !cf.isSet() {
+		return nil, errors.New("chat fetcher is not set")
+	}
+
+	if err := q.Validate(); err != nil {
+		cf.logger.Error().Err(err).Msg("invalid chat query")
+		return nil, err
+	}
+
+	reqBody := newChatGPTRequest(q)
+	reqBody.Stream = true
+	reqBody.StreamOptions = &ChatGPTStreamOptions{IncludeUsage: true}
+
+	req, err := cf.newRequest(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	streamClient := *cf.client
+	streamClient.Timeout = 0
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		cf.logger.Error().Err(err).Msg("error sending stream request")
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, cf.statusError(resp, body)
+	}
+
+	var content strings.Builder
+	completion := &ChatCompletion{Model: reqBody.Model}
+
+	err = scanStream(resp.Body, "data:", func(data string) (bool, error) {
+		if data == "[DONE]" {
+			return true, nil
+		}
+
+		var chunk ChatGPTStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			cf.logger.Error().Err(err).Msg("error unmarshalling stream chunk")
+			return false, err
+		}
+		if chunk.Model != "" {
+			completion.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			completion.Usage = chunk.Usage.toUsage()
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+		return false, nil
+	})
+	if err != nil {
+		cf.logger.Error().Err(err).Msg("error reading stream")
+		return nil, err
+	}
+
+	completion.Content = content.String()
+	if completion.Content == "" {
+		return nil, errors.New("no valid response from ChatGPT")
+	}
+	completion.estimateUsage(q)
+	return completion, nil
 }
@@ -1,55 +1,58 @@
 package fetch
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"net/http/httptest"
 	"testing"
+	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestChatFetcher_Fetch(t *testing.T) {
-	err := godotenv.Load("../../.env")
-	if err != nil {
-		t.Skip("no .env file found, skipping TestChatFetcher_Fetch")
+func newTestChatFetcher(t *testing.T, client *http.Client, apiKey, baseURL string) *ChatFetcher {
+	t.Helper()
+	logger := zerolog.Nop()
+	cf := &ChatFetcher{}
+	cf.SetHTTPClient(client)
+	if baseURL != "" {
+		cf.SetBaseURL(baseURL)
 	}
-
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		t.Skip("no OpenAI API key found in env, skipping TestChatFetcher_Fetch")
+	if err := cf.Set(apiKey, &logger); err != nil {
+		t.Fatalf("error setting chat fetcher: %v", err)
 	}
+	return cf
+}
 
-	cf := ChatFetcher{
-		BaseFetcher: BaseFetcher{
-			APIKey: apiKey,
-			logger: &zerolog.Logger{},
-		},
-		client: &http.Client{},
-	}
+func TestChatFetcher_Fetch(t *testing.T) {
+	client, apiKey := newCassette(t, "chat_fetch", "OPEN_AI_API_KEY")
+	cf := newTestChatFetcher(t, client, apiKey, "")
 
 	tests := []struct {
 		name    string
-		params  map[string]interface{}
+		query   ChatQuery
 		wantErr bool
 	}{
 		{
 			name: "Valid message",
-			params: map[string]interface{}{
-				"message": "Hello, World!",
+			query: ChatQuery{
+				Messages: []Message{{Role: "user", Content: "Hello, World!"}},
 			},
 			wantErr: false,
 		},
 		{
 			name:    "Missing message",
-			params:  map[string]interface{}{},
+			query:   ChatQuery{},
 			wantErr: true,
 		},
 		{
 			name: "Empty message",
-			params: map[string]interface{}{
-				"message": "",
+			query: ChatQuery{
+				Messages: []Message{{Role: "user", Content: ""}},
 			},
 			wantErr: true,
 		},
@@ -57,13 +60,272 @@ func TestChatFetcher_Fetch(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := cf.Fetch(tt.params)
+			got, err := cf.Fetch(context.Background(), tt.query)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				if assert.NoError(t, err) {
+					assert.NotEmpty(t, got.Content)
+				}
+			}
+		})
+	}
+}
+
+func TestChatFetcher_FetchOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-api-key", r.Header.Get("Authorization"))
+
+		var req ChatGPTRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch req.Messages[len(req.Messages)-1].Content {
+		case "rate limit":
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"Rate limit reached","type":"requests"}}`)
+		case "server error":
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"message":"The server had an error","type":"server_error"}}`)
+		case "empty":
+			fmt.Fprint(w, `{"model":"gpt-3.5-turbo-0125","choices":[]}`)
+		case "no usage":
+			fmt.Fprint(w, `{"model":"llama-3","choices":[{"message":{"role":"assistant","content":"pong"}}]}`)
+		default:
+			fmt.Fprintf(w, `{"model":"%s-0125","choices":[{"message":{"role":"assistant","content":"pong"}}],"usage":{"prompt_tokens":9,"completion_tokens":1}}`, req.Model)
+		}
+	}))
+	defer server.Close()
+
+	cf := newTestChatFetcher(t, server.Client(), "test-api-key", server.URL)
+
+	tests := []struct {
+		name       string
+		query      ChatQuery
+		want       *ChatCompletion
+		wantErrMsg string
+	}{
+		{
+			name:  "Default model",
+			query: ChatQuery{Messages: []Message{{Role: "user", Content: "ping"}}},
+			want:  &ChatCompletion{Content: "pong", Model: "gpt-3.5-turbo-0125", Usage: ChatUsage{PromptTokens: 9, CompletionTokens: 1}},
+		},
+		{
+			name:  "Custom model",
+			query: ChatQuery{Messages: []Message{{Role: "user", Content: "ping"}}, Model: "gpt-4o"},
+			want:  &ChatCompletion{Content: "pong", Model: "gpt-4o-0125", Usage: ChatUsage{PromptTokens: 9, CompletionTokens: 1}},
+		},
+		{
+			name:  "Estimated usage",
+			query: ChatQuery{Messages: []Message{{Role: "user", Content: "no usage"}}},
+			want:  &ChatCompletion{Content: "pong", Model: "llama-3", Usage: ChatUsage{PromptTokens: 2, CompletionTokens: 1, Estimated: true}},
+		},
+		{
+			name:       "Rate limited",
+			query:      ChatQuery{Messages: []Message{{Role: "user", Content: "rate limit"}}},
+			wantErrMsg: "status 429",
+		},
+		{
+			name:       "Server error",
+			query:      ChatQuery{Messages: []Message{{Role: "user", Content: "server error"}}},
+			wantErrMsg: "status 500",
+		},
+		{
+			name:       "No choices",
+			query:      ChatQuery{Messages: []Message{{Role: "user", Content: "empty"}}},
+			wantErrMsg: "no valid response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cf.Fetch(context.Background(), tt.query)
+			if tt.wantErrMsg != "" {
+				assert.ErrorContains(t, err, tt.wantErrMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestChatQuery_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   ChatQuery
+		wantErr bool
+	}{
+		{
+			name:    "Single user message",
+			query:   ChatQuery{Messages: []Message{{Role: "user", Content: "hi"}}},
+			wantErr: false,
+		},
+		{
+			name:    "No messages",
+			query:   ChatQuery{},
+			wantErr: true,
+		},
+		{
+			name:    "Missing role",
+			query:   ChatQuery{Messages: []Message{{Content: "hi"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Empty last message",
+			query:   ChatQuery{Messages: []Message{{Role: "user", Content: ""}}},
+			wantErr: true,
+		},
+		{
+			name:    "Temperature out of range",
+			query:   ChatQuery{Messages: []Message{{Role: "user", Content: "hi"}}, Temperature: ptr(2.5)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.NotEmpty(t, got)
 			}
 		})
 	}
 }
+
+func TestTrimHistory(t *testing.T) {
+	history := []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "first question"},
+		{Role: "assistant", Content: "first answer"},
+		{Role: "user", Content: "second question"},
+		{Role: "assistant", Content: "second answer"},
+		{Role: "user", Content: "third question"},
+	}
+
+	tests := []struct {
+		name        string
+		maxMessages int
+		maxTokens   int
+		want        []string
+	}{
+		{
+			name: "No limits",
+			want: []string{"be brief", "first question", "first answer", "second question", "second answer", "third question"},
+		},
+		{
+			name:        "Message limit",
+			maxMessages: 3,
+			want:        []string{"be brief", "second question", "second answer", "third question"},
+		},
+		{
+			name:        "Trimmed history does not start with an answer",
+			maxMessages: 2,
+			want:        []string{"be brief", "third question"},
+		},
+		{
+			name:      "Token limit",
+			maxTokens: 14,
+			want:      []string{"be brief", "second question", "second answer", "third question"},
+		},
+		{
+			name:      "Last message is always kept",
+			maxTokens: 1,
+			want:      []string{"be brief", "third question"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range TrimHistory(history, tt.maxMessages, tt.maxTokens) {
+				got = append(got, m.Content)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestChatFetcher_Stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatGPTRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream || req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch req.Messages[len(req.Messages)-1].Content {
+		case "rate limit":
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		case "truncated":
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, piece := range []string{"Hel", "lo", "!"} {
+			fmt.Fprintf(w, "data: {\"model\":\"gpt-3.5-turbo-0125\",\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", piece)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, ": keep-alive comment\n\ndata: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	cf := newTestChatFetcher(t, server.Client(), "test-api-key", server.URL)
+
+	var deltas []string
+	got, err := cf.Stream(context.Background(), ChatQuery{Messages: []Message{{Role: "user", Content: "hi"}}}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, &ChatCompletion{
+			Content: "Hello!",
+			Model:   "gpt-3.5-turbo-0125",
+			Usage:   ChatUsage{PromptTokens: 1, CompletionTokens: 2, Estimated: true},
+		}, got)
+		assert.Equal(t, []string{"Hel", "lo", "!"}, deltas)
+	}
+
+	_, err = cf.Stream(context.Background(), ChatQuery{Messages: []Message{{Role: "user", Content: "rate limit"}}}, func(string) {})
+	var statusErr *StatusError
+	if assert.ErrorAs(t, err, &statusErr) {
+		assert.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+		assert.Equal(t, 3*time.Second, statusErr.RetryAfter)
+	}
+
+	_, err = cf.Stream(context.Background(), ChatQuery{Messages: []Message{{Role: "user", Content: "truncated"}}}, func(string) {})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestNewChatGPTRequest(t *testing.T) {
+	messages := []Message{{Role: "user", Content: "hi"}}
+
+	got := newChatGPTRequest(ChatQuery{Messages: messages})
+	assert.Equal(t, ChatGPTRequest{Model: DefaultChatModel, Messages: messages}, got)
+
+	got = newChatGPTRequest(ChatQuery{
+		Messages:    messages,
+		Model:       "gpt-4o",
+		System:      "answer in haiku",
+		Temperature: ptr(0.2),
+		MaxTokens:   100,
+	})
+	assert.Equal(t, ChatGPTRequest{
+		Model:       "gpt-4o",
+		Messages:    []Message{{Role: "system", Content: "answer in haiku"}, {Role: "user", Content: "hi"}},
+		Temperature: ptr(0.2),
+		MaxTokens:   100,
+	}, got)
+	assert.Len(t, messages, 1, "the query messages are not modified")
+}
@@ -0,0 +1,74 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StatusError is returned when an upstream API answers with a non-OK status
+type StatusError struct {
+	Upstream   string
+	StatusCode int
+	RetryAfter time.Duration
+	// Message is the upstream error description when the API provides one
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s request failed with status %d: %s", e.Upstream, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s request failed with status %d", e.Upstream, e.StatusCode)
+}
+
+func newStatusError(upstream string, resp *http.Response) *StatusError {
+	return &StatusError{
+		Upstream:   upstream,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter supports both delay-seconds and HTTP-date forms of the header
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func statusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// PlanLimitError is returned for a query longer than the plan of the API key allows, or longer
+// than the provider forecasts at all when Plan is empty
+type PlanLimitError struct {
+	Provider  string
+	Plan      string
+	Unit      string
+	Requested int
+	Max       int
+}
+
+func (e *PlanLimitError) Error() string {
+	if e.Plan == "" {
+		return fmt.Sprintf("%s covers at most %d %s, %d requested", e.Provider, e.Max, e.Unit, e.Requested)
+	}
+	return fmt.Sprintf("the %s %s plan covers at most %d %s, %d requested", e.Provider, e.Plan, e.Max, e.Unit, e.Requested)
+}
@@ -1,23 +1,36 @@
 package fetch
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
-type Fetchable interface {
+const defaultClientTimeout = 10 * time.Second
+
+// Query is a typed request to a fetcher, validated before any upstream call
+type Query interface {
+	Validate() error
+}
+
+type Fetchable[Q Query, R any] interface {
 	Set(APIKey string, logger *zerolog.Logger) error
-	Fetch(qParams map[string]interface{}) (string, error)
+	Fetch(ctx context.Context, q Q) (R, error)
 }
 
 type BaseFetcher struct {
-	APIKey string
-	logger *zerolog.Logger
+	APIKey  string
+	logger  *zerolog.Logger
+	baseURL string
+	client  *http.Client
 }
 
 func (bf *BaseFetcher) isSet() bool {
-	return bf.APIKey != "" && bf.logger != nil
+	return bf.APIKey != "" && bf.logger != nil && bf.client != nil
 }
 
 func (bf *BaseFetcher) Set(APIKey string, logger *zerolog.Logger) error {
@@ -29,5 +42,27 @@ func (bf *BaseFetcher) Set(APIKey string, logger *zerolog.Logger) error {
 	}
 	bf.APIKey = APIKey
 	bf.logger = logger
+	if bf.client == nil {
+		bf.client = &http.Client{
+			Timeout: defaultClientTimeout,
+		}
+	}
 	return nil
 }
+
+// SetBaseURL points the fetcher to another upstream, e.g. a proxy or a test server
+func (bf *BaseFetcher) SetBaseURL(baseURL string) {
+	bf.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// SetHTTPClient replaces the default http client, e.g. to plug in a custom RoundTripper
+func (bf *BaseFetcher) SetHTTPClient(client *http.Client) {
+	bf.client = client
+}
+
+func (bf *BaseFetcher) urlOrDefault(defaultBaseURL string) string {
+	if bf.baseURL == "" {
+		return defaultBaseURL
+	}
+	return bf.baseURL
+}
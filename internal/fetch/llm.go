@@ -0,0 +1,65 @@
+package fetch
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ChatBackend is an LLM API answering chat queries, every backend maps the query
+// to its own request shape, handles its own auth and maps its errors to StatusError
+type ChatBackend interface {
+	Fetchable[ChatQuery, *ChatCompletion]
+	ChatStreamer
+	Name() string
+}
+
+const maxStreamLineSize = 1024 * 1024
+
+// scanStream calls onLine for every non-empty stream line starting with the prefix, the prefix
+// is "data:" for server-sent events and empty for newline-delimited JSON. onLine reports the
+// end of the stream, a stream closed before that is io.ErrUnexpectedEOF
+func scanStream(r io.Reader, prefix string, onLine func(line string) (done bool, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLineSize)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(scanner.Text(), prefix)
+		if !ok {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		done, err := onLine(line)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// splitSystem moves system messages out of the conversation for the APIs
+// which take the system prompt as a separate field
+func splitSystem(q ChatQuery) (string, []Message) {
+	var system []string
+	if q.System != "" {
+		system = append(system, q.System)
+	}
+	messages := make([]Message, 0, len(q.Messages))
+	for _, m := range q.Messages {
+		if m.Role == "system" {
+			system = append(system, m.Content)
+			continue
+		}
+		messages = append(messages, m)
+	}
+	return strings.Join(system, "\n\n"), messages
+}
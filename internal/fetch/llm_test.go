@@ -0,0 +1,142 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatBackends_MockServer(t *testing.T) {
+	server := httptest.NewServer(newMockChatHandler())
+	defer server.Close()
+
+	logger := zerolog.Nop()
+	newBackend := func(b ChatBackend, baseURL, apiKey string) ChatBackend {
+		b.(interface{ SetBaseURL(string) }).SetBaseURL(baseURL)
+		b.(interface{ SetHTTPClient(*http.Client) }).SetHTTPClient(server.Client())
+		if err := b.Set(apiKey, &logger); err != nil {
+			t.Fatalf("error setting %s backend: %v", b.Name(), err)
+		}
+		return b
+	}
+
+	// the mock counts words as tokens, the system prompt is a message except for Anthropic
+	backends := []struct {
+		backend   ChatBackend
+		wantModel string
+		wantUsage ChatUsage
+	}{
+		{newBackend(&ChatFetcher{}, server.URL+"/v1", ""), DefaultChatModel, ChatUsage{PromptTokens: 4, CompletionTokens: 3}},
+		{newBackend(&AnthropicFetcher{}, server.URL+"/v1", "test-api-key"), DefaultAnthropicModel, ChatUsage{PromptTokens: 2, CompletionTokens: 3}},
+		{newBackend(&OllamaFetcher{}, server.URL, ""), DefaultOllamaModel, ChatUsage{PromptTokens: 4, CompletionTokens: 3}},
+		// the in-process mock answers like the server without one
+		{&MockChatBackend{}, MockChatModel, ChatUsage{PromptTokens: 4, CompletionTokens: 3}},
+	}
+	if err := backends[len(backends)-1].backend.Set("", &logger); err != nil {
+		t.Fatalf("error setting mock backend: %v", err)
+	}
+
+	query := ChatQuery{Messages: []Message{{Role: "user", Content: "hello there"}}, System: "be nice"}
+	want := "echo: hello there"
+
+	for _, tt := range backends {
+		t.Run(tt.backend.Name(), func(t *testing.T) {
+			got, err := tt.backend.Fetch(context.Background(), query)
+			if assert.NoError(t, err) {
+				assert.Equal(t, &ChatCompletion{Content: want, Model: tt.wantModel, Usage: tt.wantUsage}, got)
+			}
+
+			var deltas []string
+			got, err = tt.backend.Stream(context.Background(), query, func(delta string) {
+				deltas = append(deltas, delta)
+			})
+			if assert.NoError(t, err) {
+				assert.Equal(t, &ChatCompletion{Content: want, Model: tt.wantModel, Usage: tt.wantUsage}, got)
+				assert.Equal(t, []string{"echo:", " hello", " there"}, deltas)
+			}
+
+			for _, status := range []int{http.StatusUnauthorized, http.StatusTooManyRequests, 529} {
+				_, err = tt.backend.Fetch(context.Background(), ChatQuery{
+					Messages: []Message{{Role: "user", Content: fmt.Sprintf("%s%d", mockStatusPrompt, status)}},
+				})
+				var statusErr *StatusError
+				if assert.ErrorAs(t, err, &statusErr) {
+					assert.Equal(t, status, statusErr.StatusCode)
+					assert.Equal(t, "mock error", statusErr.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestChatFetcher_SetWithoutAPIKey(t *testing.T) {
+	logger := zerolog.Nop()
+
+	cf := &ChatFetcher{}
+	assert.Error(t, cf.Set("", &logger), "the OpenAI API requires a key")
+
+	cf.SetBaseURL("http://localhost:8080/v1")
+	assert.NoError(t, cf.Set("", &logger), "self-hosted servers do not")
+}
+
+func TestAnthropicFetcher_Request(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages", r.URL.Path)
+		assert.Equal(t, "test-api-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+
+		var req AnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, AnthropicRequest{
+			Model:       "claude-3-5-sonnet-latest",
+			System:      "be brief\n\nearlier summary",
+			Messages:    []Message{{Role: "user", Content: "hi"}},
+			MaxTokens:   defaultAnthropicMaxTokens,
+			Temperature: ptr(1.0),
+		}, req)
+
+		fmt.Fprint(w, `{"model":"claude-3-5-sonnet-20241022","content":[{"type":"text","text":"Hello"},{"type":"text","text":"!"}],"usage":{"input_tokens":12,"output_tokens":3}}`)
+	}))
+	defer server.Close()
+
+	logger := zerolog.Nop()
+	af := &AnthropicFetcher{}
+	af.SetBaseURL(server.URL)
+	if err := af.Set("test-api-key", &logger); err != nil {
+		t.Fatalf("error setting anthropic fetcher: %v", err)
+	}
+
+	got, err := af.Fetch(context.Background(), ChatQuery{
+		Messages:    []Message{{Role: "system", Content: "earlier summary"}, {Role: "user", Content: "hi"}},
+		Model:       "claude-3-5-sonnet-latest",
+		System:      "be brief",
+		Temperature: ptr(1.5),
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, &ChatCompletion{
+			Content: "Hello!",
+			Model:   "claude-3-5-sonnet-20241022",
+			Usage:   ChatUsage{PromptTokens: 12, CompletionTokens: 3},
+		}, got)
+	}
+}
+
+func TestNewOllamaRequest(t *testing.T) {
+	messages := []Message{{Role: "user", Content: "hi"}}
+
+	assert.Equal(t, OllamaRequest{Model: DefaultOllamaModel, Messages: messages}, newOllamaRequest(ChatQuery{Messages: messages}))
+	assert.Equal(t, OllamaRequest{
+		Model:    "qwen2.5",
+		Messages: []Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hi"}},
+		Options:  &OllamaOptions{Temperature: ptr(0.3), NumPredict: 64},
+	}, newOllamaRequest(ChatQuery{Messages: messages, Model: "qwen2.5", System: "be brief", Temperature: ptr(0.3), MaxTokens: 64}))
+}
@@ -0,0 +1,153 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultLocationCacheSize = 512
+
+	// MaxLocationCandidates caps the ambiguous matches offered to the user
+	MaxLocationCandidates = 5
+)
+
+// Location is a resolved city with the provider key used to query forecasts
+type Location struct {
+	Key       string
+	Name      string
+	Region    string
+	Country   string
+	TimeZone  string
+	Latitude  float64
+	Longitude float64
+}
+
+// Label tells apart the cities of the same name, e.g. "Paris, Texas, United States"
+func (l Location) Label() string {
+	parts := []string{l.Name}
+	for _, part := range []string{l.Region, l.Country} {
+		if part != "" && part != parts[len(parts)-1] {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (l Location) position() GeoPosition {
+	return GeoPosition{Latitude: l.Latitude, Longitude: l.Longitude}
+}
+
+// AmbiguousLocationError is returned when the search finds several cities named like the query
+type AmbiguousLocationError struct {
+	Query      string
+	Candidates []Location
+}
+
+func (e *AmbiguousLocationError) Error() string {
+	return fmt.Sprintf("%d locations match %q", len(e.Candidates), e.Query)
+}
+
+// ambiguousLocations returns the matches named exactly like the query when there are several
+// of them, a search for "paris" is ambiguous but a search for "berl" that finds Berlin is not.
+// Matches with the same label are indistinguishable to the user so the first one is kept
+func ambiguousLocations(query string, locations []Location) []Location {
+	query = NormalizeCity(query)
+	var candidates []Location
+	seen := make(map[string]bool)
+	for _, l := range locations {
+		label := l.Label()
+		if NormalizeCity(l.Name) != query || seen[label] {
+			continue
+		}
+		seen[label] = true
+		candidates = append(candidates, l)
+		if len(candidates) == MaxLocationCandidates {
+			break
+		}
+	}
+	if len(candidates) < 2 {
+		return nil
+	}
+	return candidates
+}
+
+// LocationStore persists resolved locations, Get returns nil without an error on a miss.
+// Delete of a query deletes its localized queries too
+type LocationStore interface {
+	Get(ctx context.Context, query string) (*Location, error)
+	Save(ctx context.Context, query string, l *Location) error
+	Delete(ctx context.Context, query string) (int64, error)
+}
+
+// NormalizeCity makes "  New   York" and "new york" share a cache entry
+func NormalizeCity(city string) string {
+	return strings.ToLower(strings.Join(strings.Fields(city), " "))
+}
+
+// localizedQuery is the query the location names in the language are cached under, e.g.
+// "munich|de" for "München", the English names are cached under the plain query
+func localizedQuery(query, language string) string {
+	if language == "" || language == "en" {
+		return query
+	}
+	return query + "|" + language
+}
+
+// LocationCache is an in-memory LRU in front of an optional persistent LocationStore
+type LocationCache struct {
+	store LocationStore
+	mem   *lru[string, Location]
+}
+
+func NewLocationCache(store LocationStore, size int) *LocationCache {
+	return &LocationCache{
+		store: store,
+		mem:   newLRU[string, Location](size),
+	}
+}
+
+func (lc *LocationCache) Get(ctx context.Context, query string) (*Location, error) {
+	query = NormalizeCity(query)
+	if l, ok := lc.mem.get(query); ok {
+		return &l, nil
+	}
+	if lc.store == nil {
+		return nil, nil
+	}
+
+	l, err := lc.store.Get(ctx, query)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	lc.mem.add(query, *l)
+	return l, nil
+}
+
+func (lc *LocationCache) Save(ctx context.Context, query string, l *Location) error {
+	query = NormalizeCity(query)
+	lc.mem.add(query, *l)
+	if lc.store == nil {
+		return nil
+	}
+	return lc.store.Save(ctx, query, l)
+}
+
+// Delete purges the query in every language or the whole cache if the query is empty
+func (lc *LocationCache) Delete(ctx context.Context, query string) (int64, error) {
+	query = NormalizeCity(query)
+	var n int64
+	if query == "" {
+		n = int64(lc.mem.len())
+		lc.mem.purge()
+	} else {
+		n = int64(lc.mem.removeFunc(func(key string) bool {
+			return key == query || strings.HasPrefix(key, query+"|")
+		}))
+	}
+	if lc.store == nil {
+		return n, nil
+	}
+	return lc.store.Delete(ctx, query)
+}
@@ -0,0 +1,119 @@
+package fetch
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mapLocationStore struct {
+	locations map[string]Location
+	gets      int
+}
+
+func (s *mapLocationStore) Get(_ context.Context, query string) (*Location, error) {
+	s.gets++
+	if l, ok := s.locations[query]; ok {
+		return &l, nil
+	}
+	return nil, nil
+}
+
+func (s *mapLocationStore) Save(_ context.Context, query string, l *Location) error {
+	s.locations[query] = *l
+	return nil
+}
+
+func (s *mapLocationStore) Delete(_ context.Context, query string) (int64, error) {
+	if query == "" {
+		n := len(s.locations)
+		s.locations = make(map[string]Location)
+		return int64(n), nil
+	}
+	var n int64
+	for q := range s.locations {
+		if q == query || strings.HasPrefix(q, query+"|") {
+			delete(s.locations, q)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestNormalizeCity(t *testing.T) {
+	assert.Equal(t, "new york", NormalizeCity("  New   York "))
+	assert.Equal(t, "london", NormalizeCity("LONDON"))
+	assert.Equal(t, "", NormalizeCity("   "))
+}
+
+func TestLocationCache(t *testing.T) {
+	ctx := context.Background()
+	store := &mapLocationStore{locations: map[string]Location{
+		"berlin": {Key: "178087", Name: "Berlin", Country: "Germany", TimeZone: "Europe/Berlin"},
+	}}
+	lc := NewLocationCache(store, 2)
+
+	// read through from the store once, then served from memory
+	for _, q := range []string{"Berlin", "berlin", " BERLIN "} {
+		l, err := lc.Get(ctx, q)
+		assert.NoError(t, err)
+		if assert.NotNil(t, l) {
+			assert.Equal(t, "178087", l.Key)
+		}
+	}
+	assert.Equal(t, 1, store.gets)
+
+	l, err := lc.Get(ctx, "Paris")
+	assert.NoError(t, err)
+	assert.Nil(t, l)
+
+	assert.NoError(t, lc.Save(ctx, "Paris", &Location{Key: "623", Name: "Paris"}))
+	assert.Equal(t, "623", store.locations["paris"].Key)
+
+	assert.NoError(t, lc.Save(ctx, localizedQuery("paris", "de"), &Location{Key: "623", Name: "Paris"}))
+	n, err := lc.Delete(ctx, "PARIS")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	l, err = lc.Get(ctx, "paris")
+	assert.NoError(t, err)
+	assert.Nil(t, l)
+
+	n, err = lc.Delete(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Empty(t, store.locations)
+}
+
+func TestLocation_Label(t *testing.T) {
+	assert.Equal(t, "Paris, Texas, United States", Location{Name: "Paris", Region: "Texas", Country: "United States"}.Label())
+	assert.Equal(t, "Berlin, Germany", Location{Name: "Berlin", Region: "Berlin", Country: "Germany"}.Label())
+	assert.Equal(t, "52.52, 13.40", Location{Name: "52.52, 13.40"}.Label())
+}
+
+func TestAmbiguousLocations(t *testing.T) {
+	parisFR := Location{Key: "623", Name: "Paris", Region: "Ile-de-France", Country: "France"}
+	parisTX := Location{Key: "351", Name: "Paris", Region: "Texas", Country: "United States"}
+	parisDistrict := Location{Key: "1", Name: "Paris", Region: "Ile-de-France", Country: "France"}
+	berlin := Location{Key: "178087", Name: "Berlin", Region: "Berlin", Country: "Germany"}
+
+	tests := []struct {
+		name      string
+		query     string
+		locations []Location
+		want      []Location
+	}{
+		{"Several cities of the same name", " PARIS ", []Location{parisFR, parisTX}, []Location{parisFR, parisTX}},
+		{"Same label is kept once", "paris", []Location{parisFR, parisDistrict, parisTX}, []Location{parisFR, parisTX}},
+		{"Single city", "paris", []Location{parisFR, parisDistrict}, nil},
+		{"Prefix match", "berl", []Location{berlin}, nil},
+		{"Other names are ignored", "berlin", []Location{berlin, parisFR}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ambiguousLocations(tt.query, tt.locations))
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	MockChatModel = "mock"
+
+	// a prompt "mock status 429" makes the mock answer with that status
+	mockStatusPrompt = "mock status "
+)
+
+// mockAnswer echoes the last message split into stream pieces, or returns the error status
+// requested by the prompt
+func mockAnswer(messages []Message) ([]string, int) {
+	prompt := messages[len(messages)-1].Content
+	if code, ok := strings.CutPrefix(prompt, mockStatusPrompt); ok {
+		if status, err := strconv.Atoi(code); err == nil {
+			return nil, status
+		}
+	}
+
+	var pieces []string
+	for i, word := range strings.Fields("echo: " + prompt) {
+		if i > 0 {
+			word = " " + word
+		}
+		pieces = append(pieces, word)
+	}
+	return pieces, 0
+}
+
+// mockUsage counts words as tokens
+func mockUsage(messages []Message, pieces []string) (int, int) {
+	prompt := 0
+	for _, m := range messages {
+		prompt += len(strings.Fields(m.Content))
+	}
+	return prompt, len(pieces)
+}
+
+// MockChatBackend echoes the last message back in process, it runs the chat without any
+// upstream and without a listening server
+type MockChatBackend struct {
+	logger *zerolog.Logger
+}
+
+func (mb *MockChatBackend) Name() string {
+	return "Mock"
+}
+
+func (mb *MockChatBackend) Set(_ string, logger *zerolog.Logger) error {
+	if logger == nil {
+		return errors.New("logger is required")
+	}
+	mb.logger = logger
+	return nil
+}
+
+func (mb *MockChatBackend) Fetch(ctx context.Context, q ChatQuery) (*ChatCompletion, error) {
+	return mb.Stream(ctx, q, func(string) {})
+}
+
+func (mb *MockChatBackend) Stream(ctx context.Context, q ChatQuery, onDelta func(delta string)) (*ChatCompletion, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	// the system prompt counts as a message like for the OpenAI API
+	messages := q.Messages
+	if q.System != "" {
+		messages = append([]Message{{Role: "system", Content: q.System}}, messages...)
+	}
+	pieces, status := mockAnswer(messages)
+	if status != 0 {
+		return nil, &StatusError{Upstream: mb.Name(), StatusCode: status, Message: "mock error"}
+	}
+
+	completion := &ChatCompletion{Model: q.Model}
+	if completion.Model == "" {
+		completion.Model = MockChatModel
+	}
+	for _, piece := range pieces {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		onDelta(piece)
+	}
+	completion.Content = strings.Join(pieces, "")
+	completion.Usage.PromptTokens, completion.Usage.CompletionTokens = mockUsage(messages, pieces)
+	return completion, nil
+}
@@ -0,0 +1,158 @@
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// mockChatHandler is a local LLM server speaking the OpenAI, Anthropic and Ollama chat APIs,
+// it answers like MockChatBackend so the backends can be tested without any upstream
+type mockChatHandler struct{}
+
+func newMockChatHandler() http.Handler {
+	mux := http.NewServeMux()
+	h := &mockChatHandler{}
+	mux.HandleFunc("POST /v1/chat/completions", h.openAI)
+	mux.HandleFunc("POST /v1/messages", h.anthropic)
+	mux.HandleFunc("POST /api/chat", h.ollama)
+	return mux
+}
+
+type mockChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+}
+
+// decode returns the request, the echoed answer split into stream pieces and the error
+// status requested by the prompt, 0 if none
+func (h *mockChatHandler) decode(r *http.Request) (*mockChatRequest, []string, int) {
+	var req mockChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) == 0 {
+		return nil, nil, http.StatusBadRequest
+	}
+	if req.Model == "" {
+		req.Model = MockChatModel
+	}
+
+	pieces, status := mockAnswer(req.Messages)
+	return &req, pieces, status
+}
+
+// usage counts words as tokens
+func (req *mockChatRequest) usage(pieces []string) (int, int) {
+	return mockUsage(req.Messages, pieces)
+}
+
+func writeMockJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeMockEvent(w http.ResponseWriter, event string, v any) {
+	data, _ := json.Marshal(v)
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (h *mockChatHandler) openAI(w http.ResponseWriter, r *http.Request) {
+	req, pieces, status := h.decode(r)
+	if status != 0 {
+		writeMockJSON(w, status, map[string]any{"error": map[string]string{"message": "mock error", "type": "mock"}})
+		return
+	}
+
+	promptTokens, completionTokens := req.usage(pieces)
+	usage := ChatGPTUsage{PromptTokens: promptTokens, CompletionTokens: completionTokens}
+
+	if !req.Stream {
+		writeMockJSON(w, http.StatusOK, map[string]any{
+			"model":   req.Model,
+			"choices": []any{map[string]any{"message": Message{Role: "assistant", Content: strings.Join(pieces, "")}}},
+			"usage":   usage,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, piece := range pieces {
+		writeMockEvent(w, "", map[string]any{
+			"model":   req.Model,
+			"choices": []any{map[string]any{"delta": map[string]string{"content": piece}}},
+		})
+	}
+	writeMockEvent(w, "", map[string]any{"model": req.Model, "choices": []any{}, "usage": usage})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func (h *mockChatHandler) anthropic(w http.ResponseWriter, r *http.Request) {
+	req, pieces, status := h.decode(r)
+	if status != 0 {
+		writeMockJSON(w, status, map[string]any{"type": "error", "error": map[string]string{"type": "mock_error", "message": "mock error"}})
+		return
+	}
+
+	promptTokens, completionTokens := req.usage(pieces)
+
+	if !req.Stream {
+		writeMockJSON(w, http.StatusOK, map[string]any{
+			"model":   req.Model,
+			"content": []any{map[string]string{"type": "text", "text": strings.Join(pieces, "")}},
+			"usage":   AnthropicUsage{InputTokens: promptTokens, OutputTokens: completionTokens},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	writeMockEvent(w, "message_start", map[string]any{
+		"type":    "message_start",
+		"message": map[string]any{"model": req.Model, "usage": AnthropicUsage{InputTokens: promptTokens, OutputTokens: 1}},
+	})
+	for _, piece := range pieces {
+		writeMockEvent(w, "content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"delta": map[string]string{"type": "text_delta", "text": piece},
+		})
+	}
+	writeMockEvent(w, "message_delta", map[string]any{"type": "message_delta", "usage": AnthropicUsage{OutputTokens: completionTokens}})
+	writeMockEvent(w, "message_stop", map[string]string{"type": "message_stop"})
+}
+
+func (h *mockChatHandler) ollama(w http.ResponseWriter, r *http.Request) {
+	req, pieces, status := h.decode(r)
+	if status != 0 {
+		writeMockJSON(w, status, map[string]string{"error": "mock error"})
+		return
+	}
+
+	promptTokens, completionTokens := req.usage(pieces)
+
+	if !req.Stream {
+		writeMockJSON(w, http.StatusOK, OllamaResponse{
+			Model:           req.Model,
+			Message:         Message{Role: "assistant", Content: strings.Join(pieces, "")},
+			Done:            true,
+			PromptEvalCount: promptTokens,
+			EvalCount:       completionTokens,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, piece := range pieces {
+		_ = enc.Encode(OllamaResponse{Model: req.Model, Message: Message{Role: "assistant", Content: piece}})
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	_ = enc.Encode(OllamaResponse{Model: req.Model, Done: true, PromptEvalCount: promptTokens, EvalCount: completionTokens})
+}
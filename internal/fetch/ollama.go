@@ -0,0 +1,216 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultOllamaModel   = "llama3.2"
+	DefaultOllamaBaseURL = "http://localhost:11434"
+)
+
+// OllamaFetcher talks to the native Ollama chat API, it needs no API key
+type OllamaFetcher struct {
+	BaseFetcher
+}
+
+type OllamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+type OllamaRequest struct {
+	Model    string         `json:"model"`
+	Messages []Message      `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Options  *OllamaOptions `json:"options,omitempty"`
+}
+
+// OllamaResponse is both the complete answer and a line of the stream
+type OllamaResponse struct {
+	Model   string  `json:"model"`
+	Message Message `json:"message"`
+	Done    bool    `json:"done"`
+	Error   string  `json:"error,omitempty"`
+	// token counts are reported with the final answer
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"`
+	EvalCount       int `json:"eval_count,omitempty"`
+}
+
+func newOllamaRequest(q ChatQuery) OllamaRequest {
+	model := q.Model
+	if model == "" {
+		model = DefaultOllamaModel
+	}
+
+	messages := q.Messages
+	if q.System != "" {
+		messages = append([]Message{{Role: "system", Content: q.System}}, messages...)
+	}
+
+	req := OllamaRequest{
+		Model:    model,
+		Messages: messages,
+	}
+	if q.Temperature != nil || q.MaxTokens > 0 {
+		req.Options = &OllamaOptions{Temperature: q.Temperature, NumPredict: q.MaxTokens}
+	}
+	return req
+}
+
+func (of *OllamaFetcher) Name() string {
+	return "Ollama"
+}
+
+// Set ignores the API key, Ollama does not need one
+func (of *OllamaFetcher) Set(_ string, logger *zerolog.Logger) error {
+	if logger == nil {
+		return errors.New("logger is required")
+	}
+	of.logger = logger
+	if of.client == nil {
+		of.client = &http.Client{
+			Timeout: defaultClientTimeout,
+		}
+	}
+	return nil
+}
+
+func (of *OllamaFetcher) statusError(resp *http.Response, body []byte) error {
+	var errResp OllamaResponse
+	_ = json.Unmarshal(body, &errResp)
+	of.logger.Error().
+		Int("status_code", resp.StatusCode).
+		Msgf("ollama API request failed: %s", string(body))
+	statusErr := newStatusError("ollama API", resp)
+	statusErr.Message = errResp.Error
+	return statusErr
+}
+
+// do posts the request, the stream is not bounded by the client timeout
+func (of *OllamaFetcher) do(ctx context.Context, reqBody OllamaRequest) (*http.Response, error) {
+	if of.logger == nil || of.client == nil {
+		return nil, errors.New("ollama fetcher is not set")
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		of.logger.Error().Err(err).Msg("error marshalling request body")
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, of.urlOrDefault(DefaultOllamaBaseURL)+"/api/chat", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		of.logger.Error().Err(err).Msg("error creating request")
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := *of.client
+	if reqBody.Stream {
+		client.Timeout = 0
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		of.logger.Error().Err(err).Msg("error sending request")
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, of.statusError(resp, body)
+	}
+	return resp, nil
+}
+
+func (of *OllamaFetcher) Fetch(ctx context.Context, q ChatQuery) (*ChatCompletion, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	resp, err := of.do(ctx, newOllamaRequest(q))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ollamaResp OllamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		of.logger.Error().Err(err).Msg("error unmarshalling response body")
+		return nil, err
+	}
+
+	if ollamaResp.Message.Content == "" {
+		of.logger.Error().Msg("no valid response from Ollama")
+		return nil, errors.New("no valid response from Ollama")
+	}
+
+	completion := &ChatCompletion{
+		Content: ollamaResp.Message.Content,
+		Model:   ollamaResp.Model,
+		Usage:   ChatUsage{PromptTokens: ollamaResp.PromptEvalCount, CompletionTokens: ollamaResp.EvalCount},
+	}
+	completion.estimateUsage(q)
+	return completion, nil
+}
+
+// Stream reads the newline-delimited JSON stream of the chat API
+func (of *OllamaFetcher) Stream(ctx context.Context, q ChatQuery, onDelta func(delta string)) (*ChatCompletion, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	reqBody := newOllamaRequest(q)
+	reqBody.Stream = true
+
+	resp, err := of.do(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	completion := &ChatCompletion{Model: reqBody.Model}
+
+	err = scanStream(resp.Body, "", func(line string) (bool, error) {
+		var chunk OllamaResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			of.logger.Error().Err(err).Msg("error unmarshalling stream chunk")
+			return false, err
+		}
+		if chunk.Error != "" {
+			return false, errors.New("ollama API stream failed: " + chunk.Error)
+		}
+		if chunk.Model != "" {
+			completion.Model = chunk.Model
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		if chunk.Done {
+			completion.Usage = ChatUsage{PromptTokens: chunk.PromptEvalCount, CompletionTokens: chunk.EvalCount}
+		}
+		return chunk.Done, nil
+	})
+	if err != nil {
+		of.logger.Error().Err(err).Msg("error reading stream")
+		return nil, err
+	}
+
+	completion.Content = content.String()
+	if completion.Content == "" {
+		return nil, errors.New("no valid response from Ollama")
+	}
+	completion.estimateUsage(q)
+	return completion, nil
+}
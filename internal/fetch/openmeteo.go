@@ -0,0 +1,342 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	OpenMeteoMaxDaysForecast  = 16
+	OpenMeteoMaxHoursForecast = OpenMeteoMaxDaysForecast * 24
+
+	DefaultOpenMeteoBaseURL          = "https://api.open-meteo.com/v1"
+	DefaultOpenMeteoGeocodingBaseURL = "https://geocoding-api.open-meteo.com/v1"
+)
+
+// OpenMeteoFetcher needs no API key, its location lookups are cached in memory only
+// since the geocoding API is free and unmetered
+type OpenMeteoFetcher struct {
+	BaseFetcher
+	geocodingBaseURL string
+	shared           *LocationCache
+	locations        *lru[string, Location]
+}
+
+type openMeteoGeocodingResponse struct {
+	Results []struct {
+		Name      string  `json:"name"`
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		Country   string  `json:"country"`
+		Timezone  string  `json:"timezone"`
+	} `json:"results"`
+}
+
+type openMeteoForecastResponse struct {
+	UTCOffsetSeconds int `json:"utc_offset_seconds"`
+	Daily            struct {
+		Time                        []string  `json:"time"`
+		WeatherCode                 []int     `json:"weather_code"`
+		Temperature2mMax            []float64 `json:"temperature_2m_max"`
+		Temperature2mMin            []float64 `json:"temperature_2m_min"`
+		PrecipitationProbabilityMax []float64 `json:"precipitation_probability_max"`
+	} `json:"daily"`
+	Hourly struct {
+		Time                     []string  `json:"time"`
+		WeatherCode              []int     `json:"weather_code"`
+		Temperature2m            []float64 `json:"temperature_2m"`
+		PrecipitationProbability []float64 `json:"precipitation_probability"`
+		IsDay                    []int     `json:"is_day"`
+	} `json:"hourly"`
+	Current *struct {
+		Time                string  `json:"time"`
+		Temperature2m       float64 `json:"temperature_2m"`
+		ApparentTemperature float64 `json:"apparent_temperature"`
+		RelativeHumidity2m  float64 `json:"relative_humidity_2m"`
+		WeatherCode         int     `json:"weather_code"`
+		IsDay               int     `json:"is_day"`
+		WindSpeed10m        float64 `json:"wind_speed_10m"`
+		WindDirection10m    float64 `json:"wind_direction_10m"`
+		UVIndex             float64 `json:"uv_index"`
+		PressureMSL         float64 `json:"pressure_msl"`
+	} `json:"current"`
+}
+
+type openMeteoErrorResponse struct {
+	Reason string `json:"reason"`
+}
+
+// wmoCondition maps WMO weather interpretation codes used by Open-Meteo
+func wmoCondition(code int) Condition {
+	switch {
+	case code == 0:
+		return ConditionClear
+	case code == 1 || code == 2:
+		return ConditionPartlyCloudy
+	case code == 3:
+		return ConditionCloudy
+	case code == 45 || code == 48:
+		return ConditionFog
+	case code >= 51 && code <= 55:
+		return ConditionDrizzle
+	case code == 56 || code == 57 || code == 66 || code == 67:
+		return ConditionSleet
+	case (code >= 61 && code <= 65) || (code >= 80 && code <= 82):
+		return ConditionRain
+	case (code >= 71 && code <= 77) || code == 85 || code == 86:
+		return ConditionSnow
+	case code >= 95 && code <= 99:
+		return ConditionThunderstorm
+	default:
+		return ConditionUnknown
+	}
+}
+
+func (c Condition) isPrecipitation() bool {
+	switch c {
+	case ConditionDrizzle, ConditionRain, ConditionSleet, ConditionSnow, ConditionThunderstorm:
+		return true
+	default:
+		return false
+	}
+}
+
+func (of *OpenMeteoFetcher) Name() string {
+	return "Open-Meteo"
+}
+
+// Set ignores the API key, Open-Meteo does not need one
+func (of *OpenMeteoFetcher) Set(_ string, logger *zerolog.Logger) error {
+	if logger == nil {
+		return errors.New("logger is required")
+	}
+	of.logger = logger
+	if of.client == nil {
+		of.client = &http.Client{
+			Timeout: defaultClientTimeout,
+		}
+	}
+	of.locations = newLRU[string, Location](defaultLocationCacheSize)
+	return nil
+}
+
+func (of *OpenMeteoFetcher) SetGeocodingBaseURL(baseURL string) {
+	of.geocodingBaseURL = strings.TrimRight(baseURL, "/")
+}
+
+// SetLocationCache lets the fetcher reuse coordinates resolved by other providers
+func (of *OpenMeteoFetcher) SetLocationCache(locations *LocationCache) {
+	of.shared = locations
+}
+
+func (of *OpenMeteoFetcher) get(ctx context.Context, upstream, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		of.logger.Error().Err(err).Msgf("error creating open-meteo %s request", upstream)
+		return err
+	}
+
+	resp, err := of.client.Do(req)
+	if err != nil {
+		of.logger.Error().Err(err).Msgf("error getting open-meteo %s", upstream)
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		of.logger.Error().Err(err).Msgf("error reading open-meteo %s response", upstream)
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp openMeteoErrorResponse
+		_ = json.Unmarshal(body, &errResp)
+		of.logger.Error().
+			Int("status_code", resp.StatusCode).
+			Msgf("open-meteo %s request failed: %s", upstream, errResp.Reason)
+		return newStatusError("open-meteo "+upstream, resp)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		of.logger.Error().Err(err).Msgf("error unmarshalling open-meteo %s response", upstream)
+		return err
+	}
+	return nil
+}
+
+func (of *OpenMeteoFetcher) getLocation(ctx context.Context, q WeatherQuery) (*Location, error) {
+	if q.Location != nil {
+		if q.Location.Latitude != 0 || q.Location.Longitude != 0 {
+			return q.Location, nil
+		}
+		q = WeatherQuery{City: q.Location.Name}
+	}
+
+	key := q.locationQuery()
+	if l, ok := of.locations.get(key); ok {
+		return &l, nil
+	}
+	if of.shared != nil {
+		if l, err := of.shared.Get(ctx, localizedQuery(key, q.Language)); err == nil && l != nil && (l.Latitude != 0 || l.Longitude != 0) {
+			return l, nil
+		}
+	}
+
+	// positions need no geocoding, there is no reverse geocoding so the name is the position
+	if q.Position != nil {
+		r := q.Position.Rounded()
+		return &Location{Name: r.String(), Latitude: r.Latitude, Longitude: r.Longitude}, nil
+	}
+
+	geocodingURL := of.geocodingBaseURL
+	if geocodingURL == "" {
+		geocodingURL = DefaultOpenMeteoGeocodingBaseURL
+	}
+
+	var geo openMeteoGeocodingResponse
+	if err := of.get(ctx, "geocoding", fmt.Sprintf("%s/search?name=%s&count=1&format=json", geocodingURL, url.QueryEscape(key)), &geo); err != nil {
+		return nil, err
+	}
+	if len(geo.Results) == 0 {
+		return nil, ErrLocationNotFound
+	}
+
+	r := geo.Results[0]
+	l := Location{
+		Name:      r.Name,
+		Country:   r.Country,
+		TimeZone:  r.Timezone,
+		Latitude:  r.Latitude,
+		Longitude: r.Longitude,
+	}
+	of.locations.add(key, l)
+	return &l, nil
+}
+
+// openMeteoRange rejects the queries longer than the forecasts, they are not clipped silently
+func openMeteoRange(q WeatherQuery) error {
+	switch {
+	case q.Days > OpenMeteoMaxDaysForecast:
+		return &PlanLimitError{Provider: "Open-Meteo", Unit: "days", Requested: q.Days, Max: OpenMeteoMaxDaysForecast}
+	case q.Hours > OpenMeteoMaxHoursForecast:
+		return &PlanLimitError{Provider: "Open-Meteo", Unit: "hours", Requested: q.Hours, Max: OpenMeteoMaxHoursForecast}
+	}
+	return nil
+}
+
+func (of *OpenMeteoFetcher) buildURL(l *Location, q WeatherQuery) string {
+	params := url.Values{}
+	params.Set("latitude", fmt.Sprintf("%.4f", l.Latitude))
+	params.Set("longitude", fmt.Sprintf("%.4f", l.Longitude))
+	params.Set("timezone", "auto")
+	switch {
+	case q.Current:
+		params.Set("current", "temperature_2m,apparent_temperature,relative_humidity_2m,weather_code,is_day,"+
+			"wind_speed_10m,wind_direction_10m,uv_index,pressure_msl")
+	case q.Hours > 0:
+		params.Set("hourly", "temperature_2m,weather_code,precipitation_probability,is_day")
+		params.Set("forecast_hours", fmt.Sprint(q.Hours))
+	default:
+		params.Set("daily", "weather_code,temperature_2m_max,temperature_2m_min,precipitation_probability_max")
+		params.Set("forecast_days", fmt.Sprint(q.Days))
+	}
+	return of.urlOrDefault(DefaultOpenMeteoBaseURL) + "/forecast?" + params.Encode()
+}
+
+func valueAt[T any](values []T, i int) T {
+	var zero T
+	if i < len(values) {
+		return values[i]
+	}
+	return zero
+}
+
+func (of *OpenMeteoFetcher) Fetch(ctx context.Context, q WeatherQuery) (*Forecast, error) {
+	if of.logger == nil || of.client == nil {
+		return nil, errors.New("open-meteo fetcher is not set")
+	}
+
+	if err := q.Validate(); err != nil {
+		of.logger.Error().Err(err).Msg("invalid weather query")
+		return nil, err
+	}
+	if err := openMeteoRange(q); err != nil {
+		return nil, err
+	}
+
+	location, err := of.getLocation(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp openMeteoForecastResponse
+	if err := of.get(ctx, "forecast", of.buildURL(location, q), &resp); err != nil {
+		return nil, err
+	}
+
+	zone := time.FixedZone("", resp.UTCOffsetSeconds)
+	forecast := Forecast{
+		Location:  locationName(location),
+		FetchedAt: time.Now(),
+	}
+
+	if c := resp.Current; c != nil {
+		t, _ := time.ParseInLocation("2006-01-02T15:04", c.Time, zone)
+		condition := wmoCondition(c.WeatherCode)
+		forecast.Current = &CurrentConditions{
+			Time:          t,
+			Temp:          c.Temperature2m,
+			FeelsLike:     c.ApparentTemperature,
+			Phrase:        condition.String(),
+			Condition:     condition,
+			IsDaylight:    c.IsDay == 1,
+			Humidity:      c.RelativeHumidity2m,
+			WindSpeed:     c.WindSpeed10m,
+			WindDirection: c.WindDirection10m,
+			UVIndex:       c.UVIndex,
+			Pressure:      c.PressureMSL,
+		}
+	}
+
+	for i, day := range resp.Daily.Time {
+		date, _ := time.ParseInLocation("2006-01-02", day, zone)
+		condition := wmoCondition(valueAt(resp.Daily.WeatherCode, i))
+		forecast.Daily = append(forecast.Daily, DailyForecast{
+			Date:    date,
+			MinTemp: valueAt(resp.Daily.Temperature2mMin, i),
+			MaxTemp: valueAt(resp.Daily.Temperature2mMax, i),
+			Day: PeriodForecast{
+				Phrase:           condition.String(),
+				Condition:        condition,
+				HasPrecipitation: condition.isPrecipitation(),
+			},
+			PrecipitationProbability: valueAt(resp.Daily.PrecipitationProbabilityMax, i),
+		})
+	}
+
+	for i, hour := range resp.Hourly.Time {
+		t, _ := time.ParseInLocation("2006-01-02T15:04", hour, zone)
+		condition := wmoCondition(valueAt(resp.Hourly.WeatherCode, i))
+		forecast.Hourly = append(forecast.Hourly, HourlyForecast{
+			Time:                     t,
+			Temp:                     valueAt(resp.Hourly.Temperature2m, i),
+			Phrase:                   condition.String(),
+			Condition:                condition,
+			IsDaylight:               valueAt(resp.Hourly.IsDay, i) == 1,
+			HasPrecipitation:         condition.isPrecipitation(),
+			PrecipitationProbability: valueAt(resp.Hourly.PrecipitationProbability, i),
+		})
+	}
+
+	return &forecast, nil
+}
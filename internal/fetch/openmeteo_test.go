@@ -0,0 +1,114 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMeteoFetcher_FetchOffline(t *testing.T) {
+	var geocodingCalls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/geocoding/search", func(w http.ResponseWriter, r *http.Request) {
+		geocodingCalls++
+		if r.URL.Query().Get("name") != "berlin" {
+			fmt.Fprint(w, `{"generationtime_ms":0.5}`)
+			return
+		}
+		fmt.Fprint(w, `{"results":[{"id":2950159,"name":"Berlin","latitude":52.52437,"longitude":13.41053,
+			"country_code":"DE","timezone":"Europe/Berlin","country":"Germany"}]}`)
+	})
+	mux.HandleFunc("/forecast", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "52.5244", q.Get("latitude"))
+		assert.Equal(t, "auto", q.Get("timezone"))
+		if q.Get("current") != "" {
+			fmt.Fprint(w, `{"utc_offset_seconds":3600,"current":{"time":"2024-11-02T14:15","interval":900,
+				"temperature_2m":11.4,"apparent_temperature":8.9,"relative_humidity_2m":74,"weather_code":2,"is_day":1,
+				"wind_speed_10m":16.2,"wind_direction_10m":250,"uv_index":1.35,"pressure_msl":1013.6}}`)
+			return
+		}
+		if q.Get("hourly") != "" {
+			fmt.Fprint(w, `{"utc_offset_seconds":3600,"hourly":{
+				"time":["2024-11-02T14:00","2024-11-02T15:00"],
+				"temperature_2m":[11.2,10.8],
+				"weather_code":[61,3],
+				"precipitation_probability":[80,20],
+				"is_day":[1,1]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"utc_offset_seconds":3600,"daily":{
+			"time":["2024-11-02","2024-11-03","2024-11-04"],
+			"weather_code":[0,3,95],
+			"temperature_2m_max":[12.1,10.4,9.8],
+			"temperature_2m_min":[4.2,5.0,3.3],
+			"precipitation_probability_max":[0,10,90]}}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	logger := zerolog.Nop()
+	of := &OpenMeteoFetcher{}
+	of.SetHTTPClient(server.Client())
+	of.SetBaseURL(server.URL)
+	of.SetGeocodingBaseURL(server.URL + "/geocoding")
+	assert.NoError(t, of.Set("", &logger))
+
+	daily, err := of.Fetch(context.Background(), WeatherQuery{City: "Berlin", Days: 3})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Berlin, Germany", daily.Location)
+		assert.Len(t, daily.Daily, 3)
+		assert.Equal(t, ConditionClear, daily.Daily[0].Day.Condition)
+		assert.Equal(t, ConditionThunderstorm, daily.Daily[2].Day.Condition)
+		assert.True(t, daily.Daily[2].Day.HasPrecipitation)
+		assert.Equal(t, 12.1, daily.Daily[0].MaxTemp)
+		assert.Equal(t, 90.0, daily.Daily[2].PrecipitationProbability)
+	}
+
+	hourly, err := of.Fetch(context.Background(), WeatherQuery{City: "berlin", Hours: 2})
+	if assert.NoError(t, err) {
+		assert.Len(t, hourly.Hourly, 2)
+		assert.Equal(t, ConditionRain, hourly.Hourly[0].Condition)
+		assert.True(t, hourly.Hourly[0].IsDaylight)
+		assert.Equal(t, time.Date(2024, 11, 2, 13, 0, 0, 0, time.UTC), hourly.Hourly[0].Time.UTC())
+	}
+
+	current, err := of.Fetch(context.Background(), WeatherQuery{City: "Berlin", Current: true})
+	if assert.NoError(t, err) && assert.NotNil(t, current.Current) {
+		assert.Empty(t, current.Daily)
+		assert.Equal(t, ConditionPartlyCloudy, current.Current.Condition)
+		assert.Equal(t, 8.9, current.Current.FeelsLike)
+		assert.Equal(t, 1013.6, current.Current.Pressure)
+		assert.Equal(t, time.Date(2024, 11, 2, 13, 15, 0, 0, time.UTC), current.Current.Time.UTC())
+	}
+	assert.Equal(t, 1, geocodingCalls)
+
+	_, err = of.Fetch(context.Background(), WeatherQuery{City: "Atlantis", Days: 1})
+	assert.ErrorIs(t, err, ErrLocationNotFound)
+
+	_, err = of.Fetch(context.Background(), WeatherQuery{City: "Berlin", Days: 99})
+	var limitErr *PlanLimitError
+	if assert.ErrorAs(t, err, &limitErr, "days beyond the Open-Meteo maximum are not clipped") {
+		assert.Equal(t, &PlanLimitError{Provider: "Open-Meteo", Unit: "days", Requested: 99, Max: OpenMeteoMaxDaysForecast}, limitErr)
+		assert.Equal(t, "Open-Meteo covers at most 16 days, 99 requested", limitErr.Error())
+	}
+}
+
+func TestWMOCondition(t *testing.T) {
+	assert.Equal(t, ConditionClear, wmoCondition(0))
+	assert.Equal(t, ConditionPartlyCloudy, wmoCondition(2))
+	assert.Equal(t, ConditionFog, wmoCondition(48))
+	assert.Equal(t, ConditionDrizzle, wmoCondition(53))
+	assert.Equal(t, ConditionSleet, wmoCondition(66))
+	assert.Equal(t, ConditionRain, wmoCondition(81))
+	assert.Equal(t, ConditionSnow, wmoCondition(86))
+	assert.Equal(t, ConditionThunderstorm, wmoCondition(99))
+	assert.Equal(t, ConditionUnknown, wmoCondition(42))
+}
@@ -0,0 +1,47 @@
+package fetch
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Quota tracks the requests left for the day as the upstream reports them in the
+// RateLimit-Remaining header, AccuWeather sends it with every response. Fetchers sharing an
+// API key share the quota
+type Quota struct {
+	mu        sync.Mutex
+	remaining int
+	updated   time.Time
+	now       func() time.Time
+}
+
+func NewQuota() *Quota {
+	return &Quota{now: time.Now}
+}
+
+func (q *Quota) observe(resp *http.Response) {
+	if q == nil {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remaining = remaining
+	q.updated = q.now()
+}
+
+// Remaining returns the requests left as of the last response, it is not known before the
+// first response or when the last one is older than maxAge since the quota may have been reset
+func (q *Quota) Remaining(maxAge time.Duration) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.updated.IsZero() || q.now().Sub(q.updated) > maxAge {
+		return 0, false
+	}
+	return q.remaining, true
+}
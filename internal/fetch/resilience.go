@@ -0,0 +1,295 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var ErrCircuitOpen = errors.New("upstream is temporarily unavailable, circuit breaker is open")
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter is the fraction of the delay that is randomized, from 0 to 1
+	Jitter float64
+	// Idempotent allows retrying requests that may have reached the upstream,
+	// non-idempotent requests are retried only when they were rejected with 429
+	Idempotent bool
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Jitter:      0.5,
+		Idempotent:  true,
+	}
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << attempt
+	if p.MaxDelay > 0 && (d > p.MaxDelay || d <= 0) {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		spread := float64(d) * min(p.Jitter, 1)
+		d = time.Duration(float64(d) - spread + rand.Float64()*2*spread)
+	}
+	return max(d, 0)
+}
+
+func (p RetryPolicy) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	code := statusCode(err)
+	if code == http.StatusTooManyRequests {
+		return true
+	}
+	if !p.Idempotent {
+		return false
+	}
+	if code >= http.StatusInternalServerError {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker fails fast after FailureThreshold consecutive failures and lets
+// a single probe request through once Cooldown has passed
+type CircuitBreaker struct {
+	Name             string
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	mu          sync.Mutex
+	state       CircuitState
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	lastFailure error
+	logger      *zerolog.Logger
+}
+
+func NewCircuitBreaker(name string, failureThreshold int, cooldown time.Duration, logger *zerolog.Logger) *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:             name,
+		FailureThreshold: failureThreshold,
+		Cooldown:         cooldown,
+		logger:           logger,
+	}
+}
+
+// Allow returns ErrCircuitOpen if the request must not reach the upstream,
+// every allowed request has to be reported back with Report
+func (cb *CircuitBreaker) Allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.Cooldown {
+			return ErrCircuitOpen
+		}
+		cb.transition(CircuitHalfOpen)
+		cb.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Report records the outcome of an allowed request, errors not related to the upstream health are ignored
+func (cb *CircuitBreaker) Report(err error) {
+	if countsAsFailure(err) {
+		cb.record(err)
+	} else {
+		cb.record(nil)
+	}
+}
+
+func (cb *CircuitBreaker) record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+	if err == nil {
+		cb.failures = 0
+		if cb.state != CircuitClosed {
+			cb.transition(CircuitClosed)
+		}
+		return
+	}
+
+	cb.failures++
+	cb.lastFailure = err
+	if cb.state == CircuitHalfOpen || (cb.FailureThreshold > 0 && cb.failures >= cb.FailureThreshold) {
+		cb.openedAt = time.Now()
+		if cb.state != CircuitOpen {
+			cb.transition(CircuitOpen)
+		}
+	}
+}
+
+func (cb *CircuitBreaker) transition(to CircuitState) {
+	if cb.logger != nil {
+		cb.logger.Warn().
+			Str("upstream", cb.Name).
+			Str("from", cb.state.String()).
+			Str("to", to.String()).
+			Int("failures", cb.failures).
+			Msg("circuit breaker state changed")
+	}
+	cb.state = to
+}
+
+// CircuitStatus is a snapshot of the breaker state
+type CircuitStatus struct {
+	Name        string
+	State       CircuitState
+	Failures    int
+	OpenedAt    time.Time
+	LastFailure error
+}
+
+func (cb *CircuitBreaker) Status() CircuitStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return CircuitStatus{
+		Name:        cb.Name,
+		State:       cb.state,
+		Failures:    cb.failures,
+		OpenedAt:    cb.openedAt,
+		LastFailure: cb.lastFailure,
+	}
+}
+
+// countsAsFailure tells whether the error says something about the upstream health,
+// client errors like an unknown city or a cancelled request do not
+func countsAsFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	code := statusCode(err)
+	if code != 0 {
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// ResilientFetcher wraps any Fetchable with retries and a circuit breaker
+type ResilientFetcher[Q Query, R any] struct {
+	inner   Fetchable[Q, R]
+	policy  RetryPolicy
+	breaker *CircuitBreaker
+	logger  *zerolog.Logger
+}
+
+func NewResilientFetcher[Q Query, R any](inner Fetchable[Q, R], policy RetryPolicy, breaker *CircuitBreaker) *ResilientFetcher[Q, R] {
+	return &ResilientFetcher[Q, R]{
+		inner:   inner,
+		policy:  policy,
+		breaker: breaker,
+	}
+}
+
+func (rf *ResilientFetcher[Q, R]) Set(APIKey string, logger *zerolog.Logger) error {
+	rf.logger = logger
+	if rf.breaker != nil && rf.breaker.logger == nil {
+		rf.breaker.logger = logger
+	}
+	return rf.inner.Set(APIKey, logger)
+}
+
+func (rf *ResilientFetcher[Q, R]) Breaker() *CircuitBreaker {
+	return rf.breaker
+}
+
+func (rf *ResilientFetcher[Q, R]) Fetch(ctx context.Context, q Q) (R, error) {
+	var zero R
+	if err := q.Validate(); err != nil {
+		return zero, err
+	}
+
+	attempts := max(rf.policy.MaxAttempts, 1)
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if rf.breaker != nil {
+			if err := rf.breaker.Allow(); err != nil {
+				return zero, err
+			}
+		}
+
+		var r R
+		r, err = rf.inner.Fetch(ctx, q)
+		if rf.breaker != nil {
+			rf.breaker.Report(err)
+		}
+		if err == nil {
+			return r, nil
+		}
+
+		if attempt == attempts-1 || !rf.policy.retryable(ctx, err) {
+			break
+		}
+
+		delay := rf.policy.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+			if rf.policy.MaxDelay > 0 && delay > rf.policy.MaxDelay {
+				// waiting longer than the policy allows is pointless, the user is waiting too
+				break
+			}
+		}
+
+		if rf.logger != nil {
+			rf.logger.Warn().Err(err).Int("attempt", attempt+1).Dur("delay", delay).Msg("retrying upstream request")
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return zero, err
+}
@@ -0,0 +1,168 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubQuery struct {
+	Value string
+}
+
+func (q stubQuery) Validate() error {
+	if q.Value == "" {
+		return errors.New("value is required")
+	}
+	return nil
+}
+
+// stubFetcher returns the queued errors one by one and then succeeds
+type stubFetcher struct {
+	errs  []error
+	calls int
+}
+
+func (sf *stubFetcher) Set(string, *zerolog.Logger) error {
+	return nil
+}
+
+func (sf *stubFetcher) Fetch(_ context.Context, q stubQuery) (string, error) {
+	sf.calls++
+	if len(sf.errs) > 0 {
+		err := sf.errs[0]
+		sf.errs = sf.errs[1:]
+		return "", err
+	}
+	return q.Value, nil
+}
+
+func testRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    50 * time.Millisecond,
+		Idempotent:  true,
+	}
+}
+
+func TestResilientFetcher_Retry(t *testing.T) {
+	unavailable := &StatusError{Upstream: "test", StatusCode: http.StatusServiceUnavailable}
+	notFound := &StatusError{Upstream: "test", StatusCode: http.StatusNotFound}
+	rateLimited := &StatusError{Upstream: "test", StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Millisecond}
+
+	tests := []struct {
+		name       string
+		errs       []error
+		idempotent bool
+		wantCalls  int
+		wantErr    error
+	}{
+		{
+			name:       "Succeeds after transient errors",
+			errs:       []error{unavailable, unavailable},
+			idempotent: true,
+			wantCalls:  3,
+		},
+		{
+			name:       "Gives up after max attempts",
+			errs:       []error{unavailable, unavailable, unavailable},
+			idempotent: true,
+			wantCalls:  3,
+			wantErr:    unavailable,
+		},
+		{
+			name:       "Client errors are not retried",
+			errs:       []error{notFound},
+			idempotent: true,
+			wantCalls:  1,
+			wantErr:    notFound,
+		},
+		{
+			name:       "Non-idempotent requests are not retried on 5xx",
+			errs:       []error{unavailable},
+			idempotent: false,
+			wantCalls:  1,
+			wantErr:    unavailable,
+		},
+		{
+			name:       "Non-idempotent requests are retried on 429",
+			errs:       []error{rateLimited},
+			idempotent: false,
+			wantCalls:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &stubFetcher{errs: tt.errs}
+			policy := testRetryPolicy()
+			policy.Idempotent = tt.idempotent
+			rf := NewResilientFetcher[stubQuery, string](inner, policy, nil)
+
+			got, err := rf.Fetch(context.Background(), stubQuery{Value: "ok"})
+			assert.Equal(t, tt.wantCalls, inner.calls)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, "ok", got)
+			}
+		})
+	}
+}
+
+func TestResilientFetcher_RetryAfterExceedsMaxDelay(t *testing.T) {
+	rateLimited := &StatusError{Upstream: "test", StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute}
+	inner := &stubFetcher{errs: []error{rateLimited}}
+	rf := NewResilientFetcher[stubQuery, string](inner, testRetryPolicy(), nil)
+
+	_, err := rf.Fetch(context.Background(), stubQuery{Value: "ok"})
+	assert.ErrorIs(t, err, rateLimited)
+	assert.Equal(t, 1, inner.calls)
+}
+
+func TestResilientFetcher_CircuitBreaker(t *testing.T) {
+	unavailable := &StatusError{Upstream: "test", StatusCode: http.StatusServiceUnavailable}
+	inner := &stubFetcher{errs: []error{unavailable, unavailable, unavailable}}
+	breaker := NewCircuitBreaker("test", 2, 20*time.Millisecond, nil)
+	policy := testRetryPolicy()
+	policy.MaxAttempts = 1
+	rf := NewResilientFetcher[stubQuery, string](inner, policy, breaker)
+
+	for i := 0; i < 2; i++ {
+		_, err := rf.Fetch(context.Background(), stubQuery{Value: "ok"})
+		assert.ErrorIs(t, err, unavailable)
+	}
+	assert.Equal(t, CircuitOpen, breaker.Status().State)
+
+	// fails fast without calling the upstream
+	_, err := rf.Fetch(context.Background(), stubQuery{Value: "ok"})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, inner.calls)
+
+	// a failed probe opens the breaker again
+	time.Sleep(25 * time.Millisecond)
+	_, err = rf.Fetch(context.Background(), stubQuery{Value: "ok"})
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, CircuitOpen, breaker.Status().State)
+
+	// a successful probe closes it
+	time.Sleep(25 * time.Millisecond)
+	got, err := rf.Fetch(context.Background(), stubQuery{Value: "ok"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", got)
+	assert.Equal(t, CircuitClosed, breaker.Status().State)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	d := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, time.Hour.Seconds(), d.Seconds(), 2)
+}
@@ -1,275 +1,337 @@
 package fetch
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io"
+	"math"
+	"net"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
-const (
-	FreeTierMaxDaysForecast  = 5
-	FreeTierMaxHoursForecast = 12
-)
+var ErrLocationNotFound = errors.New("no locations found")
 
-type WeatherFetcher struct {
-	BaseFetcher
-	client        *http.Client
-	locationCache map[string]string
-	cacheMutex    sync.RWMutex
+// GeoPosition is a point shared by the user, it is rounded to about a kilometer so that
+// nearby positions share the location lookup and the cached forecast
+type GeoPosition struct {
+	Latitude  float64
+	Longitude float64
 }
 
-type LocationResponse struct {
-	Key string `json:"Key"`
-}
-
-type ForecastResponse struct {
-	DailyForecasts  []DailyForecastResponse
-	HourlyForecasts []HourlyForecastResponse
+func (p GeoPosition) Rounded() GeoPosition {
+	return GeoPosition{
+		Latitude:  math.Round(p.Latitude*100) / 100,
+		Longitude: math.Round(p.Longitude*100) / 100,
+	}
 }
 
-type DailyForecastResponses struct {
-	DailyForecastResponses []DailyForecastResponse `json:"DailyForecasts"`
+// Key is the location cache key of the position
+func (p GeoPosition) Key() string {
+	r := p.Rounded()
+	return fmt.Sprintf("geo:%.2f,%.2f", r.Latitude, r.Longitude)
 }
 
-type DailyForecastResponse struct {
-	Date        string `json:"Date"`
-	Temperature struct {
-		Minimum struct {
-			Value float32 `json:"Value"`
-			Unit  string  `json:"Unit"`
-		} `json:"Minimum"`
-		Maximum struct {
-			Value float32 `json:"Value"`
-			Unit  string  `json:"Unit"`
-		} `json:"Maximum"`
-	} `json:"Temperature"`
-	Day struct {
-		IconPhrase             string `json:"IconPhrase"`
-		HasPrecipitation       bool   `json:"HasPrecipitation"`
-		PrecipitationType      string `json:"PrecipitationType"`
-		PrecipitationIntensity string `json:"PrecipitationIntensity"`
-	} `json:"Day"`
-	Night struct {
-		IconPhrase             string `json:"IconPhrase"`
-		HasPrecipitation       bool   `json:"HasPrecipitation"`
-		PrecipitationType      string `json:"PrecipitationType"`
-		PrecipitationIntensity string `json:"PrecipitationIntensity"`
-	} `json:"Night"`
+func (p GeoPosition) String() string {
+	r := p.Rounded()
+	return fmt.Sprintf("%.2f, %.2f", r.Latitude, r.Longitude)
 }
 
-type HourlyForecastResponse struct {
-	DateTime         string `json:"DateTime"`
-	WeatherIcon      int    `json:"WeatherIcon"`
-	IconPhrase       string `json:"IconPhrase"`
-	HasPrecipitation bool   `json:"HasPrecipitation"`
-	IsDaylight       bool   `json:"IsDaylight"`
-	Temperature      struct {
-		Value float32 `json:"Value"`
-		Unit  string  `json:"Unit"`
-	} `json:"Temperature"`
-	PrecipitationProbability float32 `json:"PrecipitationProbability"`
-	MobileLink               string  `json:"MobileLink"`
-	Link                     string  `json:"Link"`
+// WeatherQuery asks for the forecast of either a city or a position for some days or hours,
+// or for the current conditions there. Location is the city the user picked among the
+// ambiguous matches of the search, it skips the search. Language is the ISO 639-1 code of
+// the forecast phrases where the provider has them, English if empty
+type WeatherQuery struct {
+	City     string
+	Position *GeoPosition
+	Location *Location
+	Days     int
+	Hours    int
+	Current  bool
+	Language string
 }
 
-func utilTryRFCDateToHumanReadableDate(date string) string {
-	t, err := time.Parse(time.RFC3339, date)
-	if err != nil {
-		return date
+func (q WeatherQuery) Validate() error {
+	if q.Location != nil {
+		if q.Location.Key == "" && q.Location.Latitude == 0 && q.Location.Longitude == 0 {
+			return errors.New("location has neither a key nor a position")
+		}
+	} else if q.Position != nil {
+		if q.Position.Latitude < -90 || q.Position.Latitude > 90 || q.Position.Longitude < -180 || q.Position.Longitude > 180 {
+			return errors.New("position is out of range")
+		}
+	} else if strings.TrimSpace(q.City) == "" {
+		return errors.New("city is required")
 	}
-	return t.Format("2006-01-02 15:04:05")
-}
-
-func utilConvertTemperature(value float32, unit string) (float32, string) {
-	if unit == "F" {
-		return (value - 32) * 5 / 9, "C"
+	if q.Days < 0 || q.Hours < 0 {
+		return errors.New("days and hours must be positive")
 	}
-	return value, unit
+	if q.Current {
+		if q.Days > 0 || q.Hours > 0 {
+			return errors.New("current conditions take neither days nor hours")
+		}
+		return nil
+	}
+	if (q.Days > 0) == (q.Hours > 0) {
+		return errors.New("either days or hours is required")
+	}
+	return nil
 }
 
-func (fr ForecastResponse) String() string {
-	var r strings.Builder
-	if len(fr.DailyForecasts) > 0 {
-		for _, day := range fr.DailyForecasts {
-			minValue, minUnit := utilConvertTemperature(day.Temperature.Minimum.Value, day.Temperature.Minimum.Unit)
-			maxValue, maxUnit := utilConvertTemperature(day.Temperature.Maximum.Value, day.Temperature.Maximum.Unit)
-
-			r.WriteString(fmt.Sprintf("Date: %s\n", utilTryRFCDateToHumanReadableDate(day.Date)))
-			r.WriteString(fmt.Sprintf("Min Temp: %.2f %s\n", minValue, minUnit))
-			r.WriteString(fmt.Sprintf("Max Temp: %.2f %s\n", maxValue, maxUnit))
-			r.WriteString(fmt.Sprintf("Day: \n\tWeather: %s \n\tPrecipitation: %t\n", day.Day.IconPhrase, day.Day.HasPrecipitation))
-			r.WriteString(fmt.Sprintf("Night: \n\tWeather: %s \n\tPrecipitation: %t\n", day.Night.IconPhrase, day.Night.HasPrecipitation))
-			r.WriteString("\n")
-		}
-	} else {
-		for _, hour := range fr.HourlyForecasts {
-			tempValue, tempUnit := utilConvertTemperature(hour.Temperature.Value, hour.Temperature.Unit)
-
-			r.WriteString(fmt.Sprintf("Date: %s\n", utilTryRFCDateToHumanReadableDate(hour.DateTime)))
-			r.WriteString(fmt.Sprintf("Temp: %.2f %s\n", tempValue, tempUnit))
-			r.WriteString(fmt.Sprintf("Daylight: %t\n", hour.IsDaylight))
-			r.WriteString(fmt.Sprintf("Precipitation: %t\n", hour.HasPrecipitation))
-			r.WriteString(fmt.Sprintf("Precipitation Probability: %.2f\n", hour.PrecipitationProbability))
-			r.WriteString("\n")
+// locationQuery is the location cache key, the normalized city, the rounded position or the
+// key of the picked location
+func (q WeatherQuery) locationQuery() string {
+	if q.Location != nil {
+		if q.Location.Key != "" {
+			return "key:" + q.Location.Key
 		}
+		return q.Location.position().Key()
+	}
+	if q.Position != nil {
+		return q.Position.Key()
 	}
-	return r.String()
+	return NormalizeCity(q.City)
 }
 
-func (wf *WeatherFetcher) Set(APIKey string, logger *zerolog.Logger) error {
-	if err := wf.BaseFetcher.Set(APIKey, logger); err != nil {
-		return err
+func (q WeatherQuery) CacheKey() string {
+	key := fmt.Sprintf("%s|%d|%d", q.locationQuery(), q.Days, q.Hours)
+	if q.Current {
+		key += "|now"
 	}
-	wf.client = &http.Client{
-		Timeout: 10 * time.Second,
+	if q.Language != "" {
+		key += "|" + q.Language
 	}
-	wf.locationCache = make(map[string]string)
-	return nil
+	return key
 }
 
-func (wf *WeatherFetcher) buildCityURL(city string) string {
-	return fmt.Sprintf("http://dataservice.accuweather.com/locations/v1/search?&q=%s&apikey=%s", strings.ToLower(city), wf.APIKey)
-}
+// /////////////////////////////////////////////////////////////////////////////
+// Provider-neutral forecast model, temperatures are in Celsius
+// /////////////////////////////////////////////////////////////////////////////
 
-func (wf *WeatherFetcher) getLocationKey(city string) (string, error) {
-	wf.cacheMutex.RLock()
-	if key, found := wf.locationCache[city]; found {
-		wf.cacheMutex.RUnlock()
-		return key, nil
-	}
-	wf.cacheMutex.RUnlock()
+type Condition int
 
-	url := wf.buildCityURL(city)
+const (
+	ConditionUnknown Condition = iota
+	ConditionClear
+	ConditionPartlyCloudy
+	ConditionCloudy
+	ConditionFog
+	ConditionDrizzle
+	ConditionRain
+	ConditionSleet
+	ConditionSnow
+	ConditionThunderstorm
+	ConditionWind
+)
 
-	resp, err := wf.client.Get(url)
-	if err != nil {
-		wf.logger.Error().Err(err).Msg("error getting weather fetcher location key")
-		return "", err
+func (c Condition) String() string {
+	switch c {
+	case ConditionClear:
+		return "Clear"
+	case ConditionPartlyCloudy:
+		return "Partly cloudy"
+	case ConditionCloudy:
+		return "Cloudy"
+	case ConditionFog:
+		return "Fog"
+	case ConditionDrizzle:
+		return "Drizzle"
+	case ConditionRain:
+		return "Rain"
+	case ConditionSleet:
+		return "Sleet"
+	case ConditionSnow:
+		return "Snow"
+	case ConditionThunderstorm:
+		return "Thunderstorm"
+	case ConditionWind:
+		return "Windy"
+	default:
+		return "Unknown"
 	}
-	defer resp.Body.Close()
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		wf.logger.Error().Err(err).Msg("error reading weather fetcher location key response")
-		return "", err
-	}
+type PeriodForecast struct {
+	Phrase           string
+	Condition        Condition
+	HasPrecipitation bool
+}
 
-	var locations []LocationResponse
-	if err := json.Unmarshal(body, &locations); err != nil {
-		wf.logger.Error().Err(err).Msg("error unmarshalling weather fetcher location key response")
-		return "", err
-	}
+type DailyForecast struct {
+	Date                     time.Time
+	MinTemp                  float64
+	MaxTemp                  float64
+	Day                      PeriodForecast
+	Night                    PeriodForecast
+	PrecipitationProbability float64
+}
 
-	if len(locations) == 0 {
-		wf.logger.Error().Msg("weather fetcher: no locations found")
-		return "", errors.New("no locations found")
-	}
+type HourlyForecast struct {
+	Time                     time.Time
+	Temp                     float64
+	Phrase                   string
+	Condition                Condition
+	IsDaylight               bool
+	HasPrecipitation         bool
+	PrecipitationProbability float64
+}
 
-	k := locations[0].Key
+// CurrentConditions are the latest observation, wind speeds are in km/h and the pressure
+// is in hPa reduced to the sea level
+type CurrentConditions struct {
+	Time          time.Time
+	Temp          float64
+	FeelsLike     float64
+	Phrase        string
+	Condition     Condition
+	IsDaylight    bool
+	Humidity      float64
+	WindSpeed     float64
+	WindDirection float64
+	UVIndex       float64
+	Pressure      float64
+}
 
-	wf.cacheMutex.Lock()
-	wf.locationCache[city] = k
-	wf.cacheMutex.Unlock()
+// Forecast holds either the daily or the hourly forecast or the current conditions
+type Forecast struct {
+	Source    string
+	Location  string
+	Daily     []DailyForecast
+	Hourly    []HourlyForecast
+	Current   *CurrentConditions
+	FetchedAt time.Time
+	// Language of the phrases, empty is English
+	Language string
+	// PlanLimit is why a provider before Source did not answer, its plan is too short
+	PlanLimit *PlanLimitError
+}
 
-	return k, nil
+func fahrenheitToCelsius(value float64) float64 {
+	return (value - 32) * 5 / 9
 }
 
-func (wf *WeatherFetcher) buildURL(qParams map[string]interface{}) (string, error) {
-	baseURL := "http://dataservice.accuweather.com/forecasts/v1/"
+// /////////////////////////////////////////////////////////////////////////////
+// Providers with failover
+// /////////////////////////////////////////////////////////////////////////////
 
-	city, ok := qParams["city"].(string)
-	if city == "" || !ok {
-		wf.logger.Error().Msg("weather fetcher: city is required")
-		return "", errors.New("city is required")
-	}
+type WeatherProvider interface {
+	Fetchable[WeatherQuery, *Forecast]
+	Name() string
+}
 
-	locationKey, err := wf.getLocationKey(qParams["city"].(string))
-	if err != nil {
-		return "", err
-	}
+type namedWeatherProvider struct {
+	Fetchable[WeatherQuery, *Forecast]
+	name string
+}
 
-	rangeSegment := ""
-	days, ok := qParams["days"].(int)
-	if !ok {
-		hours, ok := qParams["hours"].(int)
-		if !ok {
-			wf.logger.Error().Msg("weather fetcher: days or hours required")
-			return "", errors.New("days or hours required")
-		}
+func (p *namedWeatherProvider) Name() string {
+	return p.name
+}
 
-		// forecast API only supports 1 or 12 hours
-		if hours <= 1 {
-			hours = 1
-		} else {
-			hours = FreeTierMaxHoursForecast
-		}
-		rangeSegment = fmt.Sprintf("hourly/%dhour/", hours)
-	} else {
-		if days <= 1 {
-			days = 1
-		} else {
-			days = FreeTierMaxDaysForecast
-		}
-		rangeSegment = fmt.Sprintf("daily/%dday/", days)
-	}
+// NamedWeatherProvider names any forecast fetcher, e.g. a provider wrapped into decorators
+func NamedWeatherProvider(name string, f Fetchable[WeatherQuery, *Forecast]) WeatherProvider {
+	return &namedWeatherProvider{Fetchable: f, name: name}
+}
 
-	return fmt.Sprintf("%s%s%s?apikey=%s", baseURL, rangeSegment, locationKey, wf.APIKey), nil
+// WeatherFetcher asks the providers in priority order and fails over to the next one
+// when a provider is unavailable, e.g. when the AccuWeather free quota is exhausted
+type WeatherFetcher struct {
+	providers []WeatherProvider
+	logger    *zerolog.Logger
 }
 
-func (wf *WeatherFetcher) Fetch(qParams map[string]interface{}) (string, error) {
-	if !wf.isSet() {
-		return "", errors.New("weather fetcher is not set")
-	}
+func NewWeatherFetcher(providers ...WeatherProvider) *WeatherFetcher {
+	return &WeatherFetcher{providers: providers}
+}
 
-	url, err := wf.buildURL(qParams)
-	if err != nil {
-		return "", err
+// Set only sets the logger, the providers are expected to be set already
+func (wf *WeatherFetcher) Set(_ string, logger *zerolog.Logger) error {
+	if logger == nil {
+		return errors.New("logger is required")
+	}
+	if len(wf.providers) == 0 {
+		return errors.New("at least one weather provider is required")
 	}
+	wf.logger = logger
+	return nil
+}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		wf.logger.Error().Err(err).Msg("error getting weather fetcher forecast")
-		return "", err
+func (wf *WeatherFetcher) Providers() []string {
+	names := make([]string, len(wf.providers))
+	for i, p := range wf.providers {
+		names[i] = p.Name()
 	}
-	defer resp.Body.Close()
+	return names
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		wf.logger.Error().Err(err).Msg("error reading weather fetcher forecast response")
-		return "", err
+func (wf *WeatherFetcher) Fetch(ctx context.Context, q WeatherQuery) (*Forecast, error) {
+	if wf.logger == nil {
+		return nil, errors.New("weather fetcher is not set")
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
 	}
 
-	var forecast ForecastResponse
-	if strings.Contains(url, "daily") {
-		var dailyForecastResponses DailyForecastResponses
-		if err := json.Unmarshal(body, &dailyForecastResponses); err != nil {
-			wf.logger.Error().Err(err).Msg("error unmarshalling weather fetcher daily forecast response")
-			return "", err
-		}
-		forecast.DailyForecasts = dailyForecastResponses.DailyForecastResponses
-		days, ok := qParams["days"].(int)
-		if ok && days > 0 {
-			forecast.DailyForecasts = forecast.DailyForecasts[:min(days, FreeTierMaxDaysForecast)]
+	var err error
+	// the first plan limit is shown with the forecast, the longest one tells how far the
+	// providers forecast at all
+	var firstLimit, longestLimit *PlanLimitError
+	for _, p := range wf.providers {
+		var forecast *Forecast
+		forecast, err = p.Fetch(ctx, q)
+		if err == nil {
+			forecast.Source = p.Name()
+			forecast.PlanLimit = firstLimit
+			if forecast.FetchedAt.IsZero() {
+				forecast.FetchedAt = time.Now()
+			}
+			return forecast, nil
 		}
-	} else {
-		var hourlyForecastResponses []HourlyForecastResponse
-		if err := json.Unmarshal(body, &hourlyForecastResponses); err != nil {
-			wf.logger.Error().Err(err).Msg("error unmarshalling weather fetcher hourly forecast response")
-			return "", err
+
+		if !shouldFailover(ctx, err) {
+			return nil, err
 		}
-		forecast.HourlyForecasts = hourlyForecastResponses
-		hours, ok := qParams["hours"].(int)
-		if ok && hours > 0 {
-			forecast.HourlyForecasts = forecast.HourlyForecasts[:min(hours, FreeTierMaxHoursForecast)]
+		var planErr *PlanLimitError
+		if errors.As(err, &planErr) {
+			if firstLimit == nil {
+				firstLimit = planErr
+			}
+			if longestLimit == nil || planErr.Max > longestLimit.Max {
+				longestLimit = planErr
+			}
 		}
+		wf.logger.Warn().Err(err).Str("provider", p.Name()).Msg("weather provider failed, trying the next one")
+	}
+	if errors.As(err, new(*PlanLimitError)) {
+		return nil, longestLimit
 	}
+	return nil, err
+}
 
-	return forecast.String(), nil
+// shouldFailover tells whether another provider may succeed where this one failed
+func shouldFailover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	// a provider with longer forecasts may cover it
+	var planErr *PlanLimitError
+	if errors.As(err, &planErr) {
+		return true
+	}
+	switch code := statusCode(err); {
+	case code == http.StatusUnauthorized, code == http.StatusForbidden, code == http.StatusTooManyRequests:
+		return true
+	case code >= http.StatusInternalServerError:
+		return true
+	case code != 0:
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
 }
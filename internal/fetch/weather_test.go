@@ -1,86 +1,211 @@
 package fetch
 
 import (
-	"os"
+	"context"
+	"errors"
+	"net/http"
 	"testing"
 
-	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestWeatherFetcher_Fetch(t *testing.T) {
-	err := godotenv.Load("../../.env")
-	if err != nil {
-		t.Skip("No .env file found, skipping TestWeatherFetcher_Fetch")
-	}
+type stubWeatherProvider struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (p *stubWeatherProvider) Name() string {
+	return p.name
+}
 
-	apiKey := os.Getenv("ACCU_WEATHER_API_KEY")
-	if apiKey == "" {
-		t.Skip("No AccuWeather API key found in env, skipping TestWeatherFetcher_Fetch")
+func (p *stubWeatherProvider) Set(string, *zerolog.Logger) error {
+	return nil
+}
+
+func (p *stubWeatherProvider) Fetch(_ context.Context, q WeatherQuery) (*Forecast, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
 	}
+	return &Forecast{Location: q.City, Daily: make([]DailyForecast, q.Days)}, nil
+}
 
-	wf := WeatherFetcher{
-		BaseFetcher: BaseFetcher{
-			APIKey: apiKey,
-			logger: &zerolog.Logger{},
+func TestWeatherFetcher_Failover(t *testing.T) {
+	quotaExceeded := &StatusError{Upstream: "forecast", StatusCode: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name       string
+		primaryErr error
+		wantSource string
+		wantErr    error
+		wantCalls  int
+	}{
+		{
+			name:       "Primary answers",
+			wantSource: "primary",
+			wantCalls:  0,
+		},
+		{
+			name:       "Quota exceeded fails over",
+			primaryErr: quotaExceeded,
+			wantSource: "secondary",
+			wantCalls:  1,
+		},
+		{
+			name:       "Open circuit fails over",
+			primaryErr: ErrCircuitOpen,
+			wantSource: "secondary",
+			wantCalls:  1,
+		},
+		{
+			name:       "Forecast beyond the plan fails over",
+			primaryErr: &PlanLimitError{Provider: "AccuWeather", Plan: "free", Unit: "days", Requested: 2, Max: 1},
+			wantSource: "secondary",
+			wantCalls:  1,
 		},
-		locationCache: make(map[string]string),
+		{
+			name:       "Unknown city does not fail over",
+			primaryErr: ErrLocationNotFound,
+			wantErr:    ErrLocationNotFound,
+			wantCalls:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &stubWeatherProvider{name: "primary", err: tt.primaryErr}
+			secondary := &stubWeatherProvider{name: "secondary"}
+			logger := zerolog.Nop()
+			wf := NewWeatherFetcher(primary, secondary)
+			assert.NoError(t, wf.Set("", &logger))
+
+			got, err := wf.Fetch(context.Background(), WeatherQuery{City: "Berlin", Days: 2})
+			assert.Equal(t, tt.wantCalls, secondary.calls)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantSource, got.Source)
+				assert.Len(t, got.Daily, 2)
+				assert.False(t, got.FetchedAt.IsZero())
+				var planErr *PlanLimitError
+				if errors.As(tt.primaryErr, &planErr) {
+					assert.Equal(t, planErr, got.PlanLimit, "the reply tells why the primary did not answer")
+				} else {
+					assert.Nil(t, got.PlanLimit)
+				}
+			}
+		})
+	}
+}
+
+func TestWeatherFetcher_AllProvidersFail(t *testing.T) {
+	unavailable := &StatusError{Upstream: "forecast", StatusCode: http.StatusBadGateway}
+	logger := zerolog.Nop()
+	wf := NewWeatherFetcher(
+		&stubWeatherProvider{name: "primary", err: unavailable},
+		NamedWeatherProvider("secondary", &stubWeatherProvider{err: unavailable}),
+	)
+	assert.NoError(t, wf.Set("", &logger))
+	assert.Equal(t, []string{"primary", "secondary"}, wf.Providers())
+
+	_, err := wf.Fetch(context.Background(), WeatherQuery{City: "Berlin", Hours: 1})
+	assert.ErrorIs(t, err, unavailable)
+}
+
+func TestWeatherFetcher_BeyondAllPlans(t *testing.T) {
+	logger := zerolog.Nop()
+	wf := NewWeatherFetcher(
+		&stubWeatherProvider{name: "primary", err: &PlanLimitError{Provider: "AccuWeather", Plan: "free", Unit: "days", Requested: 20, Max: 5}},
+		&stubWeatherProvider{name: "secondary", err: &PlanLimitError{Provider: "Open-Meteo", Unit: "days", Requested: 20, Max: 16}},
+	)
+	assert.NoError(t, wf.Set("", &logger))
+
+	_, err := wf.Fetch(context.Background(), WeatherQuery{City: "Berlin", Days: 20})
+	var planErr *PlanLimitError
+	if assert.ErrorAs(t, err, &planErr) {
+		assert.Equal(t, 16, planErr.Max, "the longest forecast of any provider is reported")
 	}
+}
 
+func TestWeatherQuery_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
-		params  map[string]interface{}
+		query   WeatherQuery
 		wantErr bool
 	}{
 		{
-			name: "Valid city and days",
-			params: map[string]interface{}{
-				"city": "London",
-				"days": 1,
-			},
+			name:    "Valid city and days",
+			query:   WeatherQuery{City: "London", Days: 3},
 			wantErr: false,
 		},
 		{
-			name: "Valid city and hours",
-			params: map[string]interface{}{
-				"city":  "London",
-				"hours": 1,
-			},
+			name:    "Valid city and hours",
+			query:   WeatherQuery{City: "London", Hours: 12},
+			wantErr: false,
+		},
+		{
+			name:    "Missing city",
+			query:   WeatherQuery{Days: 1},
+			wantErr: true,
+		},
+		{
+			name:    "Missing days and hours",
+			query:   WeatherQuery{City: "London"},
+			wantErr: true,
+		},
+		{
+			name:    "Both days and hours",
+			query:   WeatherQuery{City: "London", Days: 1, Hours: 1},
+			wantErr: true,
+		},
+		{
+			name:    "Negative days",
+			query:   WeatherQuery{City: "London", Days: -1},
+			wantErr: true,
+		},
+		{
+			name:    "Current conditions",
+			query:   WeatherQuery{City: "London", Current: true},
 			wantErr: false,
 		},
 		{
-			name: "Invalid city",
-			params: map[string]interface{}{
-				"city": "InvalidCity",
-				"days": 1,
-			},
+			name:    "Current conditions with hours",
+			query:   WeatherQuery{City: "London", Hours: 1, Current: true},
 			wantErr: true,
 		},
 		{
-			name: "Missing city",
-			params: map[string]interface{}{
-				"days": 1,
-			},
+			name:    "Valid position",
+			query:   WeatherQuery{Position: &GeoPosition{Latitude: 52.52, Longitude: 13.4}, Hours: 1},
+			wantErr: false,
+		},
+		{
+			name:    "Position out of range",
+			query:   WeatherQuery{Position: &GeoPosition{Latitude: 91, Longitude: 13.4}, Hours: 1},
 			wantErr: true,
 		},
 		{
-			name: "Missing days and hours",
-			params: map[string]interface{}{
-				"city": "London",
-			},
+			name:    "Picked location",
+			query:   WeatherQuery{City: "Paris", Location: &Location{Key: "351", Name: "Paris"}, Days: 1},
+			wantErr: false,
+		},
+		{
+			name:    "Picked location without a key or a position",
+			query:   WeatherQuery{City: "Paris", Location: &Location{Name: "Paris"}, Days: 1},
 			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := wf.Fetch(tt.params)
+			err := tt.query.Validate()
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.NotEmpty(t, got)
 			}
 		})
 	}
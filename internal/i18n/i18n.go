@@ -0,0 +1,197 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// /////////////////////////////////////////////////////////////////////////////
+// Message catalogs keyed by message ID, one JSON file per language in locales.
+// A message is a format string or an object of plural forms, e.g.
+// {"one": "%d day", "other": "%d days"}
+// /////////////////////////////////////////////////////////////////////////////
+
+// DefaultLanguage is used for unknown languages and for messages missing in a catalog
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// Default holds the catalogs shipped with the bot
+var Default = mustNewBundle(locales)
+
+// message holds the plural forms by the CLDR category, a plain string is the "other" form
+type message map[string]string
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*m = message{"other": text}
+		return nil
+	}
+	forms := map[string]string{}
+	if err := json.Unmarshal(data, &forms); err != nil {
+		return err
+	}
+	if _, ok := forms["other"]; !ok {
+		return errors.New("plural message has no other form")
+	}
+	*m = forms
+	return nil
+}
+
+type Bundle struct {
+	catalogs map[string]map[string]message
+}
+
+// NewBundle loads every locales/<language>.json of the file system
+func NewBundle(fsys fs.FS) (*Bundle, error) {
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{catalogs: make(map[string]map[string]message)}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		catalog := map[string]message{}
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", file, err)
+		}
+		b.catalogs[strings.TrimSuffix(path.Base(file), ".json")] = catalog
+	}
+	if _, ok := b.catalogs[DefaultLanguage]; !ok {
+		return nil, fmt.Errorf("no %s catalog", DefaultLanguage)
+	}
+	return b, nil
+}
+
+func mustNewBundle(fsys fs.FS) *Bundle {
+	b, err := NewBundle(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Languages lists the languages of the catalogs in alphabetical order
+func (b *Bundle) Languages() []string {
+	languages := make([]string, 0, len(b.catalogs))
+	for language := range b.catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Match returns the catalog language of an IETF language tag like "de-AT" or empty if there is none
+func (b *Bundle) Match(tag string) string {
+	language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	if _, ok := b.catalogs[language]; ok {
+		return language
+	}
+	return ""
+}
+
+// Localizer translates to the matching language of the tag or to the default one
+func (b *Bundle) Localizer(tag string) Localizer {
+	language := b.Match(tag)
+	if language == "" {
+		language = DefaultLanguage
+	}
+	return Localizer{bundle: b, language: language}
+}
+
+// Match is Bundle.Match of the default bundle
+func Match(tag string) string {
+	return Default.Match(tag)
+}
+
+// For is Bundle.Localizer of the default bundle
+func For(tag string) Localizer {
+	return Default.Localizer(tag)
+}
+
+// Localizer translates the messages to a language, the zero value translates to the default
+// language of the default bundle
+type Localizer struct {
+	bundle   *Bundle
+	language string
+}
+
+func (l Localizer) Language() string {
+	if l.language == "" {
+		return DefaultLanguage
+	}
+	return l.language
+}
+
+func (l Localizer) lookup(id string) (message, bool) {
+	b := l.bundle
+	if b == nil {
+		b = Default
+	}
+	if m, ok := b.catalogs[l.Language()][id]; ok {
+		return m, true
+	}
+	m, ok := b.catalogs[DefaultLanguage][id]
+	return m, ok
+}
+
+// T formats the message with the args, an unknown message is its ID
+func (l Localizer) T(id string, args ...any) string {
+	m, ok := l.lookup(id)
+	if !ok {
+		return id
+	}
+	if len(args) == 0 {
+		return m["other"]
+	}
+	return fmt.Sprintf(m["other"], args...)
+}
+
+// N formats the plural form of the message for the count with the count as the first arg
+func (l Localizer) N(id string, count int, args ...any) string {
+	m, ok := l.lookup(id)
+	if !ok {
+		return id
+	}
+	form, ok := m[pluralCategory(l.Language(), count)]
+	if !ok {
+		form = m["other"]
+	}
+	return fmt.Sprintf(form, append([]any{count}, args...)...)
+}
+
+// pluralCategory follows the CLDR rules for integers of the bundled languages, see
+// https://www.unicode.org/cldr/charts/latest/supplemental/language_plural_rules.html
+func pluralCategory(language string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	switch language {
+	case "ru":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	default:
+		// English, German and the languages without a rule of their own
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
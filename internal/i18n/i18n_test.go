@@ -0,0 +1,104 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPluralCategory(t *testing.T) {
+	tests := []struct {
+		language string
+		n        int
+		want     string
+	}{
+		{"en", 0, "other"},
+		{"en", 1, "one"},
+		{"en", 2, "other"},
+		{"de", 1, "one"},
+		{"de", 11, "other"},
+		{"ru", 1, "one"},
+		{"ru", 21, "one"},
+		{"ru", 11, "many"},
+		{"ru", 2, "few"},
+		{"ru", 24, "few"},
+		{"ru", 12, "many"},
+		{"ru", 5, "many"},
+		{"ru", 0, "many"},
+		{"ru", 111, "many"},
+		{"ru", -3, "few"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, pluralCategory(tt.language, tt.n), "%s %d", tt.language, tt.n)
+	}
+}
+
+func TestLocalizer(t *testing.T) {
+	bundle, err := NewBundle(fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{"hello": "Hello, %s", "days": {"one": "%d day", "other": "%d days"}, "only_en": "English"}`)},
+		"locales/ru.json": {Data: []byte(`{"hello": "Привет, %s", "days": {"one": "%d день", "few": "%d дня", "many": "%d дней", "other": "%d дня"}}`)},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"en", "ru"}, bundle.Languages())
+
+	ru := bundle.Localizer("ru-RU")
+	assert.Equal(t, "ru", ru.Language())
+	assert.Equal(t, "Привет, Анна", ru.T("hello", "Анна"))
+	assert.Equal(t, "1 день", ru.N("days", 1))
+	assert.Equal(t, "3 дня", ru.N("days", 3))
+	assert.Equal(t, "11 дней", ru.N("days", 11))
+	assert.Equal(t, "English", ru.T("only_en"))
+	assert.Equal(t, "missing", ru.T("missing"))
+
+	fr := bundle.Localizer("fr")
+	assert.Equal(t, "en", fr.Language())
+	assert.Equal(t, "1 day", fr.N("days", 1))
+	assert.Equal(t, "2 days", fr.N("days", 2))
+
+	_, err = NewBundle(fstest.MapFS{"locales/de.json": {Data: []byte(`{}`)}})
+	assert.EqualError(t, err, "no en catalog")
+	_, err = NewBundle(fstest.MapFS{"locales/en.json": {Data: []byte(`{"days": {"one": "%d day"}}`)}})
+	assert.ErrorContains(t, err, "plural message has no other form")
+}
+
+func TestMatch(t *testing.T) {
+	assert.Equal(t, "de", Match("de-AT"))
+	assert.Equal(t, "ru", Match("RU"))
+	assert.Equal(t, "en", Match("en"))
+	assert.Equal(t, "", Match("fr"))
+	assert.Equal(t, "", Match(""))
+
+	var zero Localizer
+	assert.Equal(t, "en", zero.Language())
+	assert.Equal(t, "Unknown place", zero.T("weather.pick_unknown"))
+}
+
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// every catalog has the messages of the default one with the same format verbs
+func TestDefaultCatalogs(t *testing.T) {
+	assert.Equal(t, []string{"de", "en", "ru"}, Default.Languages())
+
+	defaults := Default.catalogs[DefaultLanguage]
+	for _, language := range Default.Languages() {
+		catalog := Default.catalogs[language]
+		for id, m := range defaults {
+			translation, ok := catalog[id]
+			if !assert.True(t, ok, "%s has no %s", language, id) {
+				continue
+			}
+			want := formatVerb.FindAllString(m["other"], -1)
+			for form, text := range translation {
+				assert.Equal(t, want, formatVerb.FindAllString(text, -1), "%s %s %s", language, id, form)
+			}
+		}
+		for id := range catalog {
+			_, ok := defaults[id]
+			assert.True(t, ok, "%s has %s unknown to %s", language, id, DefaultLanguage)
+		}
+	}
+}
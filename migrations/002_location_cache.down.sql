@@ -0,0 +1 @@
+DROP TABLE IF EXISTS locations;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS locations (
+    query TEXT PRIMARY KEY,
+    location_key TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    country TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT '',
+    latitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    longitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
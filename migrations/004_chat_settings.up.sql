@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS chat_settings (
+    scope TEXT NOT NULL,
+    scope_id BIGINT NOT NULL,
+    model TEXT,
+    system_prompt TEXT,
+    temperature DOUBLE PRECISION,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope, scope_id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS chat_budgets;
+DROP TABLE IF EXISTS chat_usage;
\ No newline at end of file
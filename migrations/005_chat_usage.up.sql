@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS chat_usage (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    chat_id BIGINT NOT NULL,
+    model TEXT NOT NULL,
+    prompt_tokens INTEGER NOT NULL,
+    completion_tokens INTEGER NOT NULL,
+    estimated BOOLEAN NOT NULL DEFAULT FALSE,
+    cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS chat_usage_user_id_idx ON chat_usage (user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS chat_budgets (
+    user_id BIGINT PRIMARY KEY,
+    daily_tokens BIGINT,
+    monthly_tokens BIGINT,
+    daily_cost DOUBLE PRECISION,
+    monthly_cost DOUBLE PRECISION
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS location_choices;
+ALTER TABLE locations DROP COLUMN IF EXISTS region;
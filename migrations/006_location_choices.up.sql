@@ -0,0 +1,15 @@
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS region TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS location_choices (
+    user_id BIGINT NOT NULL,
+    query TEXT NOT NULL,
+    location_key TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    region TEXT NOT NULL DEFAULT '',
+    country TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT '',
+    latitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    longitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, query)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    chat_id BIGINT NOT NULL,
+    kind TEXT NOT NULL,
+    city TEXT NOT NULL,
+    minute_of_day INTEGER NOT NULL,
+    timezone TEXT NOT NULL,
+    next_run TIMESTAMPTZ NOT NULL,
+    last_run TIMESTAMPTZ,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS subscriptions_next_run_idx ON subscriptions (next_run);
+CREATE INDEX IF NOT EXISTS subscriptions_user_id_idx ON subscriptions (user_id);
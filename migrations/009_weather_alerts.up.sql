@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS watched_locations (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    chat_id BIGINT NOT NULL,
+    city TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS watched_locations_user_id_idx ON watched_locations (user_id);
+
+CREATE TABLE IF NOT EXISTS alert_notifications (
+    alert_id TEXT NOT NULL,
+    chat_id BIGINT NOT NULL,
+    message_id INTEGER NOT NULL,
+    location TEXT NOT NULL,
+    text TEXT NOT NULL,
+    ended BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (alert_id, chat_id)
+);
+
+CREATE INDEX IF NOT EXISTS alert_notifications_location_idx ON alert_notifications (chat_id, location) WHERE NOT ended;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS chat_reply_messages (
+    chat_id BIGINT NOT NULL,
+    message_id BIGINT NOT NULL,
+    chat_message_id INTEGER NOT NULL REFERENCES chat_messages (id) ON DELETE CASCADE,
+    PRIMARY KEY (chat_id, message_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE chat_usage ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE current_setting('TimeZone');
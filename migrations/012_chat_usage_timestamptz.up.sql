@@ -0,0 +1,2 @@
+-- the rows were written in the local time of the server, the periods are compared in UTC
+ALTER TABLE chat_usage ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
@@ -0,0 +1,2 @@
+ALTER TABLE watched_locations DROP COLUMN IF EXISTS language;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS language;
@@ -0,0 +1,4 @@
+-- the language of the Telegram app of the user, the scheduled forecasts and the alerts run
+-- without a message to take it from
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT '';
+ALTER TABLE watched_locations ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT '';